@@ -0,0 +1,33 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when the requested blob does not exist
+var ErrNotFound = errors.New("blob: not found")
+
+// Info describes a stored blob
+type Info struct {
+	ID   string
+	Size int64
+}
+
+// Object is an open blob that can be read from any offset
+type Object interface {
+	io.ReadSeekCloser
+	// Size returns the length of the blob in bytes
+	Size() int64
+}
+
+// Store keeps the binary content of imported files outside their metadata documents
+type Store interface {
+	// Put streams r into a new blob and returns its ID and size
+	Put(ctx context.Context, name string, r io.Reader) (Info, error)
+	// Open returns a reader over the blob or ErrNotFound
+	Open(ctx context.Context, id string) (Object, error)
+	// Delete removes the blob or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+}
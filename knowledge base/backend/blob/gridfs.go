@@ -0,0 +1,201 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStore is a Store backed by a MongoDB GridFS bucket
+type GridFSStore struct {
+	bucket *gridfs.Bucket
+}
+
+// NewGridFSStore returns a Store that keeps blobs in the named GridFS bucket of db
+func NewGridFSStore(db *mongo.Database, bucketName string) (*GridFSStore, error) {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSStore{bucket: bucket}, nil
+}
+
+func (s *GridFSStore) Put(ctx context.Context, name string, r io.Reader) (Info, error) {
+	upload, err := s.bucket.OpenUploadStream(name)
+	if err != nil {
+		return Info{}, err
+	}
+
+	// The upload stream takes no context of its own: the deadline bounds
+	// its chunk writes, and reading stops as soon as ctx is done
+	if deadline, ok := ctx.Deadline(); ok {
+		upload.SetWriteDeadline(deadline)
+	}
+
+	// Chunks are written as they fill, so the file is never held in memory whole
+	size, err := io.Copy(upload, contextReader{ctx, r})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		upload.Abort()
+		return Info{}, err
+	}
+	if err := upload.Close(); err != nil {
+		return Info{}, err
+	}
+
+	id := upload.FileID.(primitive.ObjectID)
+	return Info{ID: id.Hex(), Size: size}, nil
+}
+
+func (s *GridFSStore) Open(ctx context.Context, id string) (Object, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var file struct {
+		Length    int64 `bson:"length"`
+		ChunkSize int32 `bson:"chunkSize"`
+	}
+	err = s.bucket.GetFilesCollection().FindOne(ctx, bson.M{"_id": oid}).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &gridfsObject{
+		ctx:       ctx,
+		chunks:    s.bucket.GetChunksCollection(),
+		fileID:    oid,
+		size:      file.Length,
+		chunkSize: int64(file.ChunkSize),
+	}, nil
+}
+
+func (s *GridFSStore) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	err = s.bucket.DeleteContext(ctx, oid)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// contextReader fails reads once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// gridfsObject reads a GridFS file straight from its chunks collection so that
+// seeking only fetches the chunks from the new offset onwards
+type gridfsObject struct {
+	ctx       context.Context
+	chunks    *mongo.Collection
+	fileID    primitive.ObjectID
+	size      int64
+	chunkSize int64
+
+	pos      int64
+	cursor   *mongo.Cursor
+	next     int64 // index of the chunk the cursor returns next
+	buf      []byte
+	bufStart int64 // file offset of buf[0]
+}
+
+func (o *gridfsObject) Size() int64 { return o.size }
+
+func (o *gridfsObject) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.pos < o.bufStart || o.pos >= o.bufStart+int64(len(o.buf)) {
+		if err := o.load(o.pos / o.chunkSize); err != nil {
+			return 0, err
+		}
+		if o.pos >= o.bufStart+int64(len(o.buf)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	n := copy(p, o.buf[o.pos-o.bufStart:])
+	o.pos += int64(n)
+	return n, nil
+}
+
+// load fills the buffer with chunk n, reusing the open cursor when reading sequentially
+func (o *gridfsObject) load(n int64) error {
+	if o.cursor == nil || o.next != n {
+		if o.cursor != nil {
+			o.cursor.Close(o.ctx)
+		}
+		opts := options.Find().SetSort(bson.M{"n": 1})
+		cursor, err := o.chunks.Find(o.ctx, bson.M{"files_id": o.fileID, "n": bson.M{"$gte": n}}, opts)
+		if err != nil {
+			return err
+		}
+		o.cursor, o.next = cursor, n
+	}
+
+	if !o.cursor.Next(o.ctx) {
+		if err := o.cursor.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("blob: chunk %d of %s is missing", n, o.fileID.Hex())
+	}
+	var chunk struct {
+		N    int64  `bson:"n"`
+		Data []byte `bson:"data"`
+	}
+	if err := o.cursor.Decode(&chunk); err != nil {
+		return err
+	}
+	if chunk.N != n {
+		return fmt.Errorf("blob: chunk %d of %s is missing", n, o.fileID.Hex())
+	}
+	o.buf, o.bufStart, o.next = chunk.Data, n*o.chunkSize, n+1
+	return nil
+}
+
+func (o *gridfsObject) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("blob: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("blob: negative position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+func (o *gridfsObject) Close() error {
+	if o.cursor != nil {
+		return o.cursor.Close(o.ctx)
+	}
+	return nil
+}
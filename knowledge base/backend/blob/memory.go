@@ -0,0 +1,63 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is a Store that keeps blobs in process memory
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, name string, r io.Reader) (Info, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Info{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := primitive.NewObjectID().Hex()
+	s.blobs[id] = data
+	return Info{ID: id, Size: int64(len(data))}, nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, id string) (Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return memoryObject{bytes.NewReader(data)}, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.blobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.blobs, id)
+	return nil
+}
+
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (o memoryObject) Close() error { return nil }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes that can be written as "512KB", "32MB" or a plain number
+type ByteSize int64
+
+// Byte size units
+const (
+	B  ByteSize = 1
+	KB          = 1024 * B
+	MB          = 1024 * KB
+	GB          = 1024 * MB
+)
+
+// UnmarshalText parses sizes such as "1048576", "512KB" or "1.5GB"
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	unit := B
+	for _, u := range []struct {
+		suffix string
+		size   ByteSize
+	}{{"GB", GB}, {"MB", MB}, {"KB", KB}, {"B", B}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid byte size %q", string(text))
+	}
+	*b = ByteSize(n * float64(unit))
+	return nil
+}
+
+// String formats the size using the largest whole unit
+func (b ByteSize) String() string {
+	switch {
+	case b >= GB && b%GB == 0:
+		return fmt.Sprintf("%dGB", b/GB)
+	case b >= MB && b%MB == 0:
+		return fmt.Sprintf("%dMB", b/MB)
+	case b >= KB && b%KB == 0:
+		return fmt.Sprintf("%dKB", b/KB)
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"knowledge_base_backend/filetype"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the knowledge base server needs at startup
+type Config struct {
+	Server  ServerConfig  `yaml:"server" toml:"server"`
+	Storage StorageConfig `yaml:"storage" toml:"storage"`
+	Mongo   MongoConfig   `yaml:"mongo" toml:"mongo"`
+	Exports ExportsConfig `yaml:"exports" toml:"exports"`
+	Imports ImportsConfig `yaml:"imports" toml:"imports"`
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	ListenAddr   string        `yaml:"listen_addr" toml:"listen_addr"`
+	UploadLimit  ByteSize      `yaml:"upload_limit" toml:"upload_limit"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+}
+
+// StorageConfig selects the storage backend
+type StorageConfig struct {
+	Backend string `yaml:"backend" toml:"backend"`
+}
+
+// MongoConfig configures the MongoDB backend
+type MongoConfig struct {
+	URI                  string        `yaml:"uri" toml:"uri"`
+	Database             string        `yaml:"database" toml:"database"`
+	NotesCollection      string        `yaml:"notes_collection" toml:"notes_collection"`
+	ImportsCollection    string        `yaml:"imports_collection" toml:"imports_collection"`
+	RevisionsCollection  string        `yaml:"revisions_collection" toml:"revisions_collection"`
+	NotebooksCollection  string        `yaml:"notebooks_collection" toml:"notebooks_collection"`
+	LinksCollection      string        `yaml:"links_collection" toml:"links_collection"`
+	MigrationsCollection string        `yaml:"migrations_collection" toml:"migrations_collection"`
+	BlobBucket           string        `yaml:"blob_bucket" toml:"blob_bucket"`
+	ConnectTimeout       time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+}
+
+// ExportsConfig configures where exported files are written and how bundles
+// of notes are exported
+type ExportsConfig struct {
+	Root string `yaml:"root" toml:"root"`
+	// BackgroundNotes is how many notes a bundle may hold before it is
+	// exported as a background job instead of in the request
+	BackgroundNotes int            `yaml:"background_notes" toml:"background_notes"`
+	JobTTL          time.Duration  `yaml:"job_ttl" toml:"job_ttl"`         // how long finished jobs are kept
+	MaxJobs         int            `yaml:"max_jobs" toml:"max_jobs"`       // how many jobs may be queued or running
+	JobTimeout      time.Duration  `yaml:"job_timeout" toml:"job_timeout"` // how long a job may run
+	PDFFonts        PDFFontsConfig `yaml:"pdf_fonts" toml:"pdf_fonts"`
+}
+
+// PDFFontsConfig names TrueType files to write PDFs in instead of the Go
+// fonts, which lack CJK, Arabic and Hebrew among other scripts. Faces left
+// empty use the nearest face given.
+type PDFFontsConfig struct {
+	Regular    string `yaml:"regular" toml:"regular"`
+	Bold       string `yaml:"bold" toml:"bold"`
+	Italic     string `yaml:"italic" toml:"italic"`
+	BoldItalic string `yaml:"bold_italic" toml:"bold_italic"`
+	Mono       string `yaml:"mono" toml:"mono"`
+	MonoBold   string `yaml:"mono_bold" toml:"mono_bold"`
+}
+
+// ImportsConfig configures which uploads are accepted. Rules are file kinds
+// (image, video, audio, document, archive, unknown), MIME types, MIME
+// wildcards such as "audio/*", or "*".
+type ImportsConfig struct {
+	AllowedTypes   []string `yaml:"allowed_types" toml:"allowed_types"`
+	DeniedTypes    []string `yaml:"denied_types" toml:"denied_types"`
+	ThumbnailSizes []int    `yaml:"thumbnail_sizes" toml:"thumbnail_sizes"`
+}
+
+// Default returns the configuration used when nothing else is set
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddr:   ":8080",
+			UploadLimit:  4 * MB,
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  120 * time.Second,
+		},
+		Storage: StorageConfig{
+			Backend: "mongo",
+		},
+		Mongo: MongoConfig{
+			URI:                  "mongodb://localhost:27017",
+			Database:             "knowledgebase",
+			NotesCollection:      "notes",
+			ImportsCollection:    "imports",
+			RevisionsCollection:  "note_revisions",
+			NotebooksCollection:  "notebooks",
+			LinksCollection:      "note_links",
+			MigrationsCollection: "schema_migrations",
+			BlobBucket:           "import_blobs",
+			ConnectTimeout:       10 * time.Second,
+		},
+		Exports: ExportsConfig{
+			Root:            "./exports",
+			BackgroundNotes: 20,
+			JobTTL:          time.Hour,
+			MaxJobs:         16,
+			JobTimeout:      10 * time.Minute,
+		},
+		Imports: ImportsConfig{
+			ThumbnailSizes: []int{128, 256, 512},
+		},
+	}
+}
+
+// setting binds one configuration value to its environment variable and flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func settings() []setting {
+	return []setting{
+		{"KB_LISTEN_ADDR", "listen", "address the HTTP server listens on", setString(func(c *Config) *string { return &c.Server.ListenAddr })},
+		{"KB_UPLOAD_LIMIT", "upload-limit", "maximum request body size, e.g. 32MB", setByteSize(func(c *Config) *ByteSize { return &c.Server.UploadLimit })},
+		{"KB_READ_TIMEOUT", "read-timeout", "maximum duration for reading a request", setDuration(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+		{"KB_WRITE_TIMEOUT", "write-timeout", "maximum duration for writing a response", setDuration(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+		{"KB_IDLE_TIMEOUT", "idle-timeout", "maximum keep-alive idle time", setDuration(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+		{"KB_STORE", "store", "storage backend: mongo or memory", setString(func(c *Config) *string { return &c.Storage.Backend })},
+		{"KB_MONGO_URI", "mongo-uri", "MongoDB connection URI", setString(func(c *Config) *string { return &c.Mongo.URI })},
+		{"KB_MONGO_DATABASE", "mongo-database", "MongoDB database name", setString(func(c *Config) *string { return &c.Mongo.Database })},
+		{"KB_MONGO_NOTES_COLLECTION", "notes-collection", "MongoDB collection for notes", setString(func(c *Config) *string { return &c.Mongo.NotesCollection })},
+		{"KB_MONGO_IMPORTS_COLLECTION", "imports-collection", "MongoDB collection for imports", setString(func(c *Config) *string { return &c.Mongo.ImportsCollection })},
+		{"KB_MONGO_REVISIONS_COLLECTION", "revisions-collection", "MongoDB collection for note revisions", setString(func(c *Config) *string { return &c.Mongo.RevisionsCollection })},
+		{"KB_MONGO_NOTEBOOKS_COLLECTION", "notebooks-collection", "MongoDB collection for notebooks", setString(func(c *Config) *string { return &c.Mongo.NotebooksCollection })},
+		{"KB_MONGO_LINKS_COLLECTION", "links-collection", "MongoDB collection for links between notes", setString(func(c *Config) *string { return &c.Mongo.LinksCollection })},
+		{"KB_MONGO_MIGRATIONS_COLLECTION", "migrations-collection", "MongoDB collection recording applied schema migrations", setString(func(c *Config) *string { return &c.Mongo.MigrationsCollection })},
+		{"KB_MONGO_BLOB_BUCKET", "blob-bucket", "GridFS bucket for imported file content", setString(func(c *Config) *string { return &c.Mongo.BlobBucket })},
+		{"KB_MONGO_CONNECT_TIMEOUT", "mongo-connect-timeout", "maximum duration for connecting to MongoDB", setDuration(func(c *Config) *time.Duration { return &c.Mongo.ConnectTimeout })},
+		{"KB_EXPORT_ROOT", "export-root", "directory exported files are written to", setString(func(c *Config) *string { return &c.Exports.Root })},
+		{"KB_EXPORT_BACKGROUND_NOTES", "export-background-notes", "number of notes above which bundles are exported in the background", setInt(func(c *Config) *int { return &c.Exports.BackgroundNotes })},
+		{"KB_EXPORT_JOB_TTL", "export-job-ttl", "how long finished background exports are kept", setDuration(func(c *Config) *time.Duration { return &c.Exports.JobTTL })},
+		{"KB_EXPORT_MAX_JOBS", "export-max-jobs", "number of background exports that may be queued or running", setInt(func(c *Config) *int { return &c.Exports.MaxJobs })},
+		{"KB_EXPORT_JOB_TIMEOUT", "export-job-timeout", "how long a background export may run", setDuration(func(c *Config) *time.Duration { return &c.Exports.JobTimeout })},
+		{"KB_PDF_FONT", "pdf-font", "TrueType file of the regular font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.Regular })},
+		{"KB_PDF_FONT_BOLD", "pdf-font-bold", "TrueType file of the bold font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.Bold })},
+		{"KB_PDF_FONT_ITALIC", "pdf-font-italic", "TrueType file of the italic font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.Italic })},
+		{"KB_PDF_FONT_BOLD_ITALIC", "pdf-font-bold-italic", "TrueType file of the bold italic font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.BoldItalic })},
+		{"KB_PDF_FONT_MONO", "pdf-font-mono", "TrueType file of the monospaced font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.Mono })},
+		{"KB_PDF_FONT_MONO_BOLD", "pdf-font-mono-bold", "TrueType file of the bold monospaced font of exported PDFs", setString(func(c *Config) *string { return &c.Exports.PDFFonts.MonoBold })},
+		{"KB_IMPORTS_ALLOW", "imports-allow", "comma-separated file types accepted for import", setStringList(func(c *Config) *[]string { return &c.Imports.AllowedTypes })},
+		{"KB_IMPORTS_DENY", "imports-deny", "comma-separated file types rejected for import", setStringList(func(c *Config) *[]string { return &c.Imports.DeniedTypes })},
+		{"KB_THUMBNAIL_SIZES", "thumbnail-sizes", "comma-separated pixel sizes of image thumbnails", setIntList(func(c *Config) *[]int { return &c.Imports.ThumbnailSizes })},
+	}
+}
+
+// Load builds the configuration from defaults, an optional YAML or TOML file,
+// KB_* environment variables and command-line flags, in increasing precedence
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	all := settings()
+
+	fs := flag.NewFlagSet("knowledge-base", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("KB_CONFIG"), "path to a YAML or TOML config file")
+	for _, s := range all {
+		fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+	for _, s := range all {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(&cfg, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range all {
+			if s.flag == f.Name {
+				if err := s.set(&cfg, f.Value.String()); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+				}
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return cfg, cfg.Validate()
+}
+
+// loadFile decodes a config file, choosing the format from its extension
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		_, err = toml.Decode(string(data), cfg)
+	default:
+		return fmt.Errorf("config: %s: unsupported file type, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if _, port, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("server.listen_addr %q: must be host:port", c.Server.ListenAddr))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("server.listen_addr %q: invalid port", c.Server.ListenAddr))
+	}
+	check(c.Server.UploadLimit > 0, "server.upload_limit: must be positive")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout: must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout: must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout: must not be negative")
+	check(c.Exports.Root != "", "exports.root: must not be empty")
+	check(c.Exports.BackgroundNotes >= 0, "exports.background_notes: must not be negative")
+	check(c.Exports.JobTTL > 0, "exports.job_ttl: must be positive")
+	check(c.Exports.MaxJobs > 0, "exports.max_jobs: must be positive")
+	check(c.Exports.JobTimeout > 0, "exports.job_timeout: must be positive")
+	for _, rule := range c.Imports.AllowedTypes {
+		if err := filetype.ValidateRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("imports.allowed_types: %w", err))
+		}
+	}
+	for _, rule := range c.Imports.DeniedTypes {
+		if err := filetype.ValidateRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("imports.denied_types: %w", err))
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, size := range c.Imports.ThumbnailSizes {
+		check(size >= 16 && size <= 4096, "imports.thumbnail_sizes: %d must be between 16 and 4096", size)
+		check(!seen[size], "imports.thumbnail_sizes: %d is listed twice", size)
+		seen[size] = true
+	}
+
+	switch c.Storage.Backend {
+	case "memory":
+	case "mongo":
+		if u, err := url.Parse(c.Mongo.URI); err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") {
+			errs = append(errs, fmt.Errorf("mongo.uri %q: must be a mongodb:// or mongodb+srv:// URI", c.Mongo.URI))
+		}
+		check(c.Mongo.Database != "", "mongo.database: must not be empty")
+		// Each kind of document needs a collection of its own
+		collections := []struct{ key, name string }{
+			{"mongo.notes_collection", c.Mongo.NotesCollection},
+			{"mongo.imports_collection", c.Mongo.ImportsCollection},
+			{"mongo.revisions_collection", c.Mongo.RevisionsCollection},
+			{"mongo.notebooks_collection", c.Mongo.NotebooksCollection},
+			{"mongo.links_collection", c.Mongo.LinksCollection},
+		}
+		for i, col := range collections {
+			check(col.name != "", "%s: must not be empty", col.key)
+			for _, earlier := range collections[:i] {
+				check(col.name == "" || col.name != earlier.name, "%s: must differ from %s", col.key, earlier.key)
+			}
+		}
+		check(c.Mongo.MigrationsCollection != "", "mongo.migrations_collection: must not be empty")
+		check(c.Mongo.BlobBucket != "", "mongo.blob_bucket: must not be empty")
+		check(c.Mongo.ConnectTimeout > 0, "mongo.connect_timeout: must be positive")
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend %q: must be \"mongo\" or \"memory\"", c.Storage.Backend))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setStringList(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setIntList(field func(*Config) *[]int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var list []int
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", item)
+			}
+			list = append(list, n)
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func setByteSize(field func(*Config) *ByteSize) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}
+}
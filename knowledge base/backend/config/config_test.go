@@ -0,0 +1,216 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+		ok   bool
+	}{
+		{"1048576", MB, true},
+		{"512KB", 512 * KB, true},
+		{" 32 mb ", 32 * MB, true},
+		{"1.5GB", GB + GB/2, true},
+		{"10B", 10, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"-1KB", 0, false},
+		{"12TB", 0, false},
+	}
+	for _, tt := range tests {
+		var b ByteSize
+		err := b.UnmarshalText([]byte(tt.in))
+		if (err == nil) != tt.ok || b != tt.want {
+			t.Errorf("UnmarshalText(%q) = %d, %v, want %d", tt.in, b, err, tt.want)
+		}
+	}
+
+	for size, want := range map[ByteSize]string{
+		0:         "0B",
+		1000:      "1000B",
+		2 * KB:    "2KB",
+		KB + 1:    "1025B",
+		4 * MB:    "4MB",
+		GB:        "1GB",
+		GB + 5*MB: "1029MB",
+	} {
+		if got := size.String(); got != want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(size), got, want)
+		}
+	}
+}
+
+// clearEnv unsets the KB_* variables for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, s := range settings() {
+		if value, ok := os.LookupEnv(s.env); ok {
+			t.Setenv(s.env, value)
+			os.Unsetenv(s.env)
+		}
+	}
+	t.Setenv("KB_CONFIG", "")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.ListenAddr != ":8080" || cfg.Server.UploadLimit != 4*MB || cfg.Storage.Backend != "mongo" {
+		t.Errorf("defaults = %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	yamlFile := writeFile(t, "kb.yaml", `
+server:
+  listen_addr: ":9000"
+  upload_limit: 16MB
+  read_timeout: 5s
+storage:
+  backend: memory
+exports:
+  background_notes: 5
+imports:
+  thumbnail_sizes: [64]
+`)
+	tomlFile := writeFile(t, "kb.toml", `
+[server]
+listen_addr = ":9000"
+upload_limit = "16MB"
+read_timeout = "5s"
+
+[storage]
+backend = "memory"
+
+[exports]
+background_notes = 5
+
+[imports]
+thumbnail_sizes = [64]
+`)
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Setenv("KB_READ_TIMEOUT", "7s")
+		t.Setenv("KB_EXPORT_BACKGROUND_NOTES", "9")
+		cfg, err := Load([]string{"-config", file, "-export-background-notes", "11"})
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Ext(file), err)
+		}
+		if cfg.Server.ListenAddr != ":9000" || cfg.Server.UploadLimit != 16*MB || cfg.Storage.Backend != "memory" {
+			t.Errorf("%s: file settings not applied: %+v", filepath.Ext(file), cfg.Server)
+		}
+		if cfg.Server.ReadTimeout != 7*time.Second {
+			t.Errorf("%s: read timeout %v, want the environment's 7s", filepath.Ext(file), cfg.Server.ReadTimeout)
+		}
+		if cfg.Exports.BackgroundNotes != 11 {
+			t.Errorf("%s: background notes %d, want the flag's 11", filepath.Ext(file), cfg.Exports.BackgroundNotes)
+		}
+		if !slices.Equal(cfg.Imports.ThumbnailSizes, []int{64}) {
+			t.Errorf("%s: thumbnail sizes %v", filepath.Ext(file), cfg.Imports.ThumbnailSizes)
+		}
+		if cfg.Server.WriteTimeout != 30*time.Second {
+			t.Errorf("%s: write timeout %v, want the default", filepath.Ext(file), cfg.Server.WriteTimeout)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t)
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string // in the error
+	}{
+		{"bad values", map[string]string{"KB_UPLOAD_LIMIT": "lots", "KB_THUMBNAIL_SIZES": "64,big"}, nil,
+			[]string{"KB_UPLOAD_LIMIT", "KB_THUMBNAIL_SIZES"}},
+		{"bad flag value", nil, []string{"-read-timeout", "soon"}, []string{"-read-timeout"}},
+		{"unknown file type", nil, []string{"-config", writeFile(t, "kb.ini", "")}, []string{"unsupported file type"}},
+		{"missing file", nil, []string{"-config", filepath.Join(t.TempDir(), "kb.yaml")}, []string{"kb.yaml"}},
+		{"invalid settings", map[string]string{"KB_STORE": "memory", "KB_LISTEN_ADDR": "nowhere", "KB_EXPORT_MAX_JOBS": "0"}, nil,
+			[]string{"server.listen_addr", "exports.max_jobs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(tt.args)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string // in the error, or "" when valid
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"memory store ignores mongo", func(c *Config) { c.Storage.Backend = "memory"; c.Mongo.URI = "" }, ""},
+		{"port out of range", func(c *Config) { c.Server.ListenAddr = ":70000" }, "invalid port"},
+		{"no upload limit", func(c *Config) { c.Server.UploadLimit = 0 }, "server.upload_limit"},
+		{"negative timeout", func(c *Config) { c.Server.IdleTimeout = -time.Second }, "server.idle_timeout"},
+		{"no export root", func(c *Config) { c.Exports.Root = "" }, "exports.root"},
+		{"no job timeout", func(c *Config) { c.Exports.JobTimeout = 0 }, "exports.job_timeout"},
+		{"bad type rule", func(c *Config) { c.Imports.DeniedTypes = []string{"pictures"} }, "imports.denied_types"},
+		{"tiny thumbnail", func(c *Config) { c.Imports.ThumbnailSizes = []int{8} }, "between 16 and 4096"},
+		{"repeated thumbnail", func(c *Config) { c.Imports.ThumbnailSizes = []int{64, 64} }, "listed twice"},
+		{"unknown backend", func(c *Config) { c.Storage.Backend = "sqlite" }, "storage.backend"},
+		{"bad mongo uri", func(c *Config) { c.Mongo.URI = "http://localhost" }, "mongo.uri"},
+		{"shared collection", func(c *Config) { c.Mongo.LinksCollection = c.Mongo.NotesCollection }, "must differ from mongo.notes_collection"},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		tt.change(&cfg)
+		err := cfg.Validate()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// The example config is valid and sets every section
+func TestExampleConfig(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load([]string{"-config", "../config.example.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.UploadLimit != 32*MB || cfg.Mongo.ConnectTimeout != 10*time.Second ||
+		cfg.Exports.JobTimeout != 10*time.Minute || len(cfg.Imports.ThumbnailSizes) != 3 {
+		t.Errorf("example config = %+v", cfg)
+	}
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"knowledge_base_backend/export"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/store"
+	"knowledge_base_backend/tags"
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bundleFormats are the formats a bundle of notes is exported in
+var bundleFormats = []string{"zip", "pdf"}
+
+// exportRequest is the body of CreateExport. Exactly one of Query, Tag and
+// IDs picks the notes.
+type exportRequest struct {
+	Query      string               `json:"query"`       // search query, notes in order of rank
+	Tag        string               `json:"tag"`         // notes carrying the tag or a tag below it
+	IDs        []primitive.ObjectID `json:"ids"`         // notes in the order given
+	Format     string               `json:"format"`      // zip or pdf, zip by default
+	NoteFormat string               `json:"note_format"` // of each note in a zip, md by default
+	Background bool                 `json:"background"`  // whether to build the bundle in the background however small
+}
+
+// exportJob is a background export as answered to the client
+type exportJob struct {
+	export.Job
+	Download string `json:"download,omitempty"` // where to fetch the file once done
+}
+
+// CreateExport exports the notes matching a search query, carrying a tag or
+// listed by ID as a ZIP of a file for each with a manifest and the imports
+// they refer to, or as one PDF with a table of contents. Bundles of more
+// notes than configured are built in the background: the answer is then
+// 202 Accepted with the job to poll at GetExport.
+func (nc *NoteController) CreateExport(c *fiber.Ctx) error {
+	var input exportRequest
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	selectors := 0
+	for _, given := range []bool{input.Query != "", input.Tag != "", len(input.IDs) > 0} {
+		if given {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Exactly one of query, tag or ids is required",
+		})
+	}
+	input.Format = strings.ToLower(input.Format)
+	if input.Format == "" {
+		input.Format = "zip"
+	}
+	if input.Format != "zip" && input.Format != "pdf" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be one of " + strings.Join(bundleFormats, ", "),
+		})
+	}
+	if input.NoteFormat == "" {
+		input.NoteFormat = "md"
+	}
+	noteFormat, ok := export.Lookup(input.NoteFormat)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Note format must be one of " + strings.Join(export.Names(), ", "),
+		})
+	}
+
+	// Pick the notes, and a title for the bundle
+	var notes []models.Note
+	var title string
+	switch {
+	case input.Query != "":
+		parsed, err := query.Parse(input.Query)
+		if err != nil {
+			return queryError(c, err)
+		}
+		if notes, err = nc.rankedNotes(c.UserContext(), parsed); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to perform search",
+			})
+		}
+		title = "Search: " + input.Query
+	case input.Tag != "":
+		tag := tags.Normalize(input.Tag)
+		if tag == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid tag",
+			})
+		}
+		var err error
+		if notes, err = nc.notes.Find(c.UserContext(), query.Tag{Value: tag}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to retrieve notes",
+			})
+		}
+		title = tag
+	default:
+		seen := make(map[primitive.ObjectID]bool, len(input.IDs))
+		for _, id := range input.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			note, err := nc.notes.Get(c.UserContext(), id)
+			if err == store.ErrNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Note " + id.Hex() + " not found",
+				})
+			}
+			if err != nil {
+				return noteLookupError(c, err)
+			}
+			notes = append(notes, note)
+		}
+		title = "Notes"
+	}
+	if len(notes) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No notes to export",
+		})
+	}
+
+	job := export.Job{
+		Format:   input.Format,
+		Notes:    len(notes),
+		FileName: export.FileName(title, "."+input.Format),
+		MIMEType: "application/zip",
+	}
+	if input.Format == "pdf" {
+		job.MIMEType = "application/pdf"
+	}
+	write := func(ctx context.Context, w io.Writer) error {
+		var err error
+		if input.Format == "pdf" {
+			err = nc.writeCombinedPDF(ctx, w, title, notes)
+		} else {
+			err = nc.writeBundle(ctx, w, noteFormat, notes)
+		}
+		if err != nil {
+			fmt.Printf("Warning - failed to export %d notes as %s: %s\n", len(notes), input.Format, err)
+			return errors.New("failed to export notes")
+		}
+		return nil
+	}
+
+	// Build large bundles in the background, beyond the request timeouts
+	if input.Background || len(notes) > nc.exports.BackgroundNotes {
+		job, err := nc.exports.Jobs.Start(job, write)
+		if errors.Is(err, export.ErrJobsFull) {
+			c.Set(fiber.HeaderRetryAfter, "60")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Too many exports in progress",
+			})
+		}
+		c.Location("/exports/" + job.ID)
+		return c.Status(fiber.StatusAccepted).JSON(exportJob{Job: job})
+	}
+
+	var buf bytes.Buffer
+	if err := write(c.UserContext(), &buf); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export notes",
+		})
+	}
+	return sendDownload(c, &buf, job.FileName, job.MIMEType)
+}
+
+// GetExport returns the state of a background export, with where to
+// download it once done
+func (nc *NoteController) GetExport(c *fiber.Ctx) error {
+	job, err := nc.exports.Jobs.Get(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Export not found",
+		})
+	}
+	answer := exportJob{Job: job}
+	if job.Status == export.JobDone {
+		answer.Download = "/exports/" + job.ID + "/download"
+	}
+	return c.JSON(answer)
+}
+
+// DownloadExport sends the file of a finished background export
+func (nc *NoteController) DownloadExport(c *fiber.Ctx) error {
+	f, job, err := nc.exports.Jobs.Open(c.Params("id"))
+	switch {
+	case errors.Is(err, export.ErrJobNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Export not found",
+		})
+	case errors.Is(err, export.ErrJobNotDone):
+		msg := "Export is not finished yet"
+		if job.Status == export.JobFailed {
+			msg = "Export failed"
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  msg,
+			"status": job.Status,
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to open export",
+		})
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to open export",
+		})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{
+		"filename": job.FileName,
+	}))
+	c.Set(fiber.HeaderContentType, job.MIMEType)
+	return c.SendStream(f, int(info.Size())) // closed once sent
+}
+
+// rankedNotes returns the notes matching a query, best match first. Words
+// are looked up in the index; the store only applies the other filters.
+func (nc *NoteController) rankedNotes(ctx context.Context, q query.Node) ([]models.Note, error) {
+	notes, err := nc.notes.Find(ctx, query.Resolve(q, nc.index))
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[primitive.ObjectID]models.Note, len(notes))
+	ids := make([]primitive.ObjectID, 0, len(notes))
+	for _, note := range notes {
+		matches[note.ID] = note
+		ids = append(ids, note.ID)
+	}
+	ranked := make([]models.Note, 0, len(notes))
+	for _, hit := range nc.index.Search(strings.Join(query.Terms(q), " "), ids, 0) {
+		ranked = append(ranked, matches[hit.ID])
+	}
+	return ranked, nil
+}
+
+// writeCombinedPDF writes the notes as one PDF under title
+func (nc *NoteController) writeCombinedPDF(ctx context.Context, w io.Writer, title string, notes []models.Note) error {
+	book := export.Book{Title: title, Fonts: nc.exports.PDFFonts}
+	for _, note := range notes {
+		src, err := nc.exportSource(ctx, note)
+		if err != nil {
+			return fmt.Errorf("note %s: %w", note.ID.Hex(), err)
+		}
+		book.Chapters = append(book.Chapters, src)
+	}
+	return export.WriteCombinedPDF(w, book)
+}
+
+// writeBundle writes the notes as a ZIP of files in format, along with the
+// imports they refer to. Imports that no longer exist are left out.
+func (nc *NoteController) writeBundle(ctx context.Context, w io.Writer, format export.Format, notes []models.Note) error {
+	bundle := export.Bundle{Format: format}
+	bundled := make(map[string]bool)
+	for _, note := range notes {
+		src, err := nc.exportSource(ctx, note)
+		if err != nil {
+			return fmt.Errorf("note %s: %w", note.ID.Hex(), err)
+		}
+		bundle.Notes = append(bundle.Notes, src)
+
+		for _, id := range src.ImportIDs() {
+			if bundled[id] {
+				continue
+			}
+			bundled[id] = true
+			objID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				continue
+			}
+			imp, err := nc.imports.Get(ctx, objID)
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("import %s: %w", id, err)
+			}
+			bundle.Attachments = append(bundle.Attachments, export.Attachment{
+				ID:       id,
+				FileName: imp.FileName,
+				MIMEType: imp.MIMEType,
+				Size:     imp.Size,
+				Open: func() (io.ReadCloser, error) {
+					return nc.blobs.Open(ctx, imp.BlobID)
+				},
+			})
+		}
+	}
+	return export.WriteZIP(w, bundle)
+}
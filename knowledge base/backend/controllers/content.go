@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/filetype"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errUnsatisfiableRange is returned when no requested range overlaps the content
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// byteRange is an inclusive-exclusive span [start, start+length) of the content
+type byteRange struct {
+	start, length int64
+}
+
+// content describes a blob being served over HTTP
+type content struct {
+	object      blob.Object
+	fileName    string
+	contentType string
+	etag        string
+	modTime     time.Time
+	attachment  bool
+}
+
+// serveContent streams the content with validators and single-range support,
+// answering conditional requests with 304 and unsatisfiable ranges with 416.
+// The content is sandboxed and never sniffed, so uploaded files cannot run
+// scripts on the API's origin.
+func serveContent(c *fiber.Ctx, ct content) error {
+	size := ct.object.Size()
+	modTime := ct.modTime.UTC().Truncate(time.Second)
+	if filetype.Active(ct.contentType) {
+		ct.attachment = true
+	}
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, ct.etag)
+	c.Set(fiber.HeaderLastModified, modTime.Format(http.TimeFormat))
+	c.Set(fiber.HeaderContentType, ct.contentType)
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(ct.fileName, ct.attachment))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox; default-src 'none'")
+
+	// Conditional GET: If-None-Match takes precedence over If-Modified-Since
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		if etagMatches(inm, ct.etag) {
+			ct.object.Close()
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if ims, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince)); err == nil && !modTime.After(ims) {
+		ct.object.Close()
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	rangeHeader := c.Get(fiber.HeaderRange)
+	if ifRange := c.Get(fiber.HeaderIfRange); ifRange != "" && !ifRangeMatches(ifRange, ct.etag, modTime) {
+		// The client's copy is stale, so it gets the whole representation
+		rangeHeader = ""
+	}
+
+	ranges, err := parseRange(rangeHeader, size)
+	if err == errUnsatisfiableRange {
+		ct.object.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(fiber.Map{
+			"error": "Requested range not satisfiable",
+		})
+	}
+
+	// Malformed and multi-range requests are answered with the full content
+	if err != nil || len(ranges) != 1 {
+		c.Status(fiber.StatusOK)
+		return c.SendStream(ct.object, int(size))
+	}
+
+	r := ranges[0]
+	if _, err := ct.object.Seek(r.start, io.SeekStart); err != nil {
+		ct.object.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read content",
+		})
+	}
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size))
+	c.Status(fiber.StatusPartialContent)
+	return c.SendStream(limitedReadCloser{io.LimitReader(ct.object, r.length), ct.object}, int(r.length))
+}
+
+// limitedReadCloser lets the response close the underlying object after a partial read
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// parseRange parses a "bytes=" Range header against content of the given size.
+// An empty header yields no ranges.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+		if first == "" {
+			// Suffix range: the final N bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if start >= size {
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errors.New("invalid range")
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		if r.length > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists the given entity tag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether an If-Range validator still identifies the content
+func ifRangeMatches(header, etag string, modTime time.Time) bool {
+	if strings.HasPrefix(header, `"`) {
+		return header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && t.Equal(modTime)
+}
+
+// contentDisposition builds an inline or attachment header carrying the original file name
+func contentDisposition(fileName string, attachment bool) string {
+	disposition := "inline"
+	if attachment {
+		disposition = "attachment"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": fileName}); header != "" {
+		return header
+	}
+	return disposition
+}
+
+// mediaTypes covers media extensions missing from the platform MIME tables
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+}
+
+// contentTypeFor guesses a MIME type from the file extension
+func contentTypeFor(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return fiber.MIMEOctetStream
+}
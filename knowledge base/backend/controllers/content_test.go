@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"knowledge_base_backend/blob"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testContent = "0123456789"
+
+var testModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// contentApp serves testContent at / as serveContent does for imports
+func contentApp(t *testing.T, contentType string) *fiber.App {
+	t.Helper()
+	blobs := blob.NewMemoryStore()
+	info, err := blobs.Put(context.Background(), "test", strings.NewReader(testContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		object, err := blobs.Open(c.UserContext(), info.ID)
+		if err != nil {
+			return err
+		}
+		return serveContent(c, content{
+			object:      object,
+			fileName:    "file",
+			contentType: contentType,
+			etag:        `"v1"`,
+			modTime:     testModTime,
+			attachment:  c.QueryBool("download"),
+		})
+	})
+	return app
+}
+
+func TestServeContent(t *testing.T) {
+	app := contentApp(t, "text/plain")
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"whole", nil, 200, testContent, ""},
+		{"range", map[string]string{"Range": "bytes=2-5"}, 206, "2345", "bytes 2-5/10"},
+		{"open range", map[string]string{"Range": "bytes=7-"}, 206, "789", "bytes 7-9/10"},
+		{"suffix range", map[string]string{"Range": "bytes=-3"}, 206, "789", "bytes 7-9/10"},
+		{"range past the end", map[string]string{"Range": "bytes=8-20"}, 206, "89", "bytes 8-9/10"},
+		{"suffix longer than content", map[string]string{"Range": "bytes=-20"}, 206, testContent, "bytes 0-9/10"},
+		{"unsatisfiable", map[string]string{"Range": "bytes=10-"}, 416, "", "bytes */10"},
+		{"empty suffix", map[string]string{"Range": "bytes=-0"}, 416, "", "bytes */10"},
+		{"multiple ranges", map[string]string{"Range": "bytes=0-1,4-5"}, 200, testContent, ""},
+		{"unknown unit", map[string]string{"Range": "items=0-1"}, 200, testContent, ""},
+		{"malformed range", map[string]string{"Range": "bytes=5-2"}, 200, testContent, ""},
+		{"if-range etag matches", map[string]string{"Range": "bytes=0-1", "If-Range": `"v1"`}, 206, "01", "bytes 0-1/10"},
+		{"if-range etag stale", map[string]string{"Range": "bytes=0-1", "If-Range": `"v0"`}, 200, testContent, ""},
+		{"if-range date matches", map[string]string{"Range": "bytes=0-1", "If-Range": testModTime.Format(http.TimeFormat)}, 206, "01", "bytes 0-1/10"},
+		{"if-range date stale", map[string]string{"Range": "bytes=0-1", "If-Range": testModTime.Add(-time.Hour).Format(http.TimeFormat)}, 200, testContent, ""},
+		{"if-none-match", map[string]string{"If-None-Match": `"v0", W/"v1"`}, 304, "", ""},
+		{"if-none-match stale", map[string]string{"If-None-Match": `"v0"`}, 200, testContent, ""},
+		{"if-modified-since", map[string]string{"If-Modified-Since": testModTime.Format(http.TimeFormat)}, 304, "", ""},
+		{"modified since", map[string]string{"If-Modified-Since": testModTime.Add(-time.Hour).Format(http.TimeFormat)}, 200, testContent, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if tt.status != 416 && string(body) != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.name, body, tt.body)
+		}
+		if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", tt.name, got, tt.contentRange)
+		}
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options %q", tt.name, got)
+		}
+	}
+}
+
+func TestServeContentDisposition(t *testing.T) {
+	tests := []struct {
+		contentType string
+		download    bool
+		want        string
+	}{
+		{"image/png", false, "inline"},
+		{"image/png", true, "attachment"},
+		{"text/plain", false, "inline"},
+		{"text/html", false, "attachment"},
+		{"text/html; charset=utf-8", false, "attachment"},
+		{"application/xhtml+xml", false, "attachment"},
+		{"image/svg+xml", false, "attachment"},
+		{"text/xml", false, "attachment"},
+		{"application/xml", false, "attachment"},
+	}
+	for _, tt := range tests {
+		target := "/"
+		if tt.download {
+			target += "?download=true"
+		}
+		resp, err := contentApp(t, tt.contentType).Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(got, tt.want+";") {
+			t.Errorf("%s (download %v): Content-Disposition %q, want %s", tt.contentType, tt.download, got, tt.want)
+		}
+		if got := resp.Header.Get("Content-Security-Policy"); got != "sandbox; default-src 'none'" {
+			t.Errorf("%s: Content-Security-Policy %q", tt.contentType, got)
+		}
+	}
+}
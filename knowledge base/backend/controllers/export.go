@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/export"
+	"knowledge_base_backend/filetype"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/render"
+	"knowledge_base_backend/store"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExportNote sends a note as a document to download, in the format given by
+// ?format=: one of the formats SaveFile writes by extension
+func (nc *NoteController) ExportNote(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	format, ok := export.Lookup(c.Query("format"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be one of " + strings.Join(export.Names(), ", "),
+		})
+	}
+	note, err := nc.notes.Get(c.UserContext(), objID)
+	if err != nil {
+		return noteLookupError(c, err)
+	}
+
+	src, err := nc.exportSource(c.UserContext(), note)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render note",
+		})
+	}
+	// Render it all before answering, so a failure can still be reported
+	var buf bytes.Buffer
+	if err := format.Write(&buf, src); err != nil {
+		fmt.Printf("Warning - failed to export note %s as %s: %s\n", note.ID.Hex(), format.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export note",
+		})
+	}
+
+	return sendDownload(c, &buf, export.FileName(note.Title, format.Extension), format.MIMEType)
+}
+
+// ExportNotebook sends the notes of a notebook as an EPUB book with a
+// chapter for each, taking in the notebooks below it with ?recursive=true
+func (nc *NoteController) ExportNotebook(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	if !strings.EqualFold(c.Query("format", "epub"), "epub") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be epub",
+		})
+	}
+	notebook, err := nc.notebooks.Get(c.UserContext(), objID)
+	if err != nil {
+		return notebookLookupError(c, err)
+	}
+	ids := []primitive.ObjectID{objID}
+	if c.QueryBool("recursive") {
+		all, err := nc.notebooks.List(c.UserContext())
+		if err != nil {
+			return notebookLookupError(c, err)
+		}
+		ids = notebookSubtree(all, objID)
+	}
+
+	notes, err := nc.notes.Find(c.UserContext(), query.Notebook{IDs: ids})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notes",
+		})
+	}
+	return nc.sendBook(c, export.Book{
+		ID:    "urn:knowledge-base:notebook:" + objID.Hex(),
+		Title: notebook.Name,
+	}, notes)
+}
+
+// ExportTag sends the notes carrying a tag, or a tag below it, as an EPUB
+// book with a chapter for each
+func (nc *NoteController) ExportTag(c *fiber.Ctx) error {
+	tag, ok := tagParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tag",
+		})
+	}
+	if !strings.EqualFold(c.Query("format", "epub"), "epub") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be epub",
+		})
+	}
+
+	notes, err := nc.notes.Find(c.UserContext(), query.Tag{Value: tag})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notes",
+		})
+	}
+	return nc.sendBook(c, export.Book{
+		ID:    "urn:knowledge-base:tag:" + url.PathEscape(tag),
+		Title: tag,
+	}, notes)
+}
+
+// sendBook sends the notes, in the order given, as the chapters of an EPUB
+// book
+func (nc *NoteController) sendBook(c *fiber.Ctx, book export.Book, notes []models.Note) error {
+	if len(notes) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No notes to export",
+		})
+	}
+	for _, note := range notes {
+		src, err := nc.exportSource(c.UserContext(), note)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to render note",
+			})
+		}
+		book.Chapters = append(book.Chapters, src)
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteEPUB(&buf, book); err != nil {
+		fmt.Printf("Warning - failed to export %s as epub: %s\n", book.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export notes",
+		})
+	}
+	format, _ := export.Lookup("epub")
+	return sendDownload(c, &buf, export.FileName(book.Title, format.Extension), format.MIMEType)
+}
+
+// sendDownload sends a rendered document as a file to save under fileName
+func sendDownload(c *fiber.Ctx, buf *bytes.Buffer, fileName, mimeType string) error {
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{
+		"filename": fileName,
+	}))
+	c.Set(fiber.HeaderContentType, mimeType)
+	return c.SendStream(buf, buf.Len())
+}
+
+// maxExportImage caps the size of an imported image embedded in an export
+const maxExportImage = 32 << 20
+
+// exportSource renders a note for the export formats
+func (nc *NoteController) exportSource(ctx context.Context, note models.Note) (export.Source, error) {
+	resolve := nc.resolver(ctx)
+	doc, err := renderNote(note, resolve)
+	if err != nil {
+		return export.Source{}, err
+	}
+	src := export.Source{
+		Note:     note,
+		Document: doc,
+		Images:   importImages{ctx: ctx, imports: nc.imports, blobs: nc.blobs},
+		Fonts:    nc.exports.PDFFonts,
+	}
+	if note.Format == models.FormatMarkdown {
+		tree := render.Parse(note.Content, resolve)
+		src.Tree = &tree
+	}
+	return src, nil
+}
+
+// importImages reads the image imports a note shows for the export formats
+type importImages struct {
+	ctx     context.Context
+	imports store.ImportStore
+	blobs   blob.Store
+}
+
+func (l importImages) Image(id string) ([]byte, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	imp, err := l.imports.Get(l.ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	if imp.FileType != string(filetype.Image) {
+		return nil, fmt.Errorf("import %s is not an image", id)
+	}
+	if imp.Size > maxExportImage {
+		return nil, fmt.Errorf("import %s is too large to embed", id)
+	}
+	content, err := l.blobs.Open(l.ctx, imp.BlobID)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(io.LimitReader(content, maxExportImage))
+}
+
+// exportError answers a failed write to the export directory, logging it
+// the way SaveFile logs its errors
+func exportError(c *fiber.Ctx, err error, msg string) error {
+	statusCode := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, export.ErrUnsafePath):
+		statusCode, msg = fiber.StatusBadRequest, "File path must stay inside the export directory"
+	case errors.Is(err, export.ErrExists):
+		statusCode, msg = fiber.StatusConflict, "File already exists"
+	}
+	fmt.Printf("Status %d: Error - %s: %s\n", statusCode, msg, err) // Log the error with status code
+	return c.Status(statusCode).JSON(fiber.Map{
+		"error": msg,
+	})
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"bytes"
+	"knowledge_base_backend/graph"
+	"knowledge_base_backend/store"
+	"slices"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxGraphDepth bounds how far a neighbourhood reaches from its note
+const maxGraphDepth = 5
+
+// GraphController serves the graph of how notes connect
+type GraphController struct {
+	notes store.NoteStore
+	links store.LinkStore
+}
+
+// NewGraphController returns a GraphController reading the given stores
+func NewGraphController(notes store.NoteStore, links store.LinkStore) *GraphController {
+	return &GraphController{notes: notes, links: links}
+}
+
+// GetGraph returns the notes as nodes, connected by the tags they share and
+// the links between them. Tags on more than graph.MaxTagNotes notes connect
+// none of them and are listed as truncated_tags. edges=tag or edges=link
+// keeps one kind of edge.
+// With note=<id> only the notes within depth (1 by default) edges of that
+// note are included. format picks json (the default), graphml or dot.
+func (gc *GraphController) GetGraph(c *fiber.Ctx) error {
+	format := c.Query("format", "json")
+	if format != "json" && format != "graphml" && format != "dot" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be json, graphml or dot",
+		})
+	}
+	kinds := []graph.Kind{graph.SharedTag, graph.Reference}
+	if names := listParam(c, "edges"); len(names) > 0 {
+		kinds = kinds[:0]
+		for _, name := range names {
+			kind := graph.Kind(name)
+			if kind != graph.SharedTag && kind != graph.Reference {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "edges must be tag, link or both",
+				})
+			}
+			if !slices.Contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+
+	var center primitive.ObjectID
+	depth := 1
+	if id := c.Query("note"); id != "" {
+		var err error
+		if center, err = primitive.ObjectIDFromHex(id); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		if _, err := gc.notes.Get(c.UserContext(), center); err != nil {
+			return noteLookupError(c, err)
+		}
+		if d := c.Query("depth"); d != "" {
+			depth, err = strconv.Atoi(d)
+			if err != nil || depth < 1 || depth > maxGraphDepth {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "depth must be between 1 and " + strconv.Itoa(maxGraphDepth),
+				})
+			}
+		}
+	}
+
+	notes, err := gc.notes.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notes",
+		})
+	}
+	links, err := gc.links.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve links",
+		})
+	}
+	g := graph.Build(notes, links, kinds)
+	if !center.IsZero() {
+		g = g.Neighbourhood(center, depth)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "graphml":
+		c.Set(fiber.HeaderContentType, "application/graphml+xml; charset=utf-8")
+		err = graph.WriteGraphML(&buf, g)
+	case "dot":
+		c.Set(fiber.HeaderContentType, "text/vnd.graphviz; charset=utf-8")
+		err = graph.WriteDOT(&buf, g)
+	default:
+		return c.JSON(g)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to encode graph",
+		})
+	}
+	return c.Send(buf.Bytes())
+}
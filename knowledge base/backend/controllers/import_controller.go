@@ -3,105 +3,145 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/export"
+	"knowledge_base_backend/filetype"
+	"knowledge_base_backend/media"
 	"knowledge_base_backend/models"
-	"os"
+	"knowledge_base_backend/store"
+	"knowledge_base_backend/tags"
+	"knowledge_base_backend/thumbnail"
+	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var importCollection *mongo.Collection
+// ImportSettings configures how imports are accepted, processed and exported
+type ImportSettings struct {
+	Exports        *export.Root    // where ExportImport writes
+	Types          filetype.Policy // file types accepted by UploadFile
+	ThumbnailSizes []int           // bounding boxes of the thumbnails made for images
+	UploadLimit    int64           // largest request body UploadFile reads
+}
 
-// Initialize the MongoDB collection for imports
-func init() {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		panic(err)
-	}
-	err = client.Ping(context.Background(), nil)
-	if err != nil {
-		panic(err)
-	}
-	importCollection = client.Database("knowledgebase").Collection("imports")
+// ImportController serves the import endpoints from an ImportStore
+type ImportController struct {
+	imports  store.ImportStore
+	blobs    blob.Store
+	settings ImportSettings
+}
+
+// NewImportController returns an ImportController that keeps metadata in
+// imports and file content in blobs
+func NewImportController(imports store.ImportStore, blobs blob.Store, settings ImportSettings) *ImportController {
+	return &ImportController{imports: imports, blobs: blobs, settings: settings}
 }
 
 // UploadFile handles file upload and saving to the database
-func UploadFile(c *fiber.Ctx) error {
-	// Retrieve the uploaded file
-	file, err := c.FormFile("file")
+func (ic *ImportController) UploadFile(c *fiber.Ctx) error {
+	// Receive the uploaded file and its metadata from the request stream
+	up, err := readUpload(c, ic.settings.UploadLimit)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		var pathErr *fs.PathError
+		switch {
+		case errors.As(err, &tooLarge):
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "File exceeds the upload limit",
+			})
+		case errors.As(err, &pathErr):
+			fmt.Printf("Warning - Failed to spool upload: %s\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to open uploaded file",
+			})
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "File upload failed",
 		})
 	}
+	defer up.remove()
+	fileContent := up.file
 
-	// Open the uploaded file
-	fileContent, err := file.Open()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to open uploaded file",
+	// Retrieve file metadata from request form
+	importTags := tags.Split(up.tags)
+	location := up.location
+	filename := up.name
+
+	// Determine file type from the content, falling back to the extension
+	detected := filetype.Detect(fileContent, up.size, filename)
+	if !ic.settings.Types.Permits(detected) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": fmt.Sprintf("File type %s is not allowed", detected.MIME),
 		})
 	}
-	defer fileContent.Close()
 
-	// Read the file content into a buffer
-	var buffer bytes.Buffer
-	_, err = io.Copy(&buffer, fileContent)
-	if err != nil {
+	// Read the real dimensions, duration and codecs from the file itself
+	mediaInfo, err := media.Probe(fileContent)
+	if err != nil && err != media.ErrUnknownFormat {
+		fmt.Printf("Warning - Failed to read media metadata of %s: %s\n", filename, err)
+	}
+	if _, err := fileContent.Seek(0, io.SeekStart); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to read uploaded file",
 		})
 	}
 
-	// Retrieve file metadata from request form
-	tags := c.FormValue("tags", "")
-	location := c.FormValue("location", "")
-	filename := file.Filename
-
-	// Determine file type
-	ext := filepath.Ext(filename)
-	fileType := "unknown"
-	if ext == ".jpg" || ext == ".png" || ext == ".gif" {
-		fileType = "image"
-	} else if ext == ".mp4" || ext == ".avi" {
-		fileType = "video"
-	}
-
-	// Set file properties accordingly
-	var resolution *string
-	var duration *string
-	if fileType == "image" {
-		res := "1920x1080" // Example resolution
-		resolution = &res
-	} else if fileType == "video" {
-		dur := "3:00" // Example duration
-		duration = &dur
+	// Render thumbnails so listings never need the full-size image
+	var thumbnails []models.Thumbnail
+	var thumbnailError string
+	if detected.Kind == filetype.Image {
+		thumbnails, err = ic.storeThumbnails(c.UserContext(), fileContent, filename)
+		if err != nil {
+			fmt.Printf("Warning - Failed to create thumbnails of %s: %s\n", filename, err)
+		}
+		if errors.Is(err, errNoThumbnails) {
+			thumbnailError = err.Error()
+		}
+		if _, err := fileContent.Seek(0, io.SeekStart); err != nil {
+			ic.deleteThumbnails(c.UserContext(), thumbnails)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to read uploaded file",
+			})
+		}
+	}
+
+	// Stream the file content into the blob store
+	info, err := ic.blobs.Put(c.UserContext(), filename, fileContent)
+	if err != nil {
+		ic.deleteThumbnails(c.UserContext(), thumbnails)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store uploaded file",
+		})
 	}
 
 	// Create a new Import model instance
 	importFile := models.Import{
-		ID:         primitive.NewObjectID(),
-		FileName:   filename,
-		Location:   location,
-		Tags:       tags,
-		FileType:   fileType,
-		Data:       buffer.Bytes(),
-		Resolution: resolution,
-		Duration:   duration,
-		CreatedAt:  time.Now(),
+		ID:             primitive.NewObjectID(),
+		FileName:       filename,
+		Location:       location,
+		Tags:           importTags,
+		FileType:       string(detected.Kind),
+		MIMEType:       detected.MIME,
+		BlobID:         info.ID,
+		Size:           info.Size,
+		Media:          mediaInfo,
+		Thumbnails:     thumbnails,
+		ThumbnailError: thumbnailError,
+		CreatedAt:      time.Now(),
 	}
 
-	// Insert the new file document into MongoDB
-	_, err = importCollection.InsertOne(context.Background(), importFile)
-	if err != nil {
+	// Insert the new file document into the store
+	if err := ic.imports.Create(c.UserContext(), &importFile); err != nil {
+		ic.blobs.Delete(c.UserContext(), info.ID)
+		ic.deleteThumbnails(c.UserContext(), thumbnails)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to save file to database",
 		})
@@ -110,34 +150,49 @@ func UploadFile(c *fiber.Ctx) error {
 	// Return success response
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "File uploaded successfully",
+		"id":      importFile.ID,
 	})
 }
 
-// GetImports retrieves all imported files from the database
-func GetImports(c *fiber.Ctx) error {
-	// Find all import documents
-	cursor, err := importCollection.Find(context.Background(), bson.M{})
+// GetImports returns one page of imports. Imports can be filtered by
+// file_type (kinds or MIME types, comma separated), tag and
+// created_from/created_to, and sorted by created or name.
+func (ic *ImportController) GetImports(c *fiber.Ctx) error {
+	page, err := pageParams(c, store.ImportSorts())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve imports",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	filter := store.ImportFilter{
+		FileTypes: listParam(c, "file_type"),
+		Tag:       c.Query("tag"),
+	}
+	filter.CreatedFrom, filter.CreatedTo, err = dateParams(c, "created")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
-	defer cursor.Close(context.Background())
 
-	// Deserialize documents into Import models
-	var imports []models.Import
-	if err := cursor.All(context.Background(), &imports); err != nil {
+	// Find one page of matching import documents
+	imports, next, err := ic.imports.FindPage(c.UserContext(), filter, page)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse imports",
+			"error": "Failed to retrieve imports",
 		})
 	}
 
-	// Return the list of imports
-	return c.Status(fiber.StatusOK).JSON(imports)
+	// Return the page with the cursor of the next one
+	response := pageResponse{Items: imports}
+	if next != nil {
+		response.NextCursor = next.Encode()
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
 }
 
 // GetImport retrieves a single imported file by its ID
-func GetImport(c *fiber.Ctx) error {
+func (ic *ImportController) GetImport(c *fiber.Ctx) error {
 	// Parse ID parameter from the URL
 	idParam := c.Params("id")
 	id, err := primitive.ObjectIDFromHex(idParam)
@@ -148,9 +203,8 @@ func GetImport(c *fiber.Ctx) error {
 	}
 
 	// Find the import document by ID
-	var importFile models.Import
-	err = importCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&importFile)
-	if err == mongo.ErrNoDocuments {
+	importFile, err := ic.imports.Get(c.UserContext(), id)
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Import not found",
 		})
@@ -164,8 +218,9 @@ func GetImport(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(importFile)
 }
 
-// DeleteImport deletes an imported file by its ID
-func DeleteImport(c *fiber.Ctx) error {
+// GetImportContent streams the original bytes of an imported file, honouring
+// conditional and Range requests so media can be played and downloads resumed
+func (ic *ImportController) GetImportContent(c *fiber.Ctx) error {
 	// Parse ID parameter from the URL
 	idParam := c.Params("id")
 	id, err := primitive.ObjectIDFromHex(idParam)
@@ -175,22 +230,43 @@ func DeleteImport(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete the import document from the database
-	_, err = importCollection.DeleteOne(context.Background(), bson.M{"_id": id})
-	if err != nil {
+	// Find the import document by ID
+	importFile, err := ic.imports.Get(c.UserContext(), id)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Import not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete import",
+			"error": "Failed to retrieve import",
 		})
 	}
 
-	// Return success response
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Import deleted successfully",
+	// Open the file content; the response closes it once streamed
+	object, err := ic.blobs.Open(c.UserContext(), importFile.BlobID)
+	if err == blob.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Import content not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to open import content",
+		})
+	}
+
+	return serveContent(c, content{
+		object:      object,
+		fileName:    importFile.FileName,
+		contentType: importContentType(importFile),
+		etag:        `"` + importFile.BlobID + `"`,
+		modTime:     importFile.CreatedAt,
+		attachment:  c.QueryBool("download"),
 	})
 }
 
-// ExportImport handles exporting an imported file by its ID
-func ExportImport(c *fiber.Ctx) error {
+// GetImportThumbnail serves the smallest thumbnail at least as large as the
+// requested size, generating missing thumbnails for older image imports once
+func (ic *ImportController) GetImportThumbnail(c *fiber.Ctx) error {
 	// Parse ID parameter from the URL
 	idParam := c.Params("id")
 	id, err := primitive.ObjectIDFromHex(idParam)
@@ -199,11 +275,16 @@ func ExportImport(c *fiber.Ctx) error {
 			"error": "Invalid ID format",
 		})
 	}
+	size := c.QueryInt("size", 0)
+	if size < 0 || (size == 0 && c.Query("size") != "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Size must be a positive number of pixels",
+		})
+	}
 
 	// Find the import document by ID
-	var importFile models.Import
-	err = importCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&importFile)
-	if err == mongo.ErrNoDocuments {
+	importFile, err := ic.imports.Get(c.UserContext(), id)
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Import not found",
 		})
@@ -213,25 +294,240 @@ func ExportImport(c *fiber.Ctx) error {
 		})
 	}
 
-	// Define the file path for exporting
-	filePath := fmt.Sprintf("./exports/%s", importFile.FileName)
+	// Backfill thumbnails for images uploaded before they were generated
+	if len(importFile.Thumbnails) == 0 && importFile.ThumbnailError == "" &&
+		importFile.FileType == string(filetype.Image) && len(ic.settings.ThumbnailSizes) > 0 {
+		if err := ic.backfillThumbnails(c.UserContext(), &importFile); err != nil {
+			fmt.Printf("Warning - Failed to create thumbnails of %s: %s\n", importFile.FileName, err)
+		}
+	}
+	if len(importFile.Thumbnails) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No thumbnail available for this import",
+		})
+	}
 
-	// Create the export directory if it doesn't exist
-	if err := os.MkdirAll("./exports", os.ModePerm); err != nil {
+	thumb := pickThumbnail(importFile.Thumbnails, size)
+	object, err := ic.blobs.Open(c.UserContext(), thumb.BlobID)
+	if err == blob.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Thumbnail content not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create export directory",
+			"error": "Failed to open thumbnail",
 		})
 	}
 
-	// Write the file data to the specified path
-	if err := os.WriteFile(filePath, importFile.Data, 0644); err != nil {
+	name := strings.TrimSuffix(importFile.FileName, filepath.Ext(importFile.FileName))
+	ext := ".jpg"
+	if thumb.MIME == "image/png" {
+		ext = ".png"
+	}
+	return serveContent(c, content{
+		object:      object,
+		fileName:    fmt.Sprintf("%s_%d%s", name, thumb.Size, ext),
+		contentType: thumb.MIME,
+		etag:        `"` + thumb.BlobID + `"`,
+		modTime:     importFile.CreatedAt,
+	})
+}
+
+// DeleteImport deletes an imported file by its ID
+func (ic *ImportController) DeleteImport(c *fiber.Ctx) error {
+	// Parse ID parameter from the URL
+	idParam := c.Params("id")
+	id, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+
+	// Look up the import to find its blob
+	importFile, err := ic.imports.Get(c.UserContext(), id)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Import not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve import",
+		})
+	}
+
+	// Delete the import document, then its content
+	err = ic.imports.Delete(c.UserContext(), id)
+	if err != nil && err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete import",
+		})
+	}
+	if err := ic.blobs.Delete(c.UserContext(), importFile.BlobID); err != nil && err != blob.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete import content",
+		})
+	}
+	ic.deleteThumbnails(c.UserContext(), importFile.Thumbnails)
+
+	// Return success response
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Import deleted successfully",
+	})
+}
+
+// ExportImport handles exporting an imported file by its ID. on_conflict
+// says what to do when its name is taken: fail (the default), overwrite or
+// rename.
+func (ic *ImportController) ExportImport(c *fiber.Ctx) error {
+	// Parse ID parameter from the URL
+	idParam := c.Params("id")
+	id, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	policy, err := export.ParsePolicy(c.Query("on_conflict"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid on_conflict: " + err.Error(),
+		})
+	}
+
+	// Find the import document by ID
+	importFile, err := ic.imports.Get(c.UserContext(), id)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Import not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to export file",
+			"error": "Failed to retrieve import",
 		})
 	}
 
+	// Stream the file content from the blob store into the export directory
+	written, err := ic.settings.Exports.Write(filepath.Base(importFile.FileName), policy, func(w io.Writer) error {
+		return ic.exportBlob(c.UserContext(), importFile.BlobID, w)
+	})
+	if err != nil {
+		return exportError(c, err, "Failed to export file")
+	}
+
 	// Return success response
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "File exported successfully",
+		"path":    written,
 	})
 }
+
+// exportBlob copies the content of a blob to w
+func (ic *ImportController) exportBlob(ctx context.Context, blobID string, w io.Writer) error {
+	content, err := ic.blobs.Open(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// importContentType prefers the sniffed MIME type recorded at upload time
+func importContentType(importFile models.Import) string {
+	if importFile.MIMEType != "" {
+		return importFile.MIMEType
+	}
+	return contentTypeFor(importFile.FileName)
+}
+
+// errNoThumbnails wraps the errors of images that thumbnails cannot be made
+// of, as opposed to failures storing them
+var errNoThumbnails = errors.New("cannot make thumbnails")
+
+// storeThumbnails renders the configured thumbnail sizes of an image and stores each as a blob
+func (ic *ImportController) storeThumbnails(ctx context.Context, r io.ReadSeeker, fileName string) ([]models.Thumbnail, error) {
+	if len(ic.settings.ThumbnailSizes) == 0 {
+		return nil, nil
+	}
+	rendered, err := thumbnail.Generate(r, ic.settings.ThumbnailSizes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoThumbnails, err)
+	}
+
+	thumbnails := make([]models.Thumbnail, 0, len(rendered))
+	for _, t := range rendered {
+		info, err := ic.blobs.Put(ctx, fmt.Sprintf("%s.thumb%d", fileName, t.Size), bytes.NewReader(t.Data))
+		if err != nil {
+			ic.deleteThumbnails(ctx, thumbnails)
+			return nil, err
+		}
+		thumbnails = append(thumbnails, models.Thumbnail{
+			Size:   t.Size,
+			Width:  t.Width,
+			Height: t.Height,
+			MIME:   t.MIME,
+			BlobID: info.ID,
+		})
+	}
+	return thumbnails, nil
+}
+
+// backfillThumbnails generates thumbnails from the stored content and saves
+// them on the import, or records why they cannot be made. When a concurrent
+// request saved its thumbnails first, those are used instead.
+func (ic *ImportController) backfillThumbnails(ctx context.Context, importFile *models.Import) error {
+	object, err := ic.blobs.Open(ctx, importFile.BlobID)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	thumbnails, renderErr := ic.storeThumbnails(ctx, object, importFile.FileName)
+	var failure string
+	if errors.Is(renderErr, errNoThumbnails) {
+		failure = renderErr.Error()
+	} else if renderErr != nil {
+		return renderErr
+	}
+	set, err := ic.imports.SetThumbnails(ctx, importFile.ID, thumbnails, failure)
+	if err != nil || !set {
+		ic.deleteThumbnails(ctx, thumbnails)
+	}
+	if err != nil {
+		return err
+	}
+	if !set {
+		current, err := ic.imports.Get(ctx, importFile.ID)
+		if err != nil {
+			return err
+		}
+		*importFile = current
+		return nil
+	}
+	importFile.Thumbnails, importFile.ThumbnailError = thumbnails, failure
+	return renderErr
+}
+
+// deleteThumbnails removes thumbnail blobs, ignoring ones already gone
+func (ic *ImportController) deleteThumbnails(ctx context.Context, thumbnails []models.Thumbnail) {
+	for _, t := range thumbnails {
+		ic.blobs.Delete(ctx, t.BlobID)
+	}
+}
+
+// pickThumbnail returns the smallest thumbnail covering size, or the largest
+// one if none does. A size of zero selects the smallest thumbnail.
+func pickThumbnail(thumbnails []models.Thumbnail, size int) models.Thumbnail {
+	best := thumbnails[0]
+	for _, t := range thumbnails[1:] {
+		switch {
+		case best.Size < size && t.Size > best.Size:
+			best = t
+		case t.Size >= size && t.Size < best.Size:
+			best = t
+		}
+	}
+	return best
+}
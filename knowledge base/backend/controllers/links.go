@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"knowledge_base_backend/links"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/search"
+	"knowledge_base_backend/store"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// linkContextBytes is how much text GetBacklinks shows on each side of a link
+const linkContextBytes = 60
+
+// linker keeps the stored links in step with note writes. Like revisions,
+// links are secondary to the write that already succeeded, so failures are
+// logged rather than returned.
+type linker struct {
+	notes     store.NoteStore
+	links     store.LinkStore
+	revisions store.RevisionStore
+	index     *search.Index
+}
+
+// resolver finds the note a link points at: the note with that ID, or else
+// the first note stored with that title
+func (l *linker) resolver(ctx context.Context) func(links.Ref) *primitive.ObjectID {
+	found := make(map[string]*primitive.ObjectID)
+	return func(ref links.Ref) *primitive.ObjectID {
+		key := links.Key(ref.Target)
+		if id, ok := found[key]; ok {
+			return id
+		}
+		var target *primitive.ObjectID
+		if id, ok := links.ID(ref.Target); ok {
+			if _, err := l.notes.Get(ctx, id); err == nil {
+				target = &id
+			}
+		}
+		if target == nil {
+			if notes, err := l.notes.Find(ctx, query.TitleIs{Value: ref.Target}); err == nil && len(notes) > 0 {
+				target = &notes[0].ID
+			}
+		}
+		found[key] = target
+		return target
+	}
+}
+
+// sync records the links written in a note that was just stored and points
+// broken links naming it at it. When the note was renamed from oldTitle, the
+// notes linking to it by that title are rewritten to use the new one.
+func (l *linker) sync(ctx context.Context, note models.Note, oldTitle, author string) {
+	edges := links.Edges(note.Content, l.resolver(ctx))
+	if err := l.links.Replace(ctx, note.ID, edges); err != nil {
+		fmt.Printf("Warning - failed to record links of note %s: %s\n", note.ID.Hex(), err)
+	}
+	for _, key := range []string{links.Key(note.Title), links.Key(note.ID.Hex())} {
+		if err := l.links.Resolve(ctx, key, note.ID); err != nil {
+			fmt.Printf("Warning - failed to resolve links to note %s: %s\n", note.ID.Hex(), err)
+		}
+	}
+	if oldTitle != "" && links.Key(oldTitle) != links.Key(note.Title) {
+		l.retarget(ctx, note, links.Key(oldTitle), author)
+	}
+}
+
+// retarget rewrites the links to a renamed note that still use its old title
+func (l *linker) retarget(ctx context.Context, note models.Note, oldKey, author string) {
+	backlinks, err := l.links.To(ctx, note.ID)
+	if err != nil {
+		fmt.Printf("Warning - failed to find links to note %s: %s\n", note.ID.Hex(), err)
+		return
+	}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, link := range backlinks {
+		if link.Key != oldKey || link.SourceID == note.ID || seen[link.SourceID] {
+			continue
+		}
+		seen[link.SourceID] = true
+
+		source, err := l.notes.Get(ctx, link.SourceID)
+		if err != nil {
+			continue
+		}
+		content := links.Rewrite(source.Content, func(ref links.Ref) (string, bool) {
+			return note.Title, links.Key(ref.Target) == oldKey
+		})
+		if content == source.Content {
+			continue
+		}
+
+		saveBaseline(ctx, l.revisions, source)
+		source.Content = content
+		source.UpdatedAt = time.Now().UTC()
+		if err := l.notes.Update(ctx, &source, source.Version); err != nil {
+			fmt.Printf("Warning - failed to update links in note %s: %s\n", source.ID.Hex(), err)
+			continue
+		}
+		l.index.Add(source)
+		rev := models.NewRevision(source, author)
+		if err := l.revisions.Create(ctx, &rev); err != nil {
+			fmt.Printf("Warning - failed to record revision of note %s: %s\n", source.ID.Hex(), err)
+		}
+		l.sync(ctx, source, "", author)
+	}
+}
+
+// remove drops the links written in a deleted note and breaks those to it
+func (l *linker) remove(ctx context.Context, id primitive.ObjectID) {
+	if err := l.links.Replace(ctx, id, nil); err != nil {
+		fmt.Printf("Warning - failed to delete links of note %s: %s\n", id.Hex(), err)
+	}
+	if err := l.links.Unlink(ctx, id); err != nil {
+		fmt.Printf("Warning - failed to break links to note %s: %s\n", id.Hex(), err)
+	}
+}
+
+// outgoingLink is a link written in a note, with the title of its target
+type outgoingLink struct {
+	models.Link
+	Title  string `json:"title,omitempty"`
+	Broken bool   `json:"broken"`
+}
+
+// incomingLink is a link to a note, with the text around it in its source
+type incomingLink struct {
+	models.Link
+	SourceTitle string `json:"source_title"`
+	Context     string `json:"context"`
+}
+
+// GetLinks returns the links written in a note in the order they appear,
+// marking those that match no note as broken
+func (nc *NoteController) GetLinks(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	if _, err := nc.notes.Get(c.UserContext(), objID); err != nil {
+		return noteLookupError(c, err)
+	}
+
+	stored, err := nc.links.links.From(c.UserContext(), objID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve links",
+		})
+	}
+	titles := make(map[primitive.ObjectID]string)
+	result := make([]outgoingLink, 0, len(stored))
+	for _, link := range stored {
+		out := outgoingLink{Link: link, Broken: link.TargetID == nil}
+		if link.TargetID != nil {
+			title, ok := titles[*link.TargetID]
+			if !ok {
+				if target, err := nc.notes.Get(c.UserContext(), *link.TargetID); err == nil {
+					title = target.Title
+				}
+				titles[*link.TargetID] = title
+			}
+			out.Title = title
+		}
+		result = append(result, out)
+	}
+	return c.JSON(result)
+}
+
+// GetBacklinks returns the links pointing at a note, each with the text
+// around it
+func (nc *NoteController) GetBacklinks(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	if _, err := nc.notes.Get(c.UserContext(), objID); err != nil {
+		return noteLookupError(c, err)
+	}
+
+	stored, err := nc.links.links.To(c.UserContext(), objID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve links",
+		})
+	}
+	return c.JSON(nc.withSources(c, stored))
+}
+
+// GetBrokenLinks returns every link whose target matches no note
+func (nc *NoteController) GetBrokenLinks(c *fiber.Ctx) error {
+	stored, err := nc.links.links.Broken(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve links",
+		})
+	}
+	return c.JSON(nc.withSources(c, stored))
+}
+
+// withSources adds the title of each link's source note and the text around
+// the link in it
+func (nc *NoteController) withSources(c *fiber.Ctx, stored []models.Link) []incomingLink {
+	sources := make(map[primitive.ObjectID]models.Note)
+	result := make([]incomingLink, 0, len(stored))
+	for _, link := range stored {
+		source, ok := sources[link.SourceID]
+		if !ok {
+			var err error
+			if source, err = nc.notes.Get(c.UserContext(), link.SourceID); err != nil {
+				continue
+			}
+			sources[link.SourceID] = source
+		}
+		result = append(result, incomingLink{
+			Link:        link,
+			SourceTitle: source.Title,
+			Context:     linkContext(source.Content, link.Position),
+		})
+	}
+	return result
+}
+
+// linkContext cuts the link starting at pos and the text around it from
+// content, on rune boundaries
+func linkContext(content string, pos int) string {
+	if pos < 0 || pos > len(content) {
+		return ""
+	}
+	start := max(pos-linkContextBytes, 0)
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	linkEnd := pos
+	if i := strings.Index(content[pos:], "]]"); i >= 0 {
+		linkEnd = pos + i + 2
+	}
+	end := min(linkEnd+linkContextBytes, len(content))
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	return content[start:end]
+}
@@ -1,57 +1,130 @@
 package controllers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"io"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/export"
 	"knowledge_base_backend/models"
-	"os"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/search"
+	"knowledge_base_backend/store"
+	"knowledge_base_backend/tags"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jung-kurt/gofpdf"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var collection *mongo.Collection
+// ExportSettings configures where notes are exported and how bundles of them
+// are built
+type ExportSettings struct {
+	Root            *export.Root  // where SaveFile writes
+	Jobs            *export.Jobs  // running the bundles built in the background
+	BackgroundNotes int           // bundles of more notes than this are built in the background
+	PDFFonts        *export.Fonts // nil for the Go fonts
+}
 
-// Initialize the MongoDB collection
-func init() {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		panic(err)
+// NoteController serves the note endpoints from a NoteStore
+type NoteController struct {
+	notes     store.NoteStore
+	notebooks store.NotebookStore
+	revisions store.RevisionStore
+	imports   store.ImportStore
+	blobs     blob.Store
+	exports   ExportSettings
+	links     *linker
+	index     *search.Index
+}
+
+// NewNoteController returns a NoteController backed by the given stores that
+// records a revision and the links of every write and keeps index in step
+// with it. Imports are looked up for the links notes make to them and read
+// from blobs for the images exports embed and the bundles they go into.
+func NewNoteController(notes store.NoteStore, notebooks store.NotebookStore, revisions store.RevisionStore, links store.LinkStore, imports store.ImportStore, blobs blob.Store, exports ExportSettings, index *search.Index) *NoteController {
+	return &NoteController{
+		notes:     notes,
+		notebooks: notebooks,
+		revisions: revisions,
+		imports:   imports,
+		blobs:     blobs,
+		exports:   exports,
+		links:     &linker{notes: notes, links: links, revisions: revisions, index: index},
+		index:     index,
 	}
-	err = client.Ping(context.Background(), nil)
+}
+
+// GetNotes returns one page of notes. Notes can be filtered by tag (comma
+// separated, all required), created_from/created_to, updated_from/updated_to,
+// notebook (an ID, with recursive=true for the notebooks inside it too, or
+// "none") and a search query q, and sorted by created, updated or title.
+// Content is left out unless include=content.
+func (nc *NoteController) GetNotes(c *fiber.Ctx) error {
+	page, err := pageParams(c, store.NoteSorts())
 	if err != nil {
-		panic(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
-	collection = client.Database("knowledgebase").Collection("notes")
-}
+	page.Summary = c.Query("include") != "content"
 
-// GetNotes retrieves all notes from the database
-func GetNotes(c *fiber.Ctx) error {
-	var notes []models.Note
-	cursor, err := collection.Find(context.Background(), bson.M{})
+	// Combine the filters into one query for the store
+	var filters []query.Node
+	if q := c.Query("q"); q != "" {
+		parsed, err := query.Parse(q)
+		if err != nil {
+			return queryError(c, err)
+		}
+		filters = append(filters, query.Resolve(parsed, nc.index))
+	}
+	for _, tag := range listParam(c, "tag") {
+		filters = append(filters, query.Tag{Value: tag})
+	}
+	if notebook := c.Query("notebook"); notebook != "" {
+		filter, err := nc.notebookFilter(c, notebook)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		filters = append(filters, filter)
+	}
+	for _, field := range []query.Field{query.Created, query.Updated} {
+		from, to, err := dateParams(c, string(field))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if !from.IsZero() || !to.IsZero() {
+			filters = append(filters, query.DateRange{Field: field, From: from, To: to})
+		}
+	}
+	var filter query.Node
+	if len(filters) > 0 {
+		filter = query.And{Nodes: filters}
+	}
+
+	notes, next, err := nc.notes.FindPage(c.UserContext(), filter, page)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve notes",
 		})
 	}
-	defer cursor.Close(context.Background())
-	if err := cursor.All(context.Background(), &notes); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse notes",
-		})
+	response := pageResponse{Items: notes}
+	if next != nil {
+		response.NextCursor = next.Encode()
 	}
-	return c.JSON(notes)
+	return c.JSON(response)
 }
 
 // GetNote retrieves a single note by its ID
-func GetNote(c *fiber.Ctx) error {
+func (nc *NoteController) GetNote(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Convert id string to MongoDB ObjectId
@@ -62,10 +135,9 @@ func GetNote(c *fiber.Ctx) error {
 		})
 	}
 
-	var note models.Note
-	err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&note)
+	note, err := nc.notes.Get(c.UserContext(), objID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == store.ErrNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Note not found",
 			})
@@ -74,17 +146,34 @@ func GetNote(c *fiber.Ctx) error {
 			"error": "Failed to retrieve note",
 		})
 	}
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
 	return c.JSON(note)
 }
 
+// formatError answers a note written in a format notes cannot have
+const formatError = "Format must be " + models.FormatPlain + " or " + models.FormatMarkdown
+
+// noteInput holds the fields clients may set when writing a note
+type noteInput struct {
+	Title      string              `json:"title"`
+	Content    string              `json:"content"`
+	Format     string              `json:"format"` // plain unless given; PUT keeps the current format
+	Tags       []string            `json:"tags"`
+	NotebookID *primitive.ObjectID `json:"notebook_id"` // PUT keeps the current notebook when left out
+}
+
 // CreateNote adds a new note to the database
-func CreateNote(c *fiber.Ctx) error {
-	var note models.Note
-	if err := c.BodyParser(&note); err != nil {
+func (nc *NoteController) CreateNote(c *fiber.Ctx) error {
+	var input noteInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid input",
 		})
 	}
+	note := models.Note{Title: input.Title, Content: input.Content, Format: input.Format, Tags: tags.NormalizeAll(input.Tags), NotebookID: input.NotebookID}
+	if note.Format == "" {
+		note.Format = models.FormatPlain
+	}
 
 	// Validation
 	if note.Title == "" {
@@ -102,28 +191,36 @@ func CreateNote(c *fiber.Ctx) error {
 			"error": "Title cannot exceed 100 characters",
 		})
 	}
-
-	// Default timestamps
-	if note.CreatedAt == "" {
-		note.CreatedAt = time.Now().Format(time.RFC3339)
+	if !models.IsFormat(note.Format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": formatError,
+		})
 	}
-	if note.FormattedDate == "" {
-		note.FormattedDate = time.Now().Format("January 2, 2006")
+
+	if msg := nc.checkNotebook(c, note.NotebookID); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
 	}
 
-	_, err := collection.InsertOne(context.Background(), note)
-	if err != nil {
+	note.CreatedAt = time.Now().UTC()
+	note.UpdatedAt = note.CreatedAt
+
+	if err := nc.notes.Create(c.UserContext(), &note); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create note",
 		})
 	}
+	nc.index.Add(note)
+	nc.recordRevision(c, note)
+	nc.links.sync(c.UserContext(), note, "", c.Get(authorHeader))
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Note created successfully",
 	})
 }
 
 // UpdateNote modifies an existing note identified by its ID
-func UpdateNote(c *fiber.Ctx) error {
+func (nc *NoteController) UpdateNote(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Convert id string to MongoDB ObjectId
@@ -134,12 +231,13 @@ func UpdateNote(c *fiber.Ctx) error {
 		})
 	}
 
-	var updateData models.Note
-	if err := c.BodyParser(&updateData); err != nil {
+	var input noteInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid input",
 		})
 	}
+	updateData := models.Note{Title: input.Title, Content: input.Content, Format: input.Format, Tags: tags.NormalizeAll(input.Tags), NotebookID: input.NotebookID}
 
 	// Validation
 	if updateData.Title == "" {
@@ -157,35 +255,61 @@ func UpdateNote(c *fiber.Ctx) error {
 			"error": "Title cannot exceed 100 characters",
 		})
 	}
+	if updateData.Format != "" && !models.IsFormat(updateData.Format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": formatError,
+		})
+	}
 
-	filter := bson.M{"_id": objID}
-	update := bson.M{
-		"$set": bson.M{
-			"title":          updateData.Title,
-			"content":        updateData.Content,
-			"tags":           updateData.Tags,
-			"created_at":     updateData.CreatedAt,
-			"formatted_date": time.Now().Format("January 2, 2006"),
-		},
+	// Only write over the version the client last read, if it says which
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return nc.versionConflict(c, objID)
 	}
-	result, err := collection.UpdateOne(context.Background(), filter, update)
+
+	current, err := nc.notes.Get(c.UserContext(), objID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update note",
+		return noteLookupError(c, err)
+	}
+	if updateData.Format == "" {
+		updateData.Format = current.Format
+	}
+	if updateData.NotebookID == nil {
+		updateData.NotebookID = current.NotebookID
+	} else if msg := nc.checkNotebook(c, updateData.NotebookID); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
 		})
 	}
-	if result.MatchedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Note not found",
+
+	updateData.ID = objID
+	updateData.UpdatedAt = time.Now().UTC()
+	nc.recordBaseline(c, objID)
+	if err := nc.notes.Update(c.UserContext(), &updateData, ifVersion); err != nil {
+		if err == store.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Note not found",
+			})
+		}
+		if err == store.ErrVersionConflict {
+			return nc.versionConflict(c, objID)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update note",
 		})
 	}
+	nc.index.Add(updateData)
+	nc.recordRevision(c, updateData)
+	nc.links.sync(c.UserContext(), updateData, current.Title, c.Get(authorHeader))
+	c.Set(fiber.HeaderETag, noteETag(updateData.Version))
 	return c.JSON(fiber.Map{
 		"message": "Note updated successfully",
+		"version": updateData.Version,
 	})
 }
 
 // DeleteNote removes a note from the database
-func DeleteNote(c *fiber.Ctx) error {
+func (nc *NoteController) DeleteNote(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Convert id string to MongoDB ObjectId
@@ -196,28 +320,191 @@ func DeleteNote(c *fiber.Ctx) error {
 		})
 	}
 
-	filter := bson.M{"_id": objID}
-	result, err := collection.DeleteOne(context.Background(), filter)
-	if err != nil {
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return nc.versionConflict(c, objID)
+	}
+
+	if err := nc.notes.Delete(c.UserContext(), objID, ifVersion); err != nil {
+		if err == store.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Note not found",
+			})
+		}
+		if err == store.ErrVersionConflict {
+			return nc.versionConflict(c, objID)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete note",
 		})
 	}
-	if result.DeletedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Note not found",
-		})
+	nc.index.Remove(objID)
+	nc.links.remove(c.UserContext(), objID)
+	if err := nc.revisions.DeleteAll(c.UserContext(), objID); err != nil {
+		fmt.Printf("Warning - failed to delete revisions of note %s: %s\n", objID.Hex(), err)
 	}
 	return c.JSON(fiber.Map{
 		"message": "Note deleted successfully",
 	})
 }
 
-// SearchNotes retrieves notes based on the search query from the request body
-func SearchNotes(c *fiber.Ctx) error {
+// MoveNotes files the notes listed in ids in the notebook notebook_id, or in
+// no notebook when it is null. The response lists the notes that moved, even
+// when moving a later one fails.
+func (nc *NoteController) MoveNotes(c *fiber.Ctx) error {
+	var input struct {
+		IDs        []primitive.ObjectID `json:"ids"`
+		NotebookID *primitive.ObjectID  `json:"notebook_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if len(input.IDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Note IDs are required",
+		})
+	}
+	if msg := nc.checkNotebook(c, input.NotebookID); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	// Check every note exists before moving any
+	for _, id := range input.IDs {
+		if _, err := nc.notes.Get(c.UserContext(), id); err != nil {
+			if err == store.ErrNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Note " + id.Hex() + " not found",
+				})
+			}
+			return noteLookupError(c, err)
+		}
+	}
+
+	// Only the notebook is written, so edits racing the move are kept
+	moved := []primitive.ObjectID{}
+	now := time.Now().UTC()
+	for _, id := range input.IDs {
+		ok, err := nc.notes.Move(c.UserContext(), id, input.NotebookID, now)
+		if err != nil && err != store.ErrNotFound {
+			// Tell the client which notes did move before the failure
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":     "Failed to move note " + id.Hex(),
+				"moved":     len(moved),
+				"moved_ids": moved,
+			})
+		}
+		if ok {
+			moved = append(moved, id)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"message":   "Notes moved successfully",
+		"moved":     len(moved),
+		"moved_ids": moved,
+	})
+}
+
+// checkNotebook returns why a note cannot be filed in the notebook, if it
+// cannot. A nil notebook files the note in none.
+func (nc *NoteController) checkNotebook(c *fiber.Ctx, id *primitive.ObjectID) string {
+	if id == nil {
+		return ""
+	}
+	if _, err := nc.notebooks.Get(c.UserContext(), *id); err != nil {
+		if err == store.ErrNotFound {
+			return "Notebook not found"
+		}
+		return "Failed to retrieve notebook"
+	}
+	return ""
+}
+
+// notebookFilter builds the query for the notebook parameter of GetNotes
+func (nc *NoteController) notebookFilter(c *fiber.Ctx, param string) (query.Node, error) {
+	if param == "none" {
+		return query.Notebook{}, nil
+	}
+	id, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		return nil, errors.New("notebook must be a notebook ID or none")
+	}
+	if !c.QueryBool("recursive") {
+		return query.Notebook{IDs: []primitive.ObjectID{id}}, nil
+	}
+	all, err := nc.notebooks.List(c.UserContext())
+	if err != nil {
+		return nil, err
+	}
+	return query.Notebook{IDs: notebookSubtree(all, id)}, nil
+}
+
+// noteETag formats a note version as the entity tag clients send back in If-Match
+func noteETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion returns the note version the If-Match header requires, or
+// store.AnyVersion when the header is absent or "*". ok is false when the
+// header holds anything but a single tag from noteETag, which no note can
+// match.
+func ifMatchVersion(c *fiber.Ctx) (version int, ok bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return store.AnyVersion, true
+	}
+	if len(header) < 3 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// versionConflict rejects a stale write with 412, returning the current note
+// and its version so the client can merge its change and retry
+func (nc *NoteController) versionConflict(c *fiber.Ctx, id primitive.ObjectID) error {
+	note, err := nc.notes.Get(c.UserContext(), id)
+	if err != nil {
+		return noteLookupError(c, err)
+	}
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":           "Note was modified since it was read",
+		"current_version": note.Version,
+		"current":         note,
+	})
+}
+
+// searchNote is models.Note without its MarshalJSON, so searchResult can
+// flatten the note fields into its own
+type searchNote models.Note
+
+// searchResult is a note ranked by SearchNotes with its highlighted matches
+type searchResult struct {
+	searchNote
+	FormattedDate  string   `json:"formatted_date"`
+	Score          float64  `json:"score"`
+	MatchedTerms   []string `json:"matched_terms"`
+	TitleHighlight string   `json:"title_highlight"`
+	Snippet        string   `json:"snippet"`
+}
+
+// SearchNotes finds the notes matching the structured query in the request
+// body, such as `release -tag:draft created:>2024-01-01`, ranked by relevance.
+// With "facets": true the results come wrapped with the tag tree of all
+// matching notes.
+func (nc *NoteController) SearchNotes(c *fiber.Ctx) error {
 	// Define a struct to parse the search query from the request body
 	type SearchQuery struct {
-		Query string `json:"query"` // Query field will hold the search string
+		Query  string `json:"query"`  // Query field will hold the search string
+		Limit  int    `json:"limit"`  // Maximum number of results, 20 by default
+		Facets bool   `json:"facets"` // Whether to count the tags of every match
 	}
 
 	var searchQuery SearchQuery
@@ -236,46 +523,77 @@ func SearchNotes(c *fiber.Ctx) error {
 			"error": "Search query is required",
 		})
 	}
+	if searchQuery.Limit < 0 || searchQuery.Limit > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Limit must be between 1 and 100",
+		})
+	}
+	if searchQuery.Limit == 0 {
+		searchQuery.Limit = 20
+	}
 
-	// Create a filter for MongoDB to search across the title, content, and tags fields
-	// The "$or" operator allows for matching any of the provided conditions
-	filter := bson.M{
-		"$or": []bson.M{
-			{"title": bson.M{"$regex": searchQuery.Query, "$options": "i"}},   // Search in the title field
-			{"content": bson.M{"$regex": searchQuery.Query, "$options": "i"}}, // Search in the content field
-			{"tags": bson.M{"$regex": searchQuery.Query, "$options": "i"}},    // Search in the tags array
-		},
+	// Parse the query, reporting where it went wrong so the client can point at it
+	parsed, err := query.Parse(searchQuery.Query)
+	if err != nil {
+		return queryError(c, err)
 	}
 
-	// Execute the search query on the MongoDB collection
-	cursor, err := collection.Find(context.Background(), filter)
+	// Look the words up in the index and let the store apply the remaining
+	// filters, then rank what matched
+	notes, err := nc.notes.Find(c.UserContext(), query.Resolve(parsed, nc.index))
 	if err != nil {
-		// If the query execution fails, return a 500 Internal Server Error with an error message
+		// If the query fails, return a 500 Internal Server Error with an error message
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to perform search",
 		})
 	}
-	defer cursor.Close(context.Background()) // Ensure the cursor is closed after processing
-
-	var notes []models.Note
-	// Parse all documents returned by the query into the notes slice
-	if err := cursor.All(context.Background(), &notes); err != nil {
-		// If parsing the results fails, return a 500 Internal Server Error with an error message
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse search results",
+	matches := make(map[primitive.ObjectID]models.Note, len(notes))
+	ids := make([]primitive.ObjectID, 0, len(notes))
+	for _, note := range notes {
+		matches[note.ID] = note
+		ids = append(ids, note.ID)
+	}
+	hits := nc.index.Search(strings.Join(query.Terms(parsed), " "), ids, searchQuery.Limit)
+
+	results := make([]searchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, searchResult{
+			searchNote:     searchNote(matches[hit.ID]),
+			FormattedDate:  matches[hit.ID].FormattedDate(),
+			Score:          hit.Score,
+			MatchedTerms:   hit.MatchedTerms,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        hit.Snippet,
 		})
 	}
 
-	// Return the found notes as a JSON response
-	return c.JSON(notes)
+	// Return the ranked notes as a JSON response
+	if !searchQuery.Facets {
+		return c.JSON(results)
+	}
+
+	// Count the tags of all matches, not just the ranked page, as a tree the
+	// client can drill down into with tag: filters
+	lists := make([][]string, len(notes))
+	for i, note := range notes {
+		lists[i] = note.Tags
+	}
+	return c.JSON(fiber.Map{
+		"results": results,
+		"total":   len(notes),
+		"facets":  tags.Facets(lists),
+	})
 }
 
-// SaveFile handles saving a file specified by the note ID
-func SaveFile(c *fiber.Ctx) error {
+// SaveFile writes a note to a file in the export directory. file_path is a
+// directory under it, created if missing, and on_conflict says what to do
+// when file_name is taken there: fail (the default), overwrite or rename.
+func (nc *NoteController) SaveFile(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
-		FileName string `json:"file_name"` // Changed from filename to file_name
-		FilePath string `json:"file_path"` // New field for file location
+		FileName   string `json:"file_name"`
+		FilePath   string `json:"file_path"` // relative to the export directory
+		OnConflict string `json:"on_conflict"`
 	}
 
 	// Parse the request body
@@ -295,11 +613,17 @@ func SaveFile(c *fiber.Ctx) error {
 			"error": "File name is required",
 		})
 	}
-	if body.FilePath == "" {
+	if strings.ContainsAny(body.FileName, `/\`) {
 		statusCode := fiber.StatusBadRequest
-		fmt.Printf("Status %d: Error - File location is required\n", statusCode) // Log the error with status code
+		fmt.Printf("Status %d: Error - File name contains a path: %s\n", statusCode, body.FileName) // Log the error with status code
 		return c.Status(statusCode).JSON(fiber.Map{
-			"error": "File location is required",
+			"error": "File name cannot contain a path",
+		})
+	}
+	policy, err := export.ParsePolicy(body.OnConflict)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid on_conflict: " + err.Error(),
 		})
 	}
 
@@ -313,10 +637,9 @@ func SaveFile(c *fiber.Ctx) error {
 		})
 	}
 
-	var note models.Note
-	err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&note)
+	note, err := nc.notes.Get(c.UserContext(), objID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == store.ErrNotFound {
 			statusCode := fiber.StatusNotFound
 			fmt.Printf("Status %d: Error - Note not found: %s\n", statusCode, err) // Log the error with status code
 			return c.Status(statusCode).JSON(fiber.Map{
@@ -330,86 +653,48 @@ func SaveFile(c *fiber.Ctx) error {
 		})
 	}
 
-	filePath := body.FilePath
+	// The extension picks the format; other files get the content as is
 	fileName := body.FileName
-	fileExt := filepath.Ext(fileName)
-	fullPath := filepath.Join(filePath, fileName)
-
-	// Ensure the directory exists
-	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+	format, ok := export.ForExtension(filepath.Ext(fileName))
+	if !ok {
+		format, _ = export.Lookup("txt")
+	}
+	src, err := nc.exportSource(c.UserContext(), note)
+	if err != nil {
 		statusCode := fiber.StatusInternalServerError
-		fmt.Printf("Status %d: Error - Failed to create directory: %s\n", statusCode, err) // Log the error with status code
+		fmt.Printf("Status %d: Error - Failed to render note: %s\n", statusCode, err) // Log the error with status code
 		return c.Status(statusCode).JSON(fiber.Map{
-			"error": "Failed to create directory",
+			"error": "Failed to render note",
 		})
 	}
-
-	switch fileExt {
-	case ".pdf":
-		// Create .pdf file
-		pdf := gofpdf.New("P", "mm", "A4", "")
-		pdf.AddPage()
-		pdf.SetFont("Arial", "", 12)
-		pdf.MultiCell(0, 10, note.Content, "", "L", false)
-		file, err := os.Create(fullPath)
-		if err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to create .pdf file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to create .pdf file",
-			})
-		}
-		defer file.Close()
-		if err := pdf.Output(file); err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to save .pdf file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to save .pdf file",
-			})
-		}
-	case ".txt":
-		// Create .txt file
-		file, err := os.Create(fullPath)
-		if err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to create .txt file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to create .txt file",
-			})
-		}
-		defer file.Close()
-		if _, err := file.WriteString(note.Content); err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to write to .txt file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to write to .txt file",
-			})
-		}
-	default:
-		// For unknown file types, save them as is
-		file, err := os.Create(fullPath)
-		if err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to create file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to create file",
-			})
-		}
-		defer file.Close()
-		if _, err := file.WriteString(note.Content); err != nil {
-			statusCode := fiber.StatusInternalServerError
-			fmt.Printf("Status %d: Error - Failed to write to file: %s\n", statusCode, err) // Log the error with status code
-			return c.Status(statusCode).JSON(fiber.Map{
-				"error": "Failed to write to file",
-			})
-		}
+	written, err := nc.exports.Root.Write(path.Join(filepath.ToSlash(body.FilePath), fileName), policy, func(w io.Writer) error {
+		return format.Write(w, src)
+	})
+	if err != nil {
+		return exportError(c, err, "Failed to save file")
 	}
 
-	// Success message with the actual file name
+	// Success message with the path the file was written to
 	statusCode := fiber.StatusOK
-	fmt.Printf("Status %d: %s has been saved to %s successfully\n", statusCode, fileName, fullPath)
+	fmt.Printf("Status %d: %s has been saved to %s successfully\n", statusCode, fileName, written)
 
 	return c.Status(statusCode).JSON(fiber.Map{
-		"message": fmt.Sprintf("%s has been saved to %s successfully", fileName, fullPath),
+		"message": fmt.Sprintf("%s has been saved to %s successfully", fileName, written),
+		"path":    written,
+	})
+}
+
+// queryError answers a search query that failed to parse, with the position
+// of a syntax error so the client can point at it
+func queryError(c *fiber.Ctx, err error) error {
+	var syntaxErr *query.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":    syntaxErr.Msg,
+		"position": syntaxErr.Pos,
 	})
 }
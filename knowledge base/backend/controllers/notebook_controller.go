@@ -0,0 +1,432 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/search"
+	"knowledge_base_backend/store"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotebookController serves the notebook endpoints
+type NotebookController struct {
+	notebooks store.NotebookStore
+	notes     store.NoteStore
+	revisions store.RevisionStore
+	links     *linker
+	index     *search.Index
+}
+
+// NewNotebookController returns a NotebookController backed by the given
+// stores. Deleting notebooks deletes or moves their notes, keeping revisions,
+// links and index in step.
+func NewNotebookController(notebooks store.NotebookStore, notes store.NoteStore, revisions store.RevisionStore, links store.LinkStore, index *search.Index) *NotebookController {
+	return &NotebookController{
+		notebooks: notebooks,
+		notes:     notes,
+		revisions: revisions,
+		links:     &linker{notes: notes, links: links, revisions: revisions, index: index},
+		index:     index,
+	}
+}
+
+// notebookInput is the part of a notebook clients send
+type notebookInput struct {
+	Name     string              `json:"name"`
+	ParentID *primitive.ObjectID `json:"parent_id"`
+}
+
+// notebookNode is a notebook with the notebooks nested in it
+type notebookNode struct {
+	models.Notebook
+	Children []notebookNode `json:"children"`
+}
+
+// GetNotebooks lists every notebook by name, or as a tree with tree=true
+func (bc *NotebookController) GetNotebooks(c *fiber.Ctx) error {
+	notebooks, err := bc.notebooks.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notebooks",
+		})
+	}
+	sort.SliceStable(notebooks, func(i, j int) bool {
+		return strings.ToLower(notebooks[i].Name) < strings.ToLower(notebooks[j].Name)
+	})
+	if c.QueryBool("tree") {
+		return c.JSON(notebookTree(notebooks, nil))
+	}
+	return c.JSON(notebooks)
+}
+
+// GetNotebook retrieves a single notebook by its ID
+func (bc *NotebookController) GetNotebook(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	notebook, err := bc.notebooks.Get(c.UserContext(), objID)
+	if err != nil {
+		return notebookLookupError(c, err)
+	}
+	return c.JSON(notebook)
+}
+
+// CreateNotebook adds a notebook, at the top level unless parent_id is given
+func (bc *NotebookController) CreateNotebook(c *fiber.Ctx) error {
+	var input notebookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	name, msg := notebookName(input.Name)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	all, err := bc.notebooks.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notebooks",
+		})
+	}
+	if input.ParentID != nil && findNotebook(all, *input.ParentID) == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Parent notebook not found",
+		})
+	}
+	if siblingNamed(all, input.ParentID, name, primitive.NilObjectID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A notebook named " + name + " already exists there",
+		})
+	}
+
+	now := time.Now().UTC()
+	notebook := models.Notebook{Name: name, ParentID: input.ParentID, CreatedAt: now, UpdatedAt: now}
+	if err := bc.notebooks.Create(c.UserContext(), &notebook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create notebook",
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(notebook)
+}
+
+// UpdateNotebook renames a notebook. Notebooks change parent with
+// MoveNotebook.
+func (bc *NotebookController) UpdateNotebook(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	var input notebookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	name, msg := notebookName(input.Name)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	all, err := bc.notebooks.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notebooks",
+		})
+	}
+	notebook := findNotebook(all, objID)
+	if notebook == nil {
+		return notebookLookupError(c, store.ErrNotFound)
+	}
+	if siblingNamed(all, notebook.ParentID, name, objID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A notebook named " + name + " already exists there",
+		})
+	}
+
+	notebook.Name = name
+	notebook.UpdatedAt = time.Now().UTC()
+	if err := bc.notebooks.Update(c.UserContext(), *notebook); err != nil {
+		return notebookWriteError(c, err, "Failed to update notebook")
+	}
+	return c.JSON(notebook)
+}
+
+// MoveNotebook moves a notebook, with everything in it, under the notebook
+// parent_id, or to the top level when parent_id is null
+func (bc *NotebookController) MoveNotebook(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	var input notebookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	all, err := bc.notebooks.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notebooks",
+		})
+	}
+	notebook := findNotebook(all, objID)
+	if notebook == nil {
+		return notebookLookupError(c, store.ErrNotFound)
+	}
+	if input.ParentID != nil {
+		if findNotebook(all, *input.ParentID) == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent notebook not found",
+			})
+		}
+		for _, id := range notebookSubtree(all, objID) {
+			if id == *input.ParentID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Cannot move a notebook into itself or a notebook inside it",
+				})
+			}
+		}
+	}
+	if siblingNamed(all, input.ParentID, notebook.Name, objID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A notebook named " + notebook.Name + " already exists there",
+		})
+	}
+
+	notebook.ParentID = input.ParentID
+	notebook.UpdatedAt = time.Now().UTC()
+	if err := bc.notebooks.Update(c.UserContext(), *notebook); err != nil {
+		return notebookWriteError(c, err, "Failed to move notebook")
+	}
+	return c.JSON(notebook)
+}
+
+// DeleteNotebook removes a notebook and the notebooks inside it. Their notes
+// move to the inbox notebook, or are deleted too with notes=delete.
+func (bc *NotebookController) DeleteNotebook(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	mode := c.Query("notes", "inbox")
+	if mode != "inbox" && mode != "delete" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "notes must be inbox or delete",
+		})
+	}
+
+	all, err := bc.notebooks.List(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notebooks",
+		})
+	}
+	if findNotebook(all, objID) == nil {
+		return notebookLookupError(c, store.ErrNotFound)
+	}
+	subtree := notebookSubtree(all, objID)
+	for _, id := range subtree {
+		if findNotebook(all, id).Inbox {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The inbox notebook cannot be deleted",
+			})
+		}
+	}
+
+	ctx := c.UserContext()
+	notes, err := bc.notes.Find(ctx, query.Notebook{IDs: subtree})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notes",
+		})
+	}
+	var moved []primitive.ObjectID
+	if mode == "delete" {
+		err = bc.deleteNotes(ctx, notes)
+	} else {
+		moved, err = bc.moveToInbox(ctx, notes)
+	}
+	if err != nil {
+		response := fiber.Map{"error": "Failed to empty notebook"}
+		if mode != "delete" {
+			// The notebook stays, but the notes already in the inbox are reported
+			response["moved_ids"] = moved
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	// Delete the deepest notebooks first so none is ever left without its parent
+	for i := len(subtree) - 1; i >= 0; i-- {
+		if err := bc.notebooks.Delete(ctx, subtree[i]); err != nil && err != store.ErrNotFound {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete notebook",
+			})
+		}
+	}
+
+	response := fiber.Map{
+		"message":   "Notebook deleted successfully",
+		"notebooks": len(subtree),
+	}
+	if mode == "delete" {
+		response["notes_deleted"] = len(notes)
+	} else {
+		response["notes_moved"] = len(moved)
+	}
+	return c.JSON(response)
+}
+
+// deleteNotes deletes the notes with their revisions
+func (bc *NotebookController) deleteNotes(ctx context.Context, notes []models.Note) error {
+	for _, note := range notes {
+		if err := bc.notes.Delete(ctx, note.ID, store.AnyVersion); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		bc.index.Remove(note.ID)
+		bc.links.remove(ctx, note.ID)
+		if err := bc.revisions.DeleteAll(ctx, note.ID); err != nil {
+			fmt.Printf("Warning - failed to delete revisions of note %s: %s\n", note.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// moveToInbox files the notes in the inbox notebook, writing only their
+// notebook so edits racing the move are kept. It returns the IDs of the notes
+// moved, including those moved before a failure.
+func (bc *NotebookController) moveToInbox(ctx context.Context, notes []models.Note) ([]primitive.ObjectID, error) {
+	moved := []primitive.ObjectID{}
+	if len(notes) == 0 {
+		return moved, nil
+	}
+	inbox, err := bc.notebooks.Inbox(ctx)
+	if err != nil {
+		return moved, err
+	}
+	now := time.Now().UTC()
+	for _, note := range notes {
+		ok, err := bc.notes.Move(ctx, note.ID, &inbox.ID, now)
+		if err != nil && err != store.ErrNotFound {
+			return moved, err
+		}
+		if ok {
+			moved = append(moved, note.ID)
+		}
+	}
+	return moved, nil
+}
+
+// notebookName trims a notebook name and returns the message explaining why
+// it is invalid, if it is
+func notebookName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "Name is required"
+	}
+	if len(name) > 100 {
+		return "", "Name cannot exceed 100 characters"
+	}
+	return name, ""
+}
+
+// findNotebook returns the notebook with the given ID, or nil
+func findNotebook(all []models.Notebook, id primitive.ObjectID) *models.Notebook {
+	for i := range all {
+		if all[i].ID == id {
+			return &all[i]
+		}
+	}
+	return nil
+}
+
+// siblingNamed reports whether a notebook other than except, under parent,
+// already has the name, ignoring case
+func siblingNamed(all []models.Notebook, parent *primitive.ObjectID, name string, except primitive.ObjectID) bool {
+	for _, notebook := range all {
+		if notebook.ID != except && sameID(notebook.ParentID, parent) && strings.EqualFold(notebook.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameID reports whether two optional IDs are both nil or equal
+func sameID(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// notebookSubtree returns root followed by every notebook inside it, each
+// after its parent
+func notebookSubtree(all []models.Notebook, root primitive.ObjectID) []primitive.ObjectID {
+	ids := []primitive.ObjectID{root}
+	seen := map[primitive.ObjectID]bool{root: true}
+	for i := 0; i < len(ids); i++ {
+		for _, notebook := range all {
+			if notebook.ParentID != nil && *notebook.ParentID == ids[i] && !seen[notebook.ID] {
+				seen[notebook.ID] = true
+				ids = append(ids, notebook.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// notebookTree nests the notebooks under parent, or the top level when nil,
+// keeping their order
+func notebookTree(all []models.Notebook, parent *primitive.ObjectID) []notebookNode {
+	nodes := []notebookNode{}
+	for _, notebook := range all {
+		if sameID(notebook.ParentID, parent) {
+			id := notebook.ID
+			nodes = append(nodes, notebookNode{Notebook: notebook, Children: notebookTree(all, &id)})
+		}
+	}
+	return nodes
+}
+
+func notebookLookupError(c *fiber.Ctx, err error) error {
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Notebook not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to retrieve notebook",
+	})
+}
+
+func notebookWriteError(c *fiber.Ctx, err error, msg string) error {
+	if err == store.ErrNotFound {
+		return notebookLookupError(c, err)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": msg,
+	})
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"fmt"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Listing page sizes
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageResponse is one page of a listing. NextCursor is passed back as the
+// cursor parameter to fetch the following page and is absent on the last.
+type pageResponse struct {
+	Items      any    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageParams reads the limit, cursor, sort and order query parameters. sort
+// must be one of sorts and defaults to the first; order is asc (default) or desc.
+func pageParams(c *fiber.Ctx, sorts []string) (store.Page, error) {
+	page := store.Page{
+		Sort:  c.Query("sort", sorts[0]),
+		Limit: defaultPageSize,
+	}
+
+	valid := false
+	for _, s := range sorts {
+		valid = valid || s == page.Sort
+	}
+	if !valid {
+		return page, fmt.Errorf("Invalid sort %q, expected one of %s", page.Sort, strings.Join(sorts, ", "))
+	}
+
+	switch order := c.Query("order", "asc"); order {
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, fmt.Errorf("Invalid order %q, expected asc or desc", order)
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return page, fmt.Errorf("Limit must be between 1 and %d", maxPageSize)
+		}
+		page.Limit = limit
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		after, err := store.DecodeCursor(token, page.Sort, page.Desc)
+		if err != nil {
+			return page, fmt.Errorf("Invalid cursor for this sort order")
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// dateParams reads the <prefix>_from and <prefix>_to query parameters as the
+// inclusive bounds of a date range, returned as a half-open [from, to)
+func dateParams(c *fiber.Ctx, prefix string) (from, to time.Time, err error) {
+	if raw := c.Query(prefix + "_from"); raw != "" {
+		r, err := query.ParseDateRange(">=", raw)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid %s_from: %s", prefix, err)
+		}
+		from = r.From
+	}
+	if raw := c.Query(prefix + "_to"); raw != "" {
+		r, err := query.ParseDateRange("<=", raw)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid %s_to: %s", prefix, err)
+		}
+		to = r.To
+	}
+	return from, to, nil
+}
+
+// listParam splits a comma-separated query parameter, dropping empty items
+func listParam(c *fiber.Ctx, name string) []string {
+	var items []string
+	for _, item := range strings.Split(c.Query(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"knowledge_base_backend/jsonpatch"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/store"
+	"knowledge_base_backend/tags"
+	"mime"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// acceptPatch lists the patch formats PatchNote understands
+const acceptPatch = jsonpatch.MergePatchType + ", " + jsonpatch.JSONPatchType
+
+// readOnlyNoteFields are the JSON members of a note only the server may change
+var readOnlyNoteFields = map[string]bool{
+	"_id":            true,
+	"created_at":     true,
+	"updated_at":     true,
+	"formatted_date": true,
+	"version":        true,
+}
+
+// patchAttempts bounds how often PatchNote reapplies a patch when another
+// write lands between reading the note and storing it
+const patchAttempts = 3
+
+// PatchNote changes part of a note with a JSON Merge Patch (RFC 7396) or a
+// JSON Patch (RFC 6902), chosen by Content-Type. Plain application/json is
+// read as a JSON Patch when it is an array and a merge patch otherwise. Only
+// the fields the patch changes are validated.
+func (nc *NoteController) PatchNote(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+
+	body := c.Body()
+	patchType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	switch patchType {
+	case jsonpatch.MergePatchType, jsonpatch.JSONPatchType:
+	case fiber.MIMEApplicationJSON:
+		patchType = jsonpatch.MergePatchType
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			patchType = jsonpatch.JSONPatchType
+		}
+	default:
+		c.Set("Accept-Patch", acceptPatch)
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Content-Type must be " + jsonpatch.MergePatchType + " or " + jsonpatch.JSONPatchType,
+		})
+	}
+
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return nc.versionConflict(c, objID)
+	}
+
+	for attempt := 1; ; attempt++ {
+		note, err := nc.notes.Get(c.UserContext(), objID)
+		if err != nil {
+			return noteLookupError(c, err)
+		}
+		if ifVersion != store.AnyVersion && note.Version != ifVersion {
+			return nc.versionConflict(c, objID)
+		}
+
+		notebookID, title := note.NotebookID, note.Title
+		changed, status, err := applyNotePatch(&note, patchType, body)
+		if err != nil {
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if !sameID(notebookID, note.NotebookID) {
+			if msg := nc.checkNotebook(c, note.NotebookID); msg != "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": msg,
+				})
+			}
+		}
+		if !changed {
+			c.Set(fiber.HeaderETag, noteETag(note.Version))
+			return c.JSON(note)
+		}
+
+		// The patch was computed against the version just read, so store it
+		// only over that version
+		readVersion := note.Version
+		note.UpdatedAt = time.Now().UTC()
+		nc.recordBaseline(c, objID)
+		err = nc.notes.Update(c.UserContext(), &note, readVersion)
+		if err == store.ErrVersionConflict {
+			if ifVersion == store.AnyVersion && attempt < patchAttempts {
+				continue
+			}
+			return nc.versionConflict(c, objID)
+		}
+		if err != nil {
+			if err == store.ErrNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Note not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update note",
+			})
+		}
+
+		nc.index.Add(note)
+		nc.recordRevision(c, note)
+		nc.links.sync(c.UserContext(), note, title, c.Get(authorHeader))
+		c.Set(fiber.HeaderETag, noteETag(note.Version))
+		return c.JSON(note)
+	}
+}
+
+// applyNotePatch patches the editable fields of note. It reports whether any
+// changed, or the status and error to answer a patch that cannot be applied.
+func applyNotePatch(note *models.Note, patchType string, patch []byte) (bool, int, error) {
+	encoded, err := json.Marshal(note)
+	if err != nil {
+		return false, fiber.StatusInternalServerError, errors.New("Failed to encode note")
+	}
+	original, err := jsonpatch.Decode(encoded)
+	if err != nil {
+		return false, fiber.StatusInternalServerError, errors.New("Failed to encode note")
+	}
+
+	var patched any
+	if patchType == jsonpatch.MergePatchType {
+		mergePatch, err := jsonpatch.Decode(patch)
+		if err != nil {
+			return false, fiber.StatusBadRequest, fmt.Errorf("Invalid merge patch: %s", err)
+		}
+		if _, ok := mergePatch.(map[string]any); !ok {
+			return false, fiber.StatusBadRequest, errors.New("Merge patch must be a JSON object")
+		}
+		patched = jsonpatch.Merge(original, mergePatch)
+	} else {
+		patched, err = jsonpatch.Apply(original, patch)
+		if errors.Is(err, jsonpatch.ErrConflict) {
+			return false, fiber.StatusConflict, err
+		}
+		if err != nil {
+			return false, fiber.StatusBadRequest, err
+		}
+	}
+	result, ok := patched.(map[string]any)
+	if !ok {
+		return false, fiber.StatusBadRequest, errors.New("Patch must leave the note a JSON object")
+	}
+
+	// A missing member reads as null, so removing an unset field changes nothing
+	before := original.(map[string]any)
+	changed := make(map[string]bool)
+	for _, fields := range []map[string]any{before, result} {
+		for field := range fields {
+			if jsonpatch.Equal(before[field], result[field]) {
+				continue
+			}
+			if _, known := before[field]; !known {
+				return false, fiber.StatusBadRequest, fmt.Errorf("Unknown field %q", field)
+			}
+			if readOnlyNoteFields[field] {
+				return false, fiber.StatusBadRequest, fmt.Errorf("Field %q cannot be changed", field)
+			}
+			changed[field] = true
+		}
+	}
+	if len(changed) == 0 {
+		return false, 0, nil
+	}
+
+	encoded, err = json.Marshal(result)
+	if err != nil {
+		return false, fiber.StatusInternalServerError, errors.New("Failed to encode note")
+	}
+	var update models.Note
+	if err := json.Unmarshal(encoded, &update); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return false, fiber.StatusBadRequest, fmt.Errorf("Invalid value for field %q", typeErr.Field)
+		}
+		return false, fiber.StatusBadRequest, errors.New("Invalid input")
+	}
+
+	// Validate only what the patch changed
+	if changed["title"] {
+		if update.Title == "" {
+			return false, fiber.StatusBadRequest, errors.New("Title is required")
+		}
+		if len(update.Title) > 100 {
+			return false, fiber.StatusBadRequest, errors.New("Title cannot exceed 100 characters")
+		}
+		note.Title = update.Title
+	}
+	if changed["content"] {
+		if update.Content == "" {
+			return false, fiber.StatusBadRequest, errors.New("Content is required")
+		}
+		note.Content = update.Content
+	}
+	if changed["format"] {
+		if !models.IsFormat(update.Format) {
+			return false, fiber.StatusBadRequest, errors.New(formatError)
+		}
+		note.Format = update.Format
+	}
+	if changed["tags"] {
+		note.Tags = tags.NormalizeAll(update.Tags)
+	}
+	if changed["notebook_id"] {
+		note.NotebookID = update.NotebookID
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"knowledge_base_backend/links"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/render"
+	"knowledge_base_backend/store"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// renderedNote is a note rendered as sanitized HTML
+type renderedNote struct {
+	ID     primitive.ObjectID `json:"id"`
+	Title  string             `json:"title"`
+	Format string             `json:"format"`
+	render.Document
+}
+
+// RenderNote returns a note as sanitized HTML with its table of contents.
+// Markdown notes are rendered as CommonMark with the GitHub extensions and
+// plain notes as paragraphs of text. [[Wiki links]] point at the notes they
+// name and import:<id> links and images at the content of the import.
+func (nc *NoteController) RenderNote(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	note, err := nc.notes.Get(c.UserContext(), objID)
+	if err != nil {
+		return noteLookupError(c, err)
+	}
+
+	doc, err := renderNote(note, nc.resolver(c.UserContext()))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render note",
+		})
+	}
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
+	return c.JSON(renderedNote{ID: note.ID, Title: note.Title, Format: note.Format, Document: doc})
+}
+
+// renderNote renders note by its format. Notes stored before formats existed
+// are plain.
+func renderNote(note models.Note, resolve render.Resolver) (render.Document, error) {
+	if note.Format == models.FormatMarkdown {
+		return render.Markdown(note.Content, resolve)
+	}
+	return render.Plain(note.Content, resolve), nil
+}
+
+// noteResolver resolves the links of notes being rendered against the stores
+type noteResolver struct {
+	ctx     context.Context
+	note    func(links.Ref) *primitive.ObjectID
+	imports store.ImportStore
+}
+
+func (nc *NoteController) resolver(ctx context.Context) *noteResolver {
+	return &noteResolver{ctx: ctx, note: nc.links.resolver(ctx), imports: nc.imports}
+}
+
+func (r *noteResolver) Note(target string) (string, bool) {
+	id := r.note(links.Ref{Target: target})
+	if id == nil {
+		return "", false
+	}
+	return "/notes/" + id.Hex(), true
+}
+
+func (r *noteResolver) Import(id string) (string, string, bool) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return "", "", false
+	}
+	imp, err := r.imports.Get(r.ctx, objID)
+	if err != nil {
+		return "", "", false
+	}
+	return "/imports/" + objID.Hex() + "/content", imp.FileName, true
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"knowledge_base_backend/diff"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authorHeader names the request header identifying who made a change. The
+// API has no authentication, so it is taken on trust.
+const authorHeader = "X-Author"
+
+// ListRevisions returns the revision history of a note, oldest first
+func (nc *NoteController) ListRevisions(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	if _, err := nc.notes.Get(c.UserContext(), objID); err != nil {
+		return noteLookupError(c, err)
+	}
+
+	revisions, err := nc.revisions.List(c.UserContext(), objID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve revisions",
+		})
+	}
+	return c.JSON(revisions)
+}
+
+// GetRevision returns one numbered revision of a note
+func (nc *NoteController) GetRevision(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	number, err := strconv.Atoi(c.Params("rev"))
+	if err != nil || number < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid revision number",
+		})
+	}
+
+	rev, err := nc.revisions.Get(c.UserContext(), objID, number)
+	if err != nil {
+		return revisionLookupError(c, err)
+	}
+	return c.JSON(rev)
+}
+
+// DiffRevisions compares two revisions of a note given by the from and to
+// query parameters; to defaults to the latest revision. by=line (default) or
+// by=word sets the granularity of the content diff. Titles are always
+// compared word by word.
+func (nc *NoteController) DiffRevisions(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+
+	by := c.Query("by", "line")
+	diffContent := diff.Lines
+	switch by {
+	case "line":
+	case "word":
+		diffContent = diff.Words
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid diff granularity %q, expected line or word", by),
+		})
+	}
+
+	fromNumber, err := strconv.Atoi(c.Query("from"))
+	if err != nil || fromNumber < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Query parameter from must be a revision number",
+		})
+	}
+	from, err := nc.revisions.Get(c.UserContext(), objID, fromNumber)
+	if err != nil {
+		return revisionLookupError(c, err)
+	}
+
+	var to models.Revision
+	if c.Query("to") == "" {
+		to, err = nc.revisions.Latest(c.UserContext(), objID)
+	} else {
+		toNumber, convErr := strconv.Atoi(c.Query("to"))
+		if convErr != nil || toNumber < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Query parameter to must be a revision number",
+			})
+		}
+		to, err = nc.revisions.Get(c.UserContext(), objID, toNumber)
+	}
+	if err != nil {
+		return revisionLookupError(c, err)
+	}
+
+	added, removed := tagChanges(from.Tags, to.Tags)
+	return c.JSON(fiber.Map{
+		"from":         from.Number,
+		"to":           to.Number,
+		"by":           by,
+		"identical":    from.Hash == to.Hash && from.NoteFormat() == to.NoteFormat(),
+		"title":        diff.Words(from.Title, to.Title),
+		"content":      diffContent(from.Content, to.Content),
+		"tags_added":   added,
+		"tags_removed": removed,
+	})
+}
+
+// RestoreRevision makes an old revision of a note its current version. The
+// restore is recorded as a new revision, so no history is lost.
+func (nc *NoteController) RestoreRevision(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ID format",
+		})
+	}
+	number, err := strconv.Atoi(c.Params("rev"))
+	if err != nil || number < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid revision number",
+		})
+	}
+
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return nc.versionConflict(c, objID)
+	}
+
+	note, err := nc.notes.Get(c.UserContext(), objID)
+	if err != nil {
+		return noteLookupError(c, err)
+	}
+	rev, err := nc.revisions.Get(c.UserContext(), objID, number)
+	if err != nil {
+		return revisionLookupError(c, err)
+	}
+
+	title := note.Title
+	note.Title = rev.Title
+	note.Content = rev.Content
+	note.Format = rev.NoteFormat()
+	note.Tags = append([]string(nil), rev.Tags...)
+	note.UpdatedAt = time.Now().UTC()
+	if err := nc.notes.Update(c.UserContext(), &note, ifVersion); err != nil {
+		if err == store.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Note not found",
+			})
+		}
+		if err == store.ErrVersionConflict {
+			return nc.versionConflict(c, objID)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restore note",
+		})
+	}
+	nc.index.Add(note)
+
+	head := models.NewRevision(note, c.Get(authorHeader))
+	head.RestoredFrom = number
+	if err := nc.revisions.Create(c.UserContext(), &head); err != nil {
+		fmt.Printf("Warning - failed to record revision of note %s: %s\n", objID.Hex(), err)
+	}
+	nc.links.sync(c.UserContext(), note, title, c.Get(authorHeader))
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
+	return c.JSON(fiber.Map{
+		"message":  "Note restored successfully",
+		"revision": head.Number,
+		"version":  note.Version,
+	})
+}
+
+// recordRevision snapshots the note as its newest revision. History is
+// secondary to the write that already succeeded, so failures are logged
+// rather than returned.
+func (nc *NoteController) recordRevision(c *fiber.Ctx, note models.Note) {
+	rev := models.NewRevision(note, c.Get(authorHeader))
+	if err := nc.revisions.Create(c.UserContext(), &rev); err != nil {
+		fmt.Printf("Warning - failed to record revision of note %s: %s\n", note.ID.Hex(), err)
+	}
+}
+
+// recordBaseline snapshots a note written before revisions were kept, so the
+// first update still leaves its original version in the history
+func (nc *NoteController) recordBaseline(c *fiber.Ctx, id primitive.ObjectID) {
+	if _, err := nc.revisions.Latest(c.UserContext(), id); err != store.ErrNotFound {
+		return
+	}
+	note, err := nc.notes.Get(c.UserContext(), id)
+	if err != nil {
+		return
+	}
+	saveBaseline(c.UserContext(), nc.revisions, note)
+}
+
+// saveBaseline snapshots the note as it stands when it has no revisions yet
+func saveBaseline(ctx context.Context, revisions store.RevisionStore, note models.Note) {
+	if _, err := revisions.Latest(ctx, note.ID); err != store.ErrNotFound {
+		return
+	}
+	rev := models.NewRevision(note, "")
+	rev.CreatedAt = note.UpdatedAt
+	if err := revisions.Create(ctx, &rev); err != nil {
+		fmt.Printf("Warning - failed to record baseline revision of note %s: %s\n", note.ID.Hex(), err)
+	}
+}
+
+// tagChanges lists the tags only in b and the tags only in a
+func tagChanges(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, tag := range a {
+		inA[tag] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, tag := range b {
+		inB[tag] = true
+	}
+	added, removed = []string{}, []string{}
+	for _, tag := range b {
+		if !inA[tag] {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range a {
+		if !inB[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	return added, removed
+}
+
+func noteLookupError(c *fiber.Ctx, err error) error {
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Note not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to retrieve note",
+	})
+}
+
+func revisionLookupError(c *fiber.Ctx, err error) error {
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Revision not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to retrieve revision",
+	})
+}
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"knowledge_base_backend/search"
+	"knowledge_base_backend/store"
+	"knowledge_base_backend/tags"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TagController serves the tag endpoints across notes and imports
+type TagController struct {
+	notes     store.NoteStore
+	imports   store.ImportStore
+	revisions store.RevisionStore
+	index     *search.Index
+}
+
+// NewTagController returns a TagController that records a revision of every
+// note it retags and keeps index in step with it
+func NewTagController(notes store.NoteStore, imports store.ImportStore, revisions store.RevisionStore, index *search.Index) *TagController {
+	return &TagController{notes: notes, imports: imports, revisions: revisions, index: index}
+}
+
+// tagUsage is how often a tag is used
+type tagUsage struct {
+	Tag     string `json:"tag"`
+	Notes   int    `json:"notes"`
+	Imports int    `json:"imports"`
+	Total   int    `json:"total"`
+}
+
+// GetTags lists every tag with its usage counts, most used first
+func (tc *TagController) GetTags(c *fiber.Ctx) error {
+	usage, err := tc.usage(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count tags",
+		})
+	}
+
+	list := make([]tagUsage, 0, len(usage))
+	for _, u := range usage {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return c.JSON(list)
+}
+
+// RenameTag renames a tag and the tags below it on every note and import, so
+// renaming "project/alpha" to "archive/alpha" also moves "project/alpha/design".
+// Renaming onto a tag that is already in use is refused; merge the tags
+// instead.
+func (tc *TagController) RenameTag(c *fiber.Ctx) error {
+	from, ok := tagParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tag",
+		})
+	}
+	var body struct {
+		To string `json:"to"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	to := tags.Normalize(body.To)
+	if to == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "New tag name is required",
+		})
+	}
+	if to != from && tags.Within(to, from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot move a tag below itself",
+		})
+	}
+
+	usage, err := tc.usage(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count tags",
+		})
+	}
+	moves := subtreeMoves(usage, from, to)
+	if len(moves) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+	if to == from {
+		return c.JSON(fiber.Map{"tag": to, "notes": 0, "imports": 0})
+	}
+	for _, move := range moves {
+		if _, ok := usage[move.to]; ok {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Tag " + move.to + " already exists, merge the tags instead",
+			})
+		}
+	}
+
+	notes, imports, err := tc.retag(c, moves)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rename tag",
+		})
+	}
+	return c.JSON(fiber.Map{"tag": to, "notes": notes, "imports": imports})
+}
+
+// MergeTags replaces each of the tags in from with into, so everything that
+// carried any of them carries into once. Tags below a merged tag move below
+// into, merging with any already there.
+func (tc *TagController) MergeTags(c *fiber.Ctx) error {
+	var body struct {
+		From []string `json:"from"`
+		Into string   `json:"into"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	into := tags.Normalize(body.Into)
+	from := tags.NormalizeAll(body.From)
+	if into == "" || len(from) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Both from and into are required",
+		})
+	}
+
+	usage, err := tc.usage(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count tags",
+		})
+	}
+	var moves []tagMove
+	for _, tag := range from {
+		if tag == into {
+			continue
+		}
+		if tags.Within(into, tag) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot merge " + tag + " into a tag below it",
+			})
+		}
+		moves = append(moves, subtreeMoves(usage, tag, into)...)
+	}
+
+	notes, imports, err := tc.retag(c, moves)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to merge tags",
+		})
+	}
+	return c.JSON(fiber.Map{"tag": into, "notes": notes, "imports": imports})
+}
+
+// DeleteTag removes a tag and the tags below it from every note and import
+func (tc *TagController) DeleteTag(c *fiber.Ctx) error {
+	tag, ok := tagParam(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tag",
+		})
+	}
+
+	usage, err := tc.usage(c.UserContext())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count tags",
+		})
+	}
+	moves := subtreeMoves(usage, tag, "")
+	if len(moves) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+
+	notes, imports, err := tc.retag(c, moves)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete tag",
+		})
+	}
+	return c.JSON(fiber.Map{"notes": notes, "imports": imports})
+}
+
+// tagMove replaces one tag with another, or removes it when to is empty
+type tagMove struct {
+	from, to string
+}
+
+// subtreeMoves lists the moves taking each used tag within from to the same
+// place below to, or removing it when to is empty
+func subtreeMoves(usage map[string]tagUsage, from, to string) []tagMove {
+	var moves []tagMove
+	for tag := range usage {
+		if !tags.Within(tag, from) {
+			continue
+		}
+		move := tagMove{from: tag}
+		if to != "" {
+			move.to = to + tag[len(from):]
+		}
+		moves = append(moves, move)
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].from < moves[j].from })
+	return moves
+}
+
+// usage counts each tag across notes and imports
+func (tc *TagController) usage(ctx context.Context) (map[string]tagUsage, error) {
+	noteCounts, err := tc.notes.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	importCounts, err := tc.imports.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]tagUsage, len(noteCounts))
+	for tag, n := range noteCounts {
+		usage[tag] = tagUsage{Tag: tag, Notes: n, Total: n}
+	}
+	for tag, n := range importCounts {
+		u := usage[tag]
+		u.Tag = tag
+		u.Imports = n
+		u.Total += n
+		usage[tag] = u
+	}
+	return usage, nil
+}
+
+// retag applies the moves to every note and import and reports how many of
+// each changed
+func (tc *TagController) retag(c *fiber.Ctx, moves []tagMove) (notes, imports int, err error) {
+	ctx := c.UserContext()
+	changedNotes := make(map[primitive.ObjectID]bool)
+	changedImports := make(map[primitive.ObjectID]bool)
+	for _, move := range moves {
+		// Notes written before revisions were kept need their current
+		// version saved before the tag changes it
+		tagged, err := tc.notes.Find(ctx, query.Tag{Value: move.from})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, note := range tagged {
+			saveBaseline(ctx, tc.revisions, note)
+		}
+
+		ids, err := tc.notes.ReplaceTag(ctx, move.from, move.to, time.Now().UTC())
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, id := range ids {
+			changedNotes[id] = true
+		}
+		ids, err = tc.imports.ReplaceTag(ctx, move.from, move.to)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, id := range ids {
+			changedImports[id] = true
+		}
+	}
+
+	for id := range changedNotes {
+		note, err := tc.notes.Get(ctx, id)
+		if err != nil {
+			continue
+		}
+		tc.index.Add(note)
+		rev := models.NewRevision(note, c.Get(authorHeader))
+		if err := tc.revisions.Create(ctx, &rev); err != nil {
+			fmt.Printf("Warning - failed to record revision of note %s: %s\n", id.Hex(), err)
+		}
+	}
+	return len(changedNotes), len(changedImports), nil
+}
+
+// tagParam reads the normalized tag from the path. Fiber leaves path
+// parameters escaped, and tags may contain spaces.
+func tagParam(c *fiber.Ctx) (string, bool) {
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return "", false
+	}
+	tag := tags.Normalize(name)
+	return tag, tag != ""
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFieldSize bounds the form values read alongside an uploaded file
+const maxFieldSize = 64 << 10
+
+// errNoFile is returned for an upload form without a file part
+var errNoFile = errors.New("no file in the upload")
+
+// BufferBody reads request bodies of up to limit bytes into memory for the
+// handlers after it, answering 413 for larger ones. The server streams
+// request bodies so uploads never sit in memory whole; requests skip selects
+// are left streaming.
+func BufferBody(limit int64, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stream := c.Context().RequestBodyStream()
+		if stream == nil || skip(c) {
+			return c.Next()
+		}
+		if c.Request().Header.ContentLength() > int(limit) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Request body too large",
+			})
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(nil, io.NopCloser(stream), limit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Request body too large",
+			})
+		} else if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to read request body",
+			})
+		}
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
+
+// upload is a file posted to UploadFile, spooled to a temporary file
+type upload struct {
+	file     *os.File
+	name     string
+	size     int64
+	tags     string
+	location string
+}
+
+// remove closes and deletes the temporary file
+func (u *upload) remove() {
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+// readUpload reads the multipart form of an upload as it arrives, copying
+// the file part to a temporary file so it is never held in memory whole.
+// Bodies over limit fail with an *http.MaxBytesError.
+func readUpload(c *fiber.Ctx, limit int64) (*upload, error) {
+	mediaType, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err != nil || mediaType != fiber.MIMEMultipartForm || params["boundary"] == "" {
+		return nil, errNoFile
+	}
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		// Already read in by the server
+		body = bytes.NewReader(c.Body())
+	}
+	mr := multipart.NewReader(http.MaxBytesReader(nil, io.NopCloser(body), limit), params["boundary"])
+
+	u := &upload{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if u.file != nil {
+				u.remove()
+			}
+			return nil, err
+		}
+		switch {
+		case part.FormName() == "file" && part.FileName() != "" && u.file == nil:
+			if u.file, err = os.CreateTemp("", "kb-upload-*"); err != nil {
+				return nil, fmt.Errorf("spooling upload: %w", err)
+			}
+			u.name = part.FileName()
+			u.size, err = io.Copy(u.file, part)
+		case part.FormName() == "tags":
+			u.tags, err = readField(part)
+		case part.FormName() == "location":
+			u.location, err = readField(part)
+		}
+		part.Close()
+		if err != nil {
+			if u.file != nil {
+				u.remove()
+			}
+			return nil, err
+		}
+	}
+	if u.file == nil {
+		return nil, errNoFile
+	}
+	return u, nil
+}
+
+// readField reads a form value, truncated to maxFieldSize
+func readField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+	return string(value), err
+}
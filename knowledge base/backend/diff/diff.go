@@ -0,0 +1,181 @@
+// Package diff computes the edits that turn one text into another
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kind says what an Edit does
+type Kind string
+
+const (
+	Equal  Kind = "equal"
+	Insert Kind = "insert"
+	Delete Kind = "delete"
+)
+
+// Edit is a run of text kept, inserted or deleted
+type Edit struct {
+	Kind Kind   `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxEdits bounds the work done on a diff. Texts further apart than this are
+// reported as one deletion and one insertion of whatever differs.
+const maxEdits = 2000
+
+// Lines diffs a and b line by line, keeping line endings with each line
+func Lines(a, b string) []Edit {
+	return tokens(splitLines(a), splitLines(b))
+}
+
+// Words diffs a and b word by word. Runs of whitespace count as words so the
+// edits concatenate back into the original texts.
+func Words(a, b string) []Edit {
+	return tokens(splitWords(a), splitWords(b))
+}
+
+func splitLines(s string) []string {
+	return strings.SplitAfter(s, "\n")
+}
+
+func splitWords(s string) []string {
+	var words []string
+	start, space := 0, false
+	for i, r := range s {
+		if i > start && unicode.IsSpace(r) != space {
+			words = append(words, s[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// tokens diffs two token sequences with Myers' O(ND) algorithm and merges
+// adjacent edits of the same kind
+func tokens(a, b []string) []Edit {
+	// Common prefixes and suffixes need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for _, t := range a[:prefix] {
+		edits = appendEdit(edits, Equal, t)
+	}
+	for _, e := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		edits = appendEdit(edits, e.Kind, e.Text)
+	}
+	for _, t := range a[len(a)-suffix:] {
+		edits = appendEdit(edits, Equal, t)
+	}
+	return edits
+}
+
+func appendEdit(edits []Edit, kind Kind, text string) []Edit {
+	if text == "" {
+		return edits
+	}
+	if n := len(edits); n > 0 && edits[n-1].Kind == kind {
+		edits[n-1].Text += text
+		return edits
+	}
+	return append(edits, Edit{Kind: kind, Text: text})
+}
+
+// myers returns the shortest edit script from a to b, one token per edit
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	// v[k] is the furthest x reached on diagonal k = x - y. trace[d] keeps
+	// the diagonals -d+1..d-1 as they were before round d, for backtracking.
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		if d > 0 {
+			trace = append(trace, append([]int(nil), v[off-d+1:off+d]...))
+		} else {
+			trace = append(trace, nil)
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return []Edit{
+			{Kind: Delete, Text: strings.Join(a, "")},
+			{Kind: Insert, Text: strings.Join(b, "")},
+		}
+	}
+
+	var reversed []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Edit{Kind: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, Edit{Kind: Insert, Text: b[y-1]})
+		} else {
+			reversed = append(reversed, Edit{Kind: Delete, Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, Edit{Kind: Equal, Text: a[x-1]})
+		x--
+		y--
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
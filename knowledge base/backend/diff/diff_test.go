@@ -0,0 +1,80 @@
+package diff
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Edit
+	}{
+		{"", "", nil},
+		{"a\nb\nc\n", "a\nb\nc\n", []Edit{{Equal, "a\nb\nc\n"}}},
+		{"a\nb\nc\n", "a\nx\nc\n", []Edit{{Equal, "a\n"}, {Delete, "b\n"}, {Insert, "x\n"}, {Equal, "c\n"}}},
+		{"a\nb\n", "a\nb\nc", []Edit{{Equal, "a\nb\n"}, {Insert, "c"}}},
+		{"", "new\n", []Edit{{Insert, "new\n"}}},
+		{"old\n", "", []Edit{{Delete, "old\n"}}},
+		// A line gaining its line ending is a changed line
+		{"one\ntwo", "one\ntwo\n", []Edit{{Equal, "one\n"}, {Delete, "two"}, {Insert, "two\n"}}},
+	}
+	for _, tt := range tests {
+		got := Lines(tt.a, tt.b)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		checkEdits(t, tt.a, tt.b, got)
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Edit
+	}{
+		{"the quick fox", "the slow fox", []Edit{{Equal, "the "}, {Delete, "quick"}, {Insert, "slow"}, {Equal, " fox"}}},
+		{"a b", "a  b", []Edit{{Equal, "a"}, {Delete, " "}, {Insert, "  "}, {Equal, "b"}}},
+		{"hello", "hello world", []Edit{{Equal, "hello"}, {Insert, " world"}}},
+		{"x y z", "z", []Edit{{Delete, "x y "}, {Equal, "z"}}},
+	}
+	for _, tt := range tests {
+		got := Words(tt.a, tt.b)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Words(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		checkEdits(t, tt.a, tt.b, got)
+	}
+}
+
+func TestLinesBeyondMaxEdits(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < maxEdits+500; i++ {
+		a.WriteString("a" + strconv.Itoa(i) + "\n")
+		b.WriteString("b" + strconv.Itoa(i) + "\n")
+	}
+	checkEdits(t, a.String(), b.String(), Lines(a.String(), b.String()))
+}
+
+// checkEdits checks that the edits rebuild both texts and that no two
+// neighbouring edits are of the same kind
+func checkEdits(t *testing.T, a, b string, edits []Edit) {
+	t.Helper()
+	var gotA, gotB strings.Builder
+	for i, e := range edits {
+		if i > 0 && edits[i-1].Kind == e.Kind {
+			t.Errorf("edits %d and %d are both %s", i-1, i, e.Kind)
+		}
+		if e.Kind != Insert {
+			gotA.WriteString(e.Text)
+		}
+		if e.Kind != Delete {
+			gotB.WriteString(e.Text)
+		}
+	}
+	if gotA.String() != a || gotB.String() != b {
+		t.Errorf("edits rebuild %q and %q, want %q and %q", gotA.String(), gotB.String(), a, b)
+	}
+}
@@ -0,0 +1,151 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attachment is an import bundled with the notes that refer to it
+type Attachment struct {
+	ID       string
+	FileName string
+	MIMEType string
+	Size     int64
+	Open     func() (io.ReadCloser, error)
+}
+
+// Bundle is a set of notes exported as a ZIP with a file for each
+type Bundle struct {
+	Notes       []Source
+	Format      Format // the notes are written in
+	Attachments []Attachment
+}
+
+// bundleManifest is manifest.json in a ZIP bundle, telling which file holds
+// which note and import
+type bundleManifest struct {
+	CreatedAt time.Time        `json:"created_at"`
+	Format    string           `json:"format"`
+	Notes     []manifestNote   `json:"notes"`
+	Imports   []manifestImport `json:"imports"`
+}
+
+type manifestNote struct {
+	ID         primitive.ObjectID  `json:"id"`
+	Title      string              `json:"title"`
+	File       string              `json:"file"`
+	Format     string              `json:"format"` // of the note itself, plain or markdown
+	Tags       []string            `json:"tags"`
+	NotebookID *primitive.ObjectID `json:"notebook_id"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	Imports    []string            `json:"imports"` // IDs of the imports the note refers to
+}
+
+type manifestImport struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	File     string `json:"file"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// WriteZIP writes a bundle as a ZIP of the notes under notes/, the imports
+// they refer to under imports/, and manifest.json listing both. Files are
+// named after the note titles and import file names, numbered when two
+// would share a name.
+func WriteZIP(w io.Writer, b Bundle) error {
+	zw := zip.NewWriter(w)
+	taken := make(map[string]bool)
+	manifest := bundleManifest{
+		CreatedAt: time.Now().UTC(),
+		Format:    b.Format.Name,
+		Notes:     make([]manifestNote, 0, len(b.Notes)),
+		Imports:   make([]manifestImport, 0, len(b.Attachments)),
+	}
+
+	for _, src := range b.Notes {
+		file := uniqueName(taken, path.Join("notes", FileName(src.Note.Title, b.Format.Extension)))
+		f, err := zw.Create(file)
+		if err != nil {
+			return err
+		}
+		if err := b.Format.Write(f, src); err != nil {
+			return fmt.Errorf("note %s: %w", src.Note.ID.Hex(), err)
+		}
+		imports := src.ImportIDs()
+		if imports == nil {
+			imports = []string{}
+		}
+		manifest.Notes = append(manifest.Notes, manifestNote{
+			ID:         src.Note.ID,
+			Title:      src.Note.Title,
+			File:       file,
+			Format:     src.Note.Format,
+			Tags:       src.Note.Tags,
+			NotebookID: src.Note.NotebookID,
+			CreatedAt:  src.Note.CreatedAt,
+			UpdatedAt:  src.Note.UpdatedAt,
+			Imports:    imports,
+		})
+	}
+
+	for _, a := range b.Attachments {
+		file := uniqueName(taken, path.Join("imports", FileName(a.FileName, "")))
+		if err := writeAttachment(zw, file, a); err != nil {
+			return fmt.Errorf("import %s: %w", a.ID, err)
+		}
+		manifest.Imports = append(manifest.Imports, manifestImport{
+			ID:       a.ID,
+			FileName: a.FileName,
+			File:     file,
+			MIMEType: a.MIMEType,
+			Size:     a.Size,
+		})
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeAttachment(zw *zip.Writer, file string, a Attachment) error {
+	content, err := a.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	f, err := zw.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+// uniqueName returns name, numbered the way Rename numbers files if it is
+// taken already, and takes it. Names differing only in case count as the
+// same, as they would on some file systems.
+func uniqueName(taken map[string]bool, name string) string {
+	ext := path.Ext(name)
+	candidate := name
+	for n := 1; taken[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
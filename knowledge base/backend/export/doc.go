@@ -0,0 +1,276 @@
+package export
+
+import (
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/render"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// noteDetails are the lines shown under the title of an exported note: its
+// tags and dates
+func noteDetails(note models.Note) []string {
+	var lines []string
+	if len(note.Tags) > 0 {
+		lines = append(lines, "Tags: "+strings.Join(note.Tags, ", "))
+	}
+	dates := "Created " + note.FormattedDate()
+	if !note.UpdatedAt.IsZero() {
+		dates += "  ·  Updated " + note.UpdatedAt.Local().Format("January 2, 2006 15:04")
+	}
+	return append(lines, dates)
+}
+
+// The word processor formats lay a note out as a flat sequence of blocks,
+// which both DOCX and ODT map onto their own paragraphs, lists and tables.
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	codeBlock
+	ruleBlock
+	tableBlock
+)
+
+// block is a paragraph, heading, code block, rule or table of a note
+type block struct {
+	kind   blockKind
+	level  int      // of a heading
+	runs   []run    // the text of anything but a table
+	rows   [][]cell // of a table, the header row first
+	align  []string // of the table columns: "left", "center", "right" or "none"
+	quoted bool
+	depth  int      // how many lists the block is in
+	item   *docList // the list whose item the block starts, if it does
+}
+
+// cell is a cell of a table
+type cell []run
+
+// docList is a list of a note. Blocks starting its items refer to it.
+type docList struct {
+	id      int // counting the lists of the note from 1
+	ordered bool
+	start   int
+	depth   int
+}
+
+// run is a stretch of text in one style, or a line break
+type run struct {
+	text                       string
+	bold, italic, mono, strike bool
+	link                       string // only web and mail links are kept
+	lineBreak                  bool
+}
+
+// webLink tells whether url points outside the knowledge base, so that it
+// still works in a document
+func webLink(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "mailto:")
+}
+
+// flatten lays a note out as blocks. Plain notes have a paragraph per run of
+// non-blank lines.
+func flatten(src Source) []block {
+	if src.Tree == nil {
+		var blocks []block
+		content := strings.ReplaceAll(src.Note.Content, "\r\n", "\n")
+		for _, para := range strings.Split(content, "\n\n") {
+			para = strings.Trim(para, "\n")
+			if para == "" {
+				continue
+			}
+			var runs []run
+			for i, line := range strings.Split(para, "\n") {
+				if i > 0 {
+					runs = append(runs, run{lineBreak: true})
+				}
+				runs = append(runs, run{text: line})
+			}
+			blocks = append(blocks, block{kind: paragraphBlock, runs: runs})
+		}
+		return blocks
+	}
+	f := &flattener{source: src.Tree.Source}
+	f.blocks(src.Tree.Root)
+	return f.out
+}
+
+type flattener struct {
+	source []byte
+	out    []block
+	lists  int
+	depth  int
+	quoted bool
+	item   *docList // set until the block starting a list item is added
+}
+
+func (f *flattener) add(b block) {
+	b.depth, b.quoted = f.depth, f.quoted
+	if f.item != nil {
+		b.item = f.item
+		f.item = nil
+	}
+	f.out = append(f.out, b)
+}
+
+func (f *flattener) blocks(parent ast.Node) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		f.block(n)
+	}
+}
+
+func (f *flattener) block(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		f.add(block{kind: headingBlock, level: n.Level, runs: f.inlines(n, run{})})
+	case *ast.Paragraph, *ast.TextBlock:
+		f.add(block{kind: paragraphBlock, runs: f.inlines(n, run{})})
+	case *ast.List:
+		f.list(n)
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		f.add(block{kind: codeBlock, runs: f.code(n)})
+	case *ast.Blockquote:
+		saved := f.quoted
+		f.quoted = true
+		f.blocks(n)
+		f.quoted = saved
+	case *ast.ThematicBreak:
+		f.add(block{kind: ruleBlock})
+	case *east.Table:
+		f.table(n)
+	case *ast.HTMLBlock:
+		// Raw HTML is left out, as in the rendered HTML
+	default:
+		f.blocks(n)
+	}
+}
+
+func (f *flattener) list(l *ast.List) {
+	if f.item != nil {
+		// A list opening an item gets an empty line of its own to hang from
+		f.add(block{kind: paragraphBlock})
+	}
+	f.lists++
+	f.depth++
+	list := &docList{id: f.lists, ordered: l.IsOrdered(), start: l.Start, depth: f.depth}
+	for item := l.FirstChild(); item != nil; item = item.NextSibling() {
+		f.item = list
+		f.blocks(item)
+		if f.item != nil {
+			// An empty item
+			f.add(block{kind: paragraphBlock})
+		}
+	}
+	f.depth--
+}
+
+func (f *flattener) code(n ast.Node) []run {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		b.Write(segment.Value(f.source))
+	}
+	var runs []run
+	for i, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		if i > 0 {
+			runs = append(runs, run{lineBreak: true})
+		}
+		runs = append(runs, run{text: line, mono: true})
+	}
+	return runs
+}
+
+func (f *flattener) table(t *east.Table) {
+	b := block{kind: tableBlock}
+	for _, a := range t.Alignments {
+		b.align = append(b.align, a.String())
+	}
+	for row := t.FirstChild(); row != nil; row = row.NextSibling() {
+		style := run{bold: row.Kind() == east.KindTableHeader}
+		var cells []cell
+		for c := row.FirstChild(); c != nil; c = c.NextSibling() {
+			cells = append(cells, f.inlines(c, style))
+		}
+		for len(cells) < len(b.align) {
+			cells = append(cells, nil)
+		}
+		b.rows = append(b.rows, cells)
+	}
+	if len(b.align) > 0 {
+		f.add(b)
+	}
+}
+
+// inlines returns the text of the inline children of parent as runs in the
+// given style and the styles they add
+func (f *flattener) inlines(parent ast.Node, style run) []run {
+	var runs []run
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		runs = append(runs, f.inline(n, style)...)
+	}
+	return runs
+}
+
+func (f *flattener) inline(n ast.Node, style run) []run {
+	text := func(s string) []run {
+		style.text = s
+		return []run{style}
+	}
+	switch n := n.(type) {
+	case *ast.Text:
+		runs := text(string(n.Segment.Value(f.source)))
+		if n.HardLineBreak() {
+			runs = append(runs, run{lineBreak: true})
+		} else if n.SoftLineBreak() {
+			runs = append(runs, text(" ")...)
+		}
+		return runs
+	case *ast.String:
+		return text(string(n.Value))
+	case *ast.CodeSpan:
+		style.mono = true
+		return f.inlines(n, style)
+	case *ast.Emphasis:
+		if n.Level >= 2 {
+			style.bold = true
+		} else {
+			style.italic = true
+		}
+		return f.inlines(n, style)
+	case *east.Strikethrough:
+		style.strike = true
+		return f.inlines(n, style)
+	case *ast.Link:
+		if webLink(string(n.Destination)) {
+			style.link = string(n.Destination)
+		}
+		return f.inlines(n, style)
+	case *ast.AutoLink:
+		if url := string(n.URL(f.source)); webLink(url) {
+			style.link = url
+		}
+		return text(string(n.Label(f.source)))
+	case *render.Reference:
+		return text(n.Label)
+	case *ast.Image:
+		// Only the PDF and EPUB exports embed images
+		style.italic = true
+		return text("[" + render.Text(n, f.source) + "]")
+	case *east.TaskCheckBox:
+		if n.IsChecked {
+			return text("☑ ")
+		}
+		return text("☐ ")
+	case *ast.RawHTML:
+		// Left out, as in the rendered HTML
+		return nil
+	default:
+		return f.inlines(n, style)
+	}
+}
@@ -0,0 +1,319 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const docxMain = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+
+// docxParts are the fixed parts of a DOCX package
+var docxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+		`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+		`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+		`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+		`</Relationships>`},
+	{"word/styles.xml", xml.Header + `<w:styles ` + docxMain + `>` +
+		`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault>` +
+		`<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+		`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:spacing w:after="60"/></w:pPr><w:rPr><w:b/><w:sz w:val="44"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Subtitle"><w:name w:val="Subtitle"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0"/></w:pPr><w:rPr><w:color w:val="6E6E6E"/><w:sz w:val="18"/></w:rPr></w:style>` +
+		docxHeadingStyles() +
+		`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="40"/></w:pPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:pBdr><w:left w:val="single" w:sz="12" w:space="8" w:color="C8C8C8"/></w:pBdr><w:ind w:left="360"/></w:pPr><w:rPr><w:i/><w:color w:val="6E6E6E"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F4F4F4"/><w:spacing w:after="120" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="18"/></w:rPr></w:style>` +
+		`<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="1450AA"/><w:u w:val="single"/></w:rPr></w:style>` +
+		`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders>` +
+		`<w:top w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/><w:left w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/>` +
+		`<w:bottom w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/><w:right w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/>` +
+		`<w:insideH w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="BEBEBE"/>` +
+		`</w:tblBorders><w:tblCellMar><w:left w:w="80" w:type="dxa"/><w:right w:w="80" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+		`</w:styles>`},
+}
+
+// docxHeadingSizes are the font sizes of headings by level, in half points
+var docxHeadingSizes = [...]int{0, 40, 32, 28, 25, 23, 22}
+
+func docxHeadingStyles() string {
+	var b strings.Builder
+	for level := 1; level < len(docxHeadingSizes); level++ {
+		fmt.Fprintf(&b, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/>`+
+			`<w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>`,
+			level, level, level-1, docxHeadingSizes[level])
+	}
+	return b.String()
+}
+
+// docxBullets are the bullets of unordered lists by level
+var docxBullets = [...]string{"•", "◦", "▪"}
+
+// writeDOCX writes the note as a Word document: its title, tags and dates,
+// then the content with the headings, lists, quotes, code blocks, tables and
+// web links of markdown notes
+func writeDOCX(w io.Writer, src Source) error {
+	dw := &docxWriter{}
+	dw.body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr>`)
+	dw.runs([]run{{text: src.Note.Title}})
+	dw.body.WriteString(`</w:p>`)
+	details := noteDetails(src.Note)
+	for i, line := range details {
+		dw.body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Subtitle"/>`)
+		if i == len(details)-1 {
+			dw.body.WriteString(`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="4" w:color="C8C8C8"/></w:pBdr><w:spacing w:after="240"/>`)
+		}
+		dw.body.WriteString(`</w:pPr>`)
+		dw.runs([]run{{text: line}})
+		dw.body.WriteString(`</w:p>`)
+	}
+	for _, b := range flatten(src) {
+		dw.block(b)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, part := range docxParts {
+		if err := writeZipFile(zw, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	parts := []struct{ name, content string }{
+		{"word/_rels/document.xml.rels", dw.relationships()},
+		{"word/numbering.xml", dw.numbering()},
+		{"docProps/core.xml", docxCore(src)},
+		{"word/document.xml", xml.Header + `<w:document ` + docxMain +
+			` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>` +
+			dw.body.String() +
+			`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="709" w:footer="709" w:gutter="0"/></w:sectPr>` +
+			`</w:body></w:document>`},
+	}
+	for _, part := range parts {
+		if err := writeZipFile(zw, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+type docxWriter struct {
+	body  strings.Builder
+	links []string   // the targets of the hyperlink relationships, from rId2
+	lists []*docList // each numbered separately
+}
+
+func (dw *docxWriter) block(b block) {
+	if b.kind == tableBlock {
+		dw.table(b)
+		return
+	}
+	var props strings.Builder
+	switch {
+	case b.kind == headingBlock:
+		fmt.Fprintf(&props, `<w:pStyle w:val="Heading%d"/>`, min(b.level, len(docxHeadingSizes)-1))
+	case b.kind == codeBlock:
+		props.WriteString(`<w:pStyle w:val="Code"/>`)
+	case b.quoted:
+		props.WriteString(`<w:pStyle w:val="Quote"/>`)
+	case b.depth > 0:
+		props.WriteString(`<w:pStyle w:val="ListParagraph"/>`)
+	}
+	if b.item != nil {
+		fmt.Fprintf(&props, `<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, min(b.depth, 9)-1, dw.list(b.item))
+	}
+	if b.kind == ruleBlock {
+		props.WriteString(`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="C8C8C8"/></w:pBdr>`)
+	}
+	if b.item == nil && b.depth > 0 {
+		// The further paragraphs of a list item line up with its text
+		fmt.Fprintf(&props, `<w:ind w:left="%d"/>`, 720*min(b.depth, 9))
+	}
+	dw.body.WriteString(`<w:p>`)
+	if props.Len() > 0 {
+		dw.body.WriteString(`<w:pPr>` + props.String() + `</w:pPr>`)
+	}
+	dw.runs(b.runs)
+	dw.body.WriteString(`</w:p>`)
+}
+
+// list returns the numbering ID of a list, starting its numbering when its
+// first item is written
+func (dw *docxWriter) list(l *docList) int {
+	for i, seen := range dw.lists {
+		if seen == l {
+			return i + 1
+		}
+	}
+	dw.lists = append(dw.lists, l)
+	return len(dw.lists)
+}
+
+func (dw *docxWriter) table(b block) {
+	dw.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="5000" w:type="pct"/>`)
+	if b.depth > 0 {
+		fmt.Fprintf(&dw.body, `<w:tblInd w:w="%d" w:type="dxa"/>`, 720*min(b.depth, 9))
+	}
+	dw.body.WriteString(`<w:tblLook w:val="04A0" w:firstRow="1"/></w:tblPr><w:tblGrid>`)
+	for range b.align {
+		fmt.Fprintf(&dw.body, `<w:gridCol w:w="%d"/>`, 9638/len(b.align))
+	}
+	dw.body.WriteString(`</w:tblGrid>`)
+	for i, row := range b.rows {
+		dw.body.WriteString(`<w:tr>`)
+		if i == 0 {
+			dw.body.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+		}
+		for j, c := range row {
+			dw.body.WriteString(`<w:tc><w:tcPr><w:tcW w:w="0" w:type="auto"/>`)
+			if i == 0 {
+				dw.body.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="EEEEEE"/>`)
+			}
+			dw.body.WriteString(`</w:tcPr><w:p><w:pPr><w:spacing w:after="0"/>`)
+			if j < len(b.align) {
+				switch b.align[j] {
+				case "center":
+					dw.body.WriteString(`<w:jc w:val="center"/>`)
+				case "right":
+					dw.body.WriteString(`<w:jc w:val="right"/>`)
+				}
+			}
+			dw.body.WriteString(`</w:pPr>`)
+			dw.runs(c)
+			dw.body.WriteString(`</w:p></w:tc>`)
+		}
+		dw.body.WriteString(`</w:tr>`)
+	}
+	// Word needs a paragraph between a table and whatever follows it
+	dw.body.WriteString(`</w:tbl><w:p/>`)
+}
+
+func (dw *docxWriter) runs(runs []run) {
+	for _, r := range runs {
+		if r.lineBreak {
+			dw.body.WriteString(`<w:r><w:br/></w:r>`)
+			continue
+		}
+		if r.link != "" {
+			dw.links = append(dw.links, r.link)
+			fmt.Fprintf(&dw.body, `<w:hyperlink r:id="rId%d">`, len(dw.links)+1)
+		}
+		var props strings.Builder
+		if r.link != "" {
+			props.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+		}
+		if r.mono {
+			props.WriteString(`<w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/>`)
+		}
+		if r.bold {
+			props.WriteString(`<w:b/>`)
+		}
+		if r.italic {
+			props.WriteString(`<w:i/>`)
+		}
+		if r.strike {
+			props.WriteString(`<w:strike/>`)
+		}
+		dw.body.WriteString(`<w:r>`)
+		if props.Len() > 0 {
+			dw.body.WriteString(`<w:rPr>` + props.String() + `</w:rPr>`)
+		}
+		writeDOCXText(&dw.body, r.text)
+		dw.body.WriteString(`</w:r>`)
+		if r.link != "" {
+			dw.body.WriteString(`</w:hyperlink>`)
+		}
+	}
+}
+
+// relationships lists the styles, the numbering and the targets of the
+// hyperlinks of the document
+func (dw *docxWriter) relationships() string {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	for i, link := range dw.links {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" TargetMode="External" Target="`, i+2)
+		xml.EscapeText(&b, []byte(link))
+		b.WriteString(`"/>`)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>`, len(dw.links)+2)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// numbering defines a bulleted and a numbered list format, and numbers
+// each list of the document on its own so ordered lists start where the
+// note says
+func (dw *docxWriter) numbering() string {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<w:numbering ` + docxMain + `>`)
+	for abstract := 0; abstract < 2; abstract++ {
+		fmt.Fprintf(&b, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+		for level := 0; level < 9; level++ {
+			fmt.Fprintf(&b, `<w:lvl w:ilvl="%d"><w:start w:val="1"/>`, level)
+			if abstract == 0 {
+				b.WriteString(`<w:numFmt w:val="bullet"/><w:lvlText w:val="` + docxBullets[level%len(docxBullets)] + `"/>`)
+			} else {
+				fmt.Fprintf(&b, `<w:numFmt w:val="decimal"/><w:lvlText w:val="%%%d."/>`, level+1)
+			}
+			fmt.Fprintf(&b, `<w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`, 720*(level+1))
+		}
+		b.WriteString(`</w:abstractNum>`)
+	}
+	for i, l := range dw.lists {
+		abstract := 0
+		if l.ordered {
+			abstract = 1
+		}
+		fmt.Fprintf(&b, `<w:num w:numId="%d"><w:abstractNumId w:val="%d"/>`, i+1, abstract)
+		if l.ordered {
+			fmt.Fprintf(&b, `<w:lvlOverride w:ilvl="%d"><w:startOverride w:val="%d"/></w:lvlOverride>`, min(l.depth, 9)-1, l.start)
+		}
+		b.WriteString(`</w:num>`)
+	}
+	b.WriteString(`</w:numbering>`)
+	return b.String()
+}
+
+// docxCore gives the document the title, tags and dates of the note
+func docxCore(src Source) string {
+	note := src.Note
+	var b strings.Builder
+	b.WriteString(xml.Header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/"` +
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><dc:title>`)
+	xml.EscapeText(&b, []byte(note.Title))
+	b.WriteString(`</dc:title><cp:keywords>`)
+	xml.EscapeText(&b, []byte(strings.Join(note.Tags, ", ")))
+	b.WriteString(`</cp:keywords>`)
+	if !note.CreatedAt.IsZero() {
+		b.WriteString(`<dcterms:created xsi:type="dcterms:W3CDTF">` + note.CreatedAt.UTC().Format(time.RFC3339) + `</dcterms:created>`)
+	}
+	if !note.UpdatedAt.IsZero() {
+		b.WriteString(`<dcterms:modified xsi:type="dcterms:W3CDTF">` + note.UpdatedAt.UTC().Format(time.RFC3339) + `</dcterms:modified>`)
+	}
+	b.WriteString(`</cp:coreProperties>`)
+	return b.String()
+}
+
+// writeDOCXText writes s as the text of a run, keeping its spaces and tabs
+func writeDOCXText(b *strings.Builder, s string) {
+	for i, part := range strings.Split(s, "\t") {
+		if i > 0 {
+			b.WriteString(`<w:tab/>`)
+		}
+		b.WriteString(`<w:t xml:space="preserve">`)
+		xml.EscapeText(b, []byte(part))
+		b.WriteString(`</w:t>`)
+	}
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const epubMIMEType = "application/epub+zip"
+
+// epubContainer points reading systems at the package document
+const epubContainer = xml.Header + `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">` +
+	`<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>` +
+	`</container>`
+
+// epubStyle is the style sheet of every chapter
+const epubStyle = `body { font-family: serif; line-height: 1.45; }
+h1.title { margin-bottom: 0.2em; }
+p.details { margin: 0; color: #6e6e6e; font-size: 0.85em; }
+section > hr.details { margin: 0.8em 0 1.2em; }
+pre { background: #f4f4f4; padding: 0.5em; white-space: pre-wrap; font-size: 0.85em; }
+code { font-family: monospace; }
+blockquote { margin-left: 1em; padding-left: 0.8em; border-left: 3px solid #c8c8c8; color: #6e6e6e; font-style: italic; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #bebebe; padding: 0.2em 0.4em; }
+th { background: #eeeeee; }
+img { max-width: 100%; }
+.broken-link { color: #aa1414; }
+`
+
+// importContent matches the URL of the content of an import in rendered
+// notes, capturing the import ID
+var importContent = regexp.MustCompile(`^/imports/([0-9a-f]{24})/content$`)
+
+// epubImageTypes are the image formats embedded in books, by MIME type, with
+// the extension given to their files
+var epubImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// writeEPUB writes the note as a book of one chapter
+func writeEPUB(w io.Writer, src Source) error {
+	return WriteEPUB(w, Book{
+		ID:       "urn:knowledge-base:note:" + src.Note.ID.Hex(),
+		Title:    src.Note.Title,
+		Chapters: []Source{src},
+	})
+}
+
+// WriteEPUB writes an EPUB 3 book with a chapter for each note, under its
+// title, tags and dates. The contents list the chapters and their headings,
+// links between chapters lead from one to the other, and images shown from
+// imports are embedded. Links to notes outside the book and to imports are
+// kept as text only.
+func WriteEPUB(w io.Writer, book Book) error {
+	ew := &epubWriter{book: book, files: map[string]string{}, images: map[string]epubImage{}}
+	for i, ch := range book.Chapters {
+		ew.files["/notes/"+ch.Note.ID.Hex()] = fmt.Sprintf("chapter-%03d.xhtml", i+1)
+	}
+
+	ew.zw = zip.NewWriter(w)
+	if err := writeMimetype(ew.zw, epubMIMEType); err != nil {
+		return err
+	}
+	if err := writeZipFile(ew.zw, "META-INF/container.xml", epubContainer); err != nil {
+		return err
+	}
+	if err := writeZipFile(ew.zw, "OEBPS/style.css", epubStyle); err != nil {
+		return err
+	}
+	for _, ch := range book.Chapters {
+		if err := ew.chapter(ch); err != nil {
+			return err
+		}
+	}
+	if err := writeZipFile(ew.zw, "OEBPS/nav.xhtml", ew.nav()); err != nil {
+		return err
+	}
+	if err := writeZipFile(ew.zw, "OEBPS/content.opf", ew.pkg()); err != nil {
+		return err
+	}
+	return ew.zw.Close()
+}
+
+type epubWriter struct {
+	book   Book
+	zw     *zip.Writer
+	files  map[string]string    // chapter files by the path of their note
+	images map[string]epubImage // by import ID, the zero value if it cannot be shown
+	order  []string             // the IDs of the embedded images in the order written
+}
+
+// epubImage is an image embedded in a book
+type epubImage struct {
+	file, mimeType string
+}
+
+// chapter writes the chapter of a note
+func (ew *epubWriter) chapter(src Source) error {
+	body, err := toXHTML(src.Document.HTML, func(n *html.Node, url string) (string, bool) {
+		if n.DataAtom == atom.Img {
+			return ew.image(src, url)
+		}
+		if file, ok := ew.files[url]; ok {
+			return file, true
+		}
+		return url, webLink(url)
+	})
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header + `<!DOCTYPE html>` + "\n" +
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en"><head><title>`)
+	xml.EscapeText(&b, []byte(src.Note.Title))
+	b.WriteString(`</title><link rel="stylesheet" type="text/css" href="style.css"/></head><body><section epub:type="chapter"><h1 class="title">`)
+	xml.EscapeText(&b, []byte(src.Note.Title))
+	b.WriteString(`</h1>`)
+	for _, line := range noteDetails(src.Note) {
+		b.WriteString(`<p class="details">`)
+		xml.EscapeText(&b, []byte(line))
+		b.WriteString(`</p>`)
+	}
+	b.WriteString(`<hr class="details"/>` + body + `</section></body></html>`)
+	return writeZipFile(ew.zw, "OEBPS/"+ew.files["/notes/"+src.Note.ID.Hex()], b.String())
+}
+
+// image embeds the image from an import the first time a chapter shows it,
+// returning the file it is in
+func (ew *epubWriter) image(src Source, url string) (string, bool) {
+	m := importContent.FindStringSubmatch(url)
+	if m == nil || src.Images == nil {
+		return "", false
+	}
+	id := m[1]
+	if img, ok := ew.images[id]; ok {
+		return img.file, img.file != ""
+	}
+	ew.images[id] = epubImage{}
+
+	data, err := src.Images.Image(id)
+	if err != nil {
+		return "", false
+	}
+	mimeType := http.DetectContentType(data)
+	ext, ok := epubImageTypes[mimeType]
+	if !ok {
+		return "", false
+	}
+	img := epubImage{file: "images/" + id + ext, mimeType: mimeType}
+	f, err := ew.zw.Create("OEBPS/" + img.file)
+	if err != nil {
+		return "", false
+	}
+	if _, err := f.Write(data); err != nil {
+		return "", false
+	}
+	ew.images[id] = img
+	ew.order = append(ew.order, id)
+	return img.file, true
+}
+
+// nav is the navigation document: the chapters, each with its headings
+func (ew *epubWriter) nav() string {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<!DOCTYPE html>` + "\n" +
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en"><head><title>`)
+	xml.EscapeText(&b, []byte(ew.book.Title))
+	b.WriteString(`</title></head><body><nav epub:type="toc" id="toc"><h1>Contents</h1><ol>`)
+	for _, ch := range ew.book.Chapters {
+		file := ew.files["/notes/"+ch.Note.ID.Hex()]
+		b.WriteString(`<li><a href="` + file + `">`)
+		xml.EscapeText(&b, []byte(ch.Note.Title))
+		b.WriteString(`</a>`)
+		if len(ch.Document.TOC) > 0 {
+			b.WriteString(`<ol>`)
+			for _, h := range ch.Document.TOC {
+				b.WriteString(`<li><a href="` + file + `#`)
+				xml.EscapeText(&b, []byte(h.ID))
+				b.WriteString(`">`)
+				xml.EscapeText(&b, []byte(h.Text))
+				b.WriteString(`</a></li>`)
+			}
+			b.WriteString(`</ol>`)
+		}
+		b.WriteString(`</li>`)
+	}
+	b.WriteString(`</ol></nav></body></html>`)
+	return b.String()
+}
+
+// pkg is the package document: the metadata of the book, its files and the
+// order of the chapters
+func (ew *epubWriter) pkg() string {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="en">` +
+		`<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:identifier id="book-id">`)
+	xml.EscapeText(&b, []byte(ew.book.ID))
+	b.WriteString(`</dc:identifier><dc:title>`)
+	xml.EscapeText(&b, []byte(ew.book.Title))
+	b.WriteString(`</dc:title><dc:language>en</dc:language>`)
+	for _, tag := range ew.book.Tags() {
+		b.WriteString(`<dc:subject>`)
+		xml.EscapeText(&b, []byte(tag))
+		b.WriteString(`</dc:subject>`)
+	}
+	b.WriteString(`<meta property="dcterms:modified">` + ew.book.Modified().UTC().Format("2006-01-02T15:04:05Z") + `</meta></metadata><manifest>` +
+		`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` +
+		`<item id="style" href="style.css" media-type="text/css"/>`)
+	for i := range ew.book.Chapters {
+		fmt.Fprintf(&b, `<item id="chapter-%03d" href="chapter-%03d.xhtml" media-type="application/xhtml+xml"/>`, i+1, i+1)
+	}
+	for _, id := range ew.order {
+		img := ew.images[id]
+		fmt.Fprintf(&b, `<item id="image-%s" href="%s" media-type="%s"/>`, id, img.file, img.mimeType)
+	}
+	b.WriteString(`</manifest><spine>`)
+	for i := range ew.book.Chapters {
+		fmt.Fprintf(&b, `<itemref idref="chapter-%03d"/>`, i+1)
+	}
+	b.WriteString(`</spine></package>`)
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"io"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/render"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Source is what a note is exported from: the note, its content rendered as
+// HTML and, for markdown notes, parsed
+type Source struct {
+	Note     models.Note
+	Document render.Document
+	Tree     *render.Tree // nil for plain notes
+	Images   ImageLoader  // nil when imported images cannot be embedded
+	Fonts    *Fonts       // of PDFs, nil for the Go fonts
+}
+
+// ImportIDs lists the imports a markdown note links to or shows, each once
+func (src Source) ImportIDs() []string {
+	if src.Tree == nil {
+		return nil
+	}
+	var ids []string
+	ast.Walk(src.Tree.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if id, ok := render.ImportID(n); ok && entering && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		return ast.WalkContinue, nil
+	})
+	return ids
+}
+
+// Book is a set of notes exported as one document, with a chapter for each
+type Book struct {
+	ID       string // identifies the book to reading systems, such as a URN
+	Title    string
+	Chapters []Source
+	Fonts    *Fonts // of PDFs, nil for the Go fonts
+}
+
+// Modified is when a note of the book last changed, or now if never
+func (b Book) Modified() time.Time {
+	var modified time.Time
+	for _, ch := range b.Chapters {
+		for _, t := range []time.Time{ch.Note.CreatedAt, ch.Note.UpdatedAt} {
+			if t.After(modified) {
+				modified = t
+			}
+		}
+	}
+	if modified.IsZero() {
+		return time.Now()
+	}
+	return modified
+}
+
+// Tags lists the tags of the notes of the book, each once
+func (b Book) Tags() []string {
+	var tags []string
+	for _, ch := range b.Chapters {
+		for _, tag := range ch.Note.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// ImageLoader reads the content of the imports a note shows as images
+type ImageLoader interface {
+	Image(id string) ([]byte, error)
+}
+
+// Format is one kind of document a note can be exported as
+type Format struct {
+	Name      string // as given in ?format=
+	Extension string // with the dot, as in file names given to SaveFile
+	MIMEType  string
+	Write     func(w io.Writer, src Source) error
+}
+
+// formats are the export formats. Adding one here offers it both for
+// download and for SaveFile.
+var formats = []Format{
+	{"pdf", ".pdf", "application/pdf", writePDF},
+	{"txt", ".txt", "text/plain; charset=utf-8", writeText},
+	{"md", ".md", "text/markdown; charset=utf-8", writeMarkdown},
+	{"html", ".html", "text/html; charset=utf-8", writeHTML},
+	{"docx", ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", writeDOCX},
+	{"odt", ".odt", odtMIMEType, writeODT},
+	{"epub", ".epub", epubMIMEType, writeEPUB},
+}
+
+// Lookup returns the format with the given name
+func Lookup(name string) (Format, bool) {
+	for _, f := range formats {
+		if f.Name == strings.ToLower(name) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// ForExtension returns the format written to files with the extension ext
+func ForExtension(ext string) (Format, bool) {
+	for _, f := range formats {
+		if f.Extension == strings.ToLower(ext) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Names lists the names of the formats
+func Names() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// FileName makes a file name with the extension ext from a note title,
+// keeping letters, digits, spaces, dots, dashes and underscores
+func FileName(title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" -_.", r) {
+			return r
+		}
+		return '_'
+	}, title)
+	name = strings.Trim(name, " ._")
+	if name == "" {
+		name = "note"
+	}
+	return name + ext
+}
@@ -0,0 +1,204 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobStatus is how far a background export has got
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned for jobs that never existed or have expired
+	ErrJobNotFound = errors.New("export: job not found")
+	// ErrJobNotDone is returned when opening the file of an unfinished job
+	ErrJobNotDone = errors.New("export: job not done")
+	// ErrJobsFull is returned when too many jobs are queued or running to
+	// start another
+	ErrJobsFull = errors.New("export: too many jobs")
+)
+
+// jobSlots is how many jobs run at once. The rest wait their turn.
+const jobSlots = 2
+
+// Job is a document exported in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Status     JobStatus  `json:"status"`
+	Format     string     `json:"format"`
+	Notes      int        `json:"notes"`
+	FileName   string     `json:"file_name"`
+	MIMEType   string     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	path string // of the finished file
+}
+
+// Jobs runs exports in the background and keeps the files they write in
+// the temporary directory until ttl after they finish. At most limit jobs
+// are queued or running at once, and each runs for at most timeout.
+type Jobs struct {
+	ttl     time.Duration
+	limit   int
+	timeout time.Duration
+	slots   chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs returns a Jobs keeping finished jobs for ttl, with at most limit
+// unfinished jobs each given timeout to write its file
+func NewJobs(ttl time.Duration, limit int, timeout time.Duration) *Jobs {
+	return &Jobs{
+		ttl:     ttl,
+		limit:   limit,
+		timeout: timeout,
+		slots:   make(chan struct{}, jobSlots),
+		jobs:    make(map[string]*Job),
+	}
+}
+
+// Start queues a job that writes its file with write, and returns it. The
+// ID, status and creation time of job are filled in. The context passed to
+// write is cancelled once the job runs past its timeout. Start fails with
+// ErrJobsFull while the limit of unfinished jobs is reached.
+func (j *Jobs) Start(job Job, write func(context.Context, io.Writer) error) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.expire()
+	if j.pending() >= j.limit {
+		return job, ErrJobsFull
+	}
+
+	job.ID = primitive.NewObjectID().Hex()
+	job.Status = JobQueued
+	job.CreatedAt = time.Now().UTC()
+	j.jobs[job.ID] = &job
+	go j.run(&job, write)
+	return job, nil
+}
+
+// pending counts the jobs queued or running
+func (j *Jobs) pending() int {
+	n := 0
+	for _, job := range j.jobs {
+		if job.FinishedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (j *Jobs) run(job *Job, write func(context.Context, io.Writer) error) {
+	j.slots <- struct{}{}
+	defer func() { <-j.slots }()
+	j.mu.Lock()
+	job.Status = JobRunning
+	j.mu.Unlock()
+
+	// The deadline starts once the job runs, not while it waits its turn
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+	path, err := writeTemp(ctx, write)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status, job.Error = JobFailed, err.Error()
+		return
+	}
+	job.Status, job.path = JobDone, path
+}
+
+// writeTemp writes a temporary file with write and returns its path
+func writeTemp(ctx context.Context, write func(context.Context, io.Writer) error) (path string, err error) {
+	f, err := os.CreateTemp("", "kb-export-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// A failing export must not take the server down with it
+		if r := recover(); r != nil {
+			err = fmt.Errorf("export: %v", r)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err := write(ctx, contextWriter{ctx, f}); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// contextWriter fails writes once its context is done, stopping exports
+// that run out of time between reads of the store
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// Get returns the job with the given ID
+func (j *Jobs) Get(id string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.expire()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Open opens the file a finished job wrote
+func (j *Jobs) Open(id string) (*os.File, Job, error) {
+	job, err := j.Get(id)
+	if err != nil {
+		return nil, job, err
+	}
+	if job.Status != JobDone {
+		return nil, job, ErrJobNotDone
+	}
+	f, err := os.Open(job.path)
+	return f, job, err
+}
+
+// expire forgets the jobs that finished more than ttl ago and removes their
+// files. Files already opened stay readable until closed.
+func (j *Jobs) expire() {
+	for id, job := range j.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > j.ttl {
+			if job.path != "" {
+				os.Remove(job.path)
+			}
+			delete(j.jobs, id)
+		}
+	}
+}
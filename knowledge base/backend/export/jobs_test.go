@@ -0,0 +1,118 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// waitJob polls the job with the given ID until it finishes
+func waitJob(t *testing.T, j *Jobs, id string) Job {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		job, err := j.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", id, err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobsRun(t *testing.T) {
+	j := NewJobs(time.Hour, 4, time.Minute)
+	job, err := j.Start(Job{FileName: "n.zip"}, func(ctx context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, "bundle")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Status != JobQueued {
+		t.Errorf("Start = %+v, want a queued job with an ID", job)
+	}
+	if job = waitJob(t, j, job.ID); job.Status != JobDone {
+		t.Fatalf("status %s (%s), want %s", job.Status, job.Error, JobDone)
+	}
+	f, _, err := j.Open(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "bundle" {
+		t.Errorf("file holds %q, want %q", data, "bundle")
+	}
+
+	if _, err := j.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get(missing) = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestJobsFailure(t *testing.T) {
+	j := NewJobs(time.Hour, 4, time.Minute)
+	failing := map[string]func(context.Context, io.Writer) error{
+		"error": func(context.Context, io.Writer) error { return errors.New("broken") },
+		"panic": func(context.Context, io.Writer) error { panic("broken") },
+	}
+	for name, write := range failing {
+		job, err := j.Start(Job{}, write)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job = waitJob(t, j, job.ID); job.Status != JobFailed || job.Error == "" {
+			t.Errorf("%s: status %s, error %q, want a failed job", name, job.Status, job.Error)
+		}
+		if _, _, err := j.Open(job.ID); !errors.Is(err, ErrJobNotDone) {
+			t.Errorf("%s: Open = %v, want ErrJobNotDone", name, err)
+		}
+	}
+}
+
+func TestJobsLimit(t *testing.T) {
+	j := NewJobs(time.Hour, 3, time.Minute)
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, w io.Writer) error {
+		<-release
+		return nil
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		job, err := j.Start(Job{}, blocked)
+		if err != nil {
+			t.Fatalf("job %d: %v", i, err)
+		}
+		ids = append(ids, job.ID)
+	}
+	if _, err := j.Start(Job{}, blocked); !errors.Is(err, ErrJobsFull) {
+		t.Errorf("Start past the limit = %v, want ErrJobsFull", err)
+	}
+
+	close(release)
+	for _, id := range ids {
+		waitJob(t, j, id)
+	}
+	if _, err := j.Start(Job{}, blocked); err != nil {
+		t.Errorf("Start after the jobs finished = %v", err)
+	}
+}
+
+func TestJobsTimeout(t *testing.T) {
+	j := NewJobs(time.Hour, 1, 10*time.Millisecond)
+	job, err := j.Start(Job{}, func(ctx context.Context, w io.Writer) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitJob(t, j, job.ID); job.Status != JobFailed {
+		t.Errorf("status %s, want %s", job.Status, JobFailed)
+	}
+}
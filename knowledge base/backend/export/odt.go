@@ -0,0 +1,346 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	odtMIMEType = "application/vnd.oasis.opendocument.text"
+	odtVersion  = "1.3"
+	odtNS       = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+		` xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"` +
+		` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"` +
+		` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+		` xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0"` +
+		` xmlns:svg="urn:oasis:names:tc:opendocument:xmlns:svg-compatible:1.0"` +
+		` xmlns:xlink="http://www.w3.org/1999/xlink"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+		` xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0"` +
+		` office:version="` + odtVersion + `"`
+)
+
+// odtManifest lists the parts of an ODT package
+const odtManifest = xml.Header + `<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="` + odtVersion + `">` +
+	`<manifest:file-entry manifest:full-path="/" manifest:version="` + odtVersion + `" manifest:media-type="` + odtMIMEType + `"/>` +
+	`<manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>` +
+	`<manifest:file-entry manifest:full-path="styles.xml" manifest:media-type="text/xml"/>` +
+	`<manifest:file-entry manifest:full-path="meta.xml" manifest:media-type="text/xml"/>` +
+	`</manifest:manifest>`
+
+// odtFonts declares the fonts the styles refer to
+const odtFonts = `<office:font-face-decls>` +
+	`<style:font-face style:name="Sans" svg:font-family="'Liberation Sans'" style:font-family-generic="swiss" style:font-pitch="variable"/>` +
+	`<style:font-face style:name="Mono" svg:font-family="'Liberation Mono'" style:font-family-generic="modern" style:font-pitch="fixed"/>` +
+	`</office:font-face-decls>`
+
+// odtStyles are the named styles of an ODT document
+var odtStyles = xml.Header + `<office:document-styles ` + odtNS + `>` + odtFonts + `<office:styles>` +
+	`<style:default-style style:family="paragraph"><style:paragraph-properties fo:margin-bottom="0.2cm"/><style:text-properties style:font-name="Sans" fo:font-size="11pt"/></style:default-style>` +
+	`<style:style style:name="Standard" style:family="paragraph" style:class="text"/>` +
+	`<style:style style:name="Title" style:family="paragraph" style:parent-style-name="Standard" style:class="chapter"><style:paragraph-properties fo:margin-bottom="0.1cm"/><style:text-properties fo:font-size="22pt" fo:font-weight="bold"/></style:style>` +
+	`<style:style style:name="Subtitle" style:family="paragraph" style:parent-style-name="Standard" style:class="chapter"><style:paragraph-properties fo:margin-bottom="0cm"/><style:text-properties fo:font-size="9pt" fo:color="#6e6e6e"/></style:style>` +
+	odtHeadingStyles() +
+	`<style:style style:name="Quotations" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:margin-left="0.6cm" fo:padding-left="0.3cm" fo:border-left="1.5pt solid #c8c8c8"/><style:text-properties fo:font-style="italic" fo:color="#6e6e6e"/></style:style>` +
+	`<style:style style:name="Preformatted_20_Text" style:display-name="Preformatted Text" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:background-color="#f4f4f4" fo:padding="0.1cm"/><style:text-properties style:font-name="Mono" fo:font-size="9pt"/></style:style>` +
+	`<style:style style:name="Horizontal_20_Line" style:display-name="Horizontal Line" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:padding-bottom="0.05cm" fo:border-bottom="0.75pt solid #c8c8c8"/><style:text-properties fo:font-size="6pt"/></style:style>` +
+	`<style:style style:name="Table_20_Contents" style:display-name="Table Contents" style:family="paragraph" style:parent-style-name="Standard" style:class="extra"><style:paragraph-properties fo:margin-bottom="0cm"/><style:text-properties fo:font-size="10pt"/></style:style>` +
+	`<style:style style:name="Table_20_Heading" style:display-name="Table Heading" style:family="paragraph" style:parent-style-name="Table_20_Contents" style:class="extra"><style:text-properties fo:font-weight="bold"/></style:style>` +
+	`<style:style style:name="Internet_20_link" style:display-name="Internet link" style:family="text"><style:text-properties fo:color="#1450aa" style:text-underline-style="solid" style:text-underline-width="auto" style:text-underline-color="font-color"/></style:style>` +
+	odtListStyle("List_20_Bullet", "List Bullet", false) +
+	odtListStyle("List_20_Number", "List Number", true) +
+	`</office:styles></office:document-styles>`
+
+// odtHeadingSizes are the font sizes of headings by level, in points
+var odtHeadingSizes = [...]float64{0, 20, 16, 14, 12.5, 11.5, 11}
+
+func odtHeadingStyles() string {
+	var b strings.Builder
+	for level := 1; level < len(odtHeadingSizes); level++ {
+		fmt.Fprintf(&b, `<style:style style:name="Heading_20_%d" style:display-name="Heading %d" style:family="paragraph" style:parent-style-name="Standard" style:next-style-name="Standard" style:default-outline-level="%d" style:class="text">`+
+			`<style:paragraph-properties fo:margin-top="0.42cm" fo:margin-bottom="0.14cm" fo:keep-with-next="always"/><style:text-properties fo:font-size="%gpt" fo:font-weight="bold"/></style:style>`,
+			level, level, level, odtHeadingSizes[level])
+	}
+	return b.String()
+}
+
+// odtListStyle defines a bulleted or numbered list style of ten levels
+func odtListStyle(name, display string, numbered bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<text:list-style style:name="%s" style:display-name="%s">`, name, display)
+	for level := 1; level <= 10; level++ {
+		if numbered {
+			fmt.Fprintf(&b, `<text:list-level-style-number text:level="%d" style:num-suffix="." style:num-format="1">`, level)
+		} else {
+			fmt.Fprintf(&b, `<text:list-level-style-bullet text:level="%d" text:bullet-char="%s">`, level, docxBullets[(level-1)%len(docxBullets)])
+		}
+		fmt.Fprintf(&b, `<style:list-level-properties text:list-level-position-and-space-mode="label-alignment">`+
+			`<style:list-level-label-alignment text:label-followed-by="listtab" text:list-tab-stop-position="%.2fcm" fo:text-indent="-0.63cm" fo:margin-left="%.2fcm"/>`+
+			`</style:list-level-properties>`, 1.27*float64(level), 1.27*float64(level))
+		if numbered {
+			b.WriteString(`</text:list-level-style-number>`)
+		} else {
+			b.WriteString(`</text:list-level-style-bullet>`)
+		}
+	}
+	b.WriteString(`</text:list-style>`)
+	return b.String()
+}
+
+// odtAutomaticStyles are the styles content.xml applies directly: a text
+// style for each mix of bold, italic, monospace and struck out text, and
+// the styles of the title block and tables
+var odtAutomaticStyles = func() string {
+	var b strings.Builder
+	b.WriteString(`<office:automatic-styles>`)
+	for bits := 1; bits < 16; bits++ {
+		fmt.Fprintf(&b, `<style:style style:name="T%d" style:family="text"><style:text-properties`, bits)
+		if bits&1 != 0 {
+			b.WriteString(` fo:font-weight="bold"`)
+		}
+		if bits&2 != 0 {
+			b.WriteString(` fo:font-style="italic"`)
+		}
+		if bits&4 != 0 {
+			b.WriteString(` style:font-name="Mono"`)
+		}
+		if bits&8 != 0 {
+			b.WriteString(` style:text-line-through-style="solid"`)
+		}
+		b.WriteString(`/></style:style>`)
+	}
+	b.WriteString(`<style:style style:name="Details" style:family="paragraph" style:parent-style-name="Subtitle"><style:paragraph-properties fo:margin-bottom="0.5cm" fo:padding-bottom="0.1cm" fo:border-bottom="0.75pt solid #c8c8c8"/></style:style>` +
+		`<style:style style:name="Table" style:family="table"><style:table-properties style:width="17cm" table:align="margins" fo:margin-bottom="0.3cm"/></style:style>` +
+		`<style:style style:name="Cell" style:family="table-cell"><style:table-cell-properties fo:padding="0.1cm" fo:border="0.5pt solid #bebebe"/></style:style>` +
+		`<style:style style:name="HeadingCell" style:family="table-cell"><style:table-cell-properties fo:padding="0.1cm" fo:border="0.5pt solid #bebebe" fo:background-color="#eeeeee"/></style:style>`)
+	for _, align := range [][2]string{{"center", "center"}, {"right", "end"}} {
+		for _, parent := range []string{"Table_20_Contents", "Table_20_Heading"} {
+			fmt.Fprintf(&b, `<style:style style:name="%s_%s" style:family="paragraph" style:parent-style-name="%s"><style:paragraph-properties fo:text-align="%s"/></style:style>`,
+				parent, align[0], parent, align[1])
+		}
+	}
+	b.WriteString(`</office:automatic-styles>`)
+	return b.String()
+}()
+
+// writeODT writes the note as an OpenDocument text: its title, tags and
+// dates, then the content with the headings, lists, quotes, code blocks,
+// tables and web links of markdown notes
+func writeODT(w io.Writer, src Source) error {
+	ow := &odtWriter{}
+	ow.body.WriteString(`<text:p text:style-name="Title">`)
+	ow.runs([]run{{text: src.Note.Title}})
+	ow.body.WriteString(`</text:p>`)
+	details := noteDetails(src.Note)
+	for i, line := range details {
+		style := "Subtitle"
+		if i == len(details)-1 {
+			style = "Details"
+		}
+		ow.body.WriteString(`<text:p text:style-name="` + style + `">`)
+		ow.runs([]run{{text: line}})
+		ow.body.WriteString(`</text:p>`)
+	}
+	for _, b := range flatten(src) {
+		ow.block(b)
+	}
+	ow.closeLists(0)
+
+	zw := zip.NewWriter(w)
+	if err := writeMimetype(zw, odtMIMEType); err != nil {
+		return err
+	}
+	parts := []struct{ name, content string }{
+		{"META-INF/manifest.xml", odtManifest},
+		{"styles.xml", odtStyles},
+		{"meta.xml", odtMeta(src)},
+		{"content.xml", xml.Header + `<office:document-content ` + odtNS + `>` + odtFonts + odtAutomaticStyles +
+			`<office:body><office:text>` + ow.body.String() + `</office:text></office:body></office:document-content>`},
+	}
+	for _, part := range parts {
+		if err := writeZipFile(zw, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+type odtWriter struct {
+	body   strings.Builder
+	lists  []*docList // the lists open around the next block, outermost first
+	tables int
+}
+
+func (ow *odtWriter) block(b block) {
+	depth := b.depth
+	if b.kind == tableBlock {
+		// List items cannot hold tables, so the lists end before one
+		depth = 0
+	}
+	ow.closeLists(depth)
+	if b.item != nil && depth > 0 {
+		if len(ow.lists) == depth && ow.lists[depth-1] == b.item {
+			ow.body.WriteString(`</text:list-item><text:list-item>`)
+		} else {
+			ow.closeLists(depth - 1)
+			for len(ow.lists) < depth {
+				ow.openList(b.item)
+			}
+		}
+	}
+
+	switch b.kind {
+	case tableBlock:
+		ow.table(b)
+		return
+	case headingBlock:
+		level := min(b.level, len(odtHeadingSizes)-1)
+		fmt.Fprintf(&ow.body, `<text:h text:style-name="Heading_20_%d" text:outline-level="%d">`, level, level)
+		ow.runs(b.runs)
+		ow.body.WriteString(`</text:h>`)
+		return
+	}
+	style := "Standard"
+	switch {
+	case b.kind == codeBlock:
+		style = "Preformatted_20_Text"
+	case b.kind == ruleBlock:
+		style = "Horizontal_20_Line"
+	case b.quoted:
+		style = "Quotations"
+	}
+	ow.body.WriteString(`<text:p text:style-name="` + style + `">`)
+	ow.runs(b.runs)
+	ow.body.WriteString(`</text:p>`)
+}
+
+// openList opens a list and its first item
+func (ow *odtWriter) openList(l *docList) {
+	style := "List_20_Bullet"
+	if l.ordered {
+		style = "List_20_Number"
+	}
+	ow.body.WriteString(`<text:list text:style-name="` + style + `"><text:list-item`)
+	if l.ordered && l.start != 1 && len(ow.lists) == l.depth-1 {
+		fmt.Fprintf(&ow.body, ` text:start-value="%d"`, l.start)
+	}
+	ow.body.WriteString(`>`)
+	ow.lists = append(ow.lists, l)
+}
+
+// closeLists closes the open lists deeper than depth
+func (ow *odtWriter) closeLists(depth int) {
+	for len(ow.lists) > depth {
+		ow.body.WriteString(`</text:list-item></text:list>`)
+		ow.lists = ow.lists[:len(ow.lists)-1]
+	}
+}
+
+func (ow *odtWriter) table(b block) {
+	ow.tables++
+	fmt.Fprintf(&ow.body, `<table:table table:name="Table%d" table:style-name="Table"><table:table-column table:number-columns-repeated="%d"/>`, ow.tables, len(b.align))
+	for i, row := range b.rows {
+		cellStyle, paraStyle := "Cell", "Table_20_Contents"
+		if i == 0 {
+			cellStyle, paraStyle = "HeadingCell", "Table_20_Heading"
+			ow.body.WriteString(`<table:table-header-rows>`)
+		}
+		ow.body.WriteString(`<table:table-row>`)
+		for j, c := range row {
+			style := paraStyle
+			if j < len(b.align) && (b.align[j] == "center" || b.align[j] == "right") {
+				style += "_" + b.align[j]
+			}
+			ow.body.WriteString(`<table:table-cell table:style-name="` + cellStyle + `" office:value-type="string"><text:p text:style-name="` + style + `">`)
+			ow.runs(c)
+			ow.body.WriteString(`</text:p></table:table-cell>`)
+		}
+		ow.body.WriteString(`</table:table-row>`)
+		if i == 0 {
+			ow.body.WriteString(`</table:table-header-rows>`)
+		}
+	}
+	ow.body.WriteString(`</table:table>`)
+}
+
+func (ow *odtWriter) runs(runs []run) {
+	for _, r := range runs {
+		if r.lineBreak {
+			ow.body.WriteString(`<text:line-break/>`)
+			continue
+		}
+		if r.link != "" {
+			ow.body.WriteString(`<text:a xlink:type="simple" text:style-name="Internet_20_link" xlink:href="`)
+			xml.EscapeText(&ow.body, []byte(r.link))
+			ow.body.WriteString(`">`)
+		}
+		bits := 0
+		for i, set := range []bool{r.bold, r.italic, r.mono, r.strike} {
+			if set {
+				bits |= 1 << i
+			}
+		}
+		if bits != 0 {
+			fmt.Fprintf(&ow.body, `<text:span text:style-name="T%d">`, bits)
+		}
+		writeODTText(&ow.body, r.text, r.mono)
+		if bits != 0 {
+			ow.body.WriteString(`</text:span>`)
+		}
+		if r.link != "" {
+			ow.body.WriteString(`</text:a>`)
+		}
+	}
+}
+
+// writeODTText writes s as paragraph text, keeping its spaces and tabs.
+// ODF collapses runs of spaces, so they are written as counted spaces, as
+// are all the spaces of monospaced text.
+func writeODTText(b *strings.Builder, s string, mono bool) {
+	for s != "" {
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			xml.EscapeText(b, []byte(s))
+			return
+		}
+		xml.EscapeText(b, []byte(s[:i]))
+		s = s[i:]
+		if s[0] == '\t' {
+			b.WriteString(`<text:tab/>`)
+			s = s[1:]
+			continue
+		}
+		spaces := len(s) - len(strings.TrimLeft(s, " "))
+		if spaces == 1 && !mono {
+			b.WriteString(" ")
+		} else {
+			fmt.Fprintf(b, `<text:s text:c="%d"/>`, spaces)
+		}
+		s = s[spaces:]
+	}
+}
+
+// odtMeta gives the document the title, tags and dates of the note
+func odtMeta(src Source) string {
+	note := src.Note
+	var b strings.Builder
+	b.WriteString(xml.Header + `<office:document-meta ` + odtNS + `><office:meta><dc:title>`)
+	xml.EscapeText(&b, []byte(note.Title))
+	b.WriteString(`</dc:title>`)
+	for _, tag := range note.Tags {
+		b.WriteString(`<meta:keyword>`)
+		xml.EscapeText(&b, []byte(tag))
+		b.WriteString(`</meta:keyword>`)
+	}
+	if !note.CreatedAt.IsZero() {
+		b.WriteString(`<meta:creation-date>` + note.CreatedAt.UTC().Format("2006-01-02T15:04:05") + `</meta:creation-date>`)
+	}
+	if !note.UpdatedAt.IsZero() {
+		b.WriteString(`<dc:date>` + note.UpdatedAt.UTC().Format("2006-01-02T15:04:05") + `</dc:date>`)
+	}
+	b.WriteString(`</office:meta></office:document-meta>`)
+	return b.String()
+}
@@ -0,0 +1,785 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"knowledge_base_backend/render"
+	"knowledge_base_backend/thumbnail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	_ "golang.org/x/image/webp"
+)
+
+// Page layout of exported PDFs, in millimetres and points
+const (
+	pdfMargin     = 20.0
+	pdfIndent     = 6.0 // per level of lists and quotes
+	pdfBodySize   = 11.0
+	pdfCodeSize   = 9.0
+	pdfLineFactor = 1.45 // line height as a multiple of the font size
+	pdfImageDPI   = 96.0 // images are shown at this resolution unless too large
+)
+
+// pdfFonts are the TrueType fonts embedded in every PDF unless Fonts replace
+// them. The Go fonts cover Latin, Greek and Cyrillic text.
+var pdfFonts = []struct {
+	family, style string
+	ttf           []byte
+}{
+	{"go", "", goregular.TTF},
+	{"go", "B", gobold.TTF},
+	{"go", "I", goitalic.TTF},
+	{"go", "BI", gobolditalic.TTF},
+	{"gomono", "", gomono.TTF},
+	{"gomono", "B", gomonobold.TTF},
+}
+
+// Fonts are TrueType fonts to write PDFs in instead of the Go fonts, such as
+// ones covering CJK, Arabic or Hebrew text, by face. Faces left nil use the
+// nearest face given, falling back to Regular, or the Go font when there is
+// no Regular either.
+type Fonts struct {
+	Regular, Bold, Italic, BoldItalic, Mono, MonoBold []byte
+}
+
+// FontFiles names the TrueType files of Fonts by face. Empty names are left
+// out.
+type FontFiles struct {
+	Regular, Bold, Italic, BoldItalic, Mono, MonoBold string
+}
+
+// LoadFonts reads the font files named, checking that PDFs can embed them.
+// It returns nil when none are.
+func LoadFonts(files FontFiles) (*Fonts, error) {
+	var fonts Fonts
+	loaded := false
+	for _, face := range []struct {
+		name string
+		path string
+		ttf  *[]byte
+	}{
+		{"regular", files.Regular, &fonts.Regular},
+		{"bold", files.Bold, &fonts.Bold},
+		{"italic", files.Italic, &fonts.Italic},
+		{"bold italic", files.BoldItalic, &fonts.BoldItalic},
+		{"mono", files.Mono, &fonts.Mono},
+		{"mono bold", files.MonoBold, &fonts.MonoBold},
+	} {
+		if face.path == "" {
+			continue
+		}
+		ttf, err := os.ReadFile(face.path)
+		if err != nil {
+			return nil, fmt.Errorf("export: %s font: %w", face.name, err)
+		}
+		if err := checkFont(ttf); err != nil {
+			return nil, fmt.Errorf("export: %s font %s: %w", face.name, face.path, err)
+		}
+		*face.ttf, loaded = ttf, true
+	}
+	if !loaded {
+		return nil, nil
+	}
+	return &fonts, nil
+}
+
+// checkFont writes a PDF in the font to see that it can be embedded. The
+// PDF library leaves fonts it cannot read out without an error.
+func checkFont(ttf []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unreadable font: %v", r)
+		}
+	}()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("check", "", ttf)
+	pdf.AddPage()
+	pdf.SetFont("check", "", 10)
+	if pdf.Error() != nil {
+		return errors.New("not a TrueType font")
+	}
+	pdf.Write(5, "Aa")
+	return pdf.Output(io.Discard)
+}
+
+// faces returns the font of each face in the order of pdfFonts. A nil Fonts
+// gives the Go fonts.
+func (f *Fonts) faces() [][]byte {
+	ttfs := make([][]byte, len(pdfFonts))
+	for i, font := range pdfFonts {
+		ttfs[i] = font.ttf
+	}
+	if f == nil {
+		return ttfs
+	}
+	// The faces to try for each, nearest first
+	for i, candidates := range [][][]byte{
+		{f.Regular},
+		{f.Bold, f.Regular},
+		{f.Italic, f.Regular},
+		{f.BoldItalic, f.Bold, f.Italic, f.Regular},
+		{f.Mono, f.Regular},
+		{f.MonoBold, f.Mono, f.Bold, f.Regular},
+	} {
+		for _, ttf := range candidates {
+			if ttf != nil {
+				ttfs[i] = ttf
+				break
+			}
+		}
+	}
+	return ttfs
+}
+
+// pdfHeadingSizes are the font sizes of headings by level
+var pdfHeadingSizes = [...]float64{0, 20, 16, 14, 12.5, 11.5, 11}
+
+var (
+	pdfTextColor  = [3]int{0, 0, 0}
+	pdfMutedColor = [3]int{110, 110, 110}
+	pdfLinkColor  = [3]int{20, 80, 170}
+)
+
+// writePDF writes the note on A4 pages under a header with its title, tags
+// and dates, numbering the pages. Markdown notes keep their headings, lists,
+// quotes, code blocks, tables and the images they show from imports.
+func writePDF(w io.Writer, src Source) error {
+	pdf := newPDF(src.Fonts, src.Note.Title, src.Note.Tags, src.Note.CreatedAt, src.Note.UpdatedAt)
+	newPDFWriter(pdf, make(pdfImageCache)).note(src, 0)
+	return pdf.Output(w)
+}
+
+// WriteCombinedPDF writes the notes of a book one after the other, each
+// starting on a new page as writePDF lays it out, behind a table of contents
+// listing and linking to them. The outline holds the notes with their
+// headings below them, and links between the notes lead from one to the
+// other.
+func WriteCombinedPDF(w io.Writer, book Book) error {
+	// The contents come first, so the book is laid out once to find the
+	// pages the notes start on, then again with them. The images are read
+	// and decoded once for both.
+	starts := make([]int, len(book.Chapters))
+	loaded := make(pdfImageCache)
+	pdf := layoutCombinedPDF(book, starts, loaded)
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	return layoutCombinedPDF(book, starts, loaded).Output(w)
+}
+
+// layoutCombinedPDF lays a book out, listing the notes in the contents as
+// starting on the given pages and recording the pages they do start on
+func layoutCombinedPDF(book Book, starts []int, loaded pdfImageCache) *gofpdf.Fpdf {
+	modified := book.Modified()
+	pdf := newPDF(book.Fonts, book.Title, book.Tags(), modified, modified)
+	pw := newPDFWriter(pdf, loaded)
+	pw.outline = 1
+	pw.noteLinks = make(map[string]int, len(book.Chapters))
+	links := make([]int, len(book.Chapters))
+	for i, ch := range book.Chapters {
+		links[i] = pdf.AddLink()
+		pw.noteLinks["/notes/"+ch.Note.ID.Hex()] = links[i]
+	}
+
+	pw.contents(book, starts, links)
+	for i, ch := range book.Chapters {
+		pw.note(ch, links[i])
+		starts[i] = pw.titlePage
+	}
+	return pdf
+}
+
+// newPDF starts an A4 document with the fonts and page layout of exports
+func newPDF(fonts *Fonts, title string, tags []string, created, modified time.Time) *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	for i, ttf := range fonts.faces() {
+		pdf.AddUTF8FontFromBytes(pdfFonts[i].family, pdfFonts[i].style, ttf)
+	}
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(title, true)
+	pdf.SetKeywords(strings.Join(tags, " "), true)
+	pdf.SetCreationDate(created)
+	pdf.SetModificationDate(modified)
+	pdf.AliasNbPages("{nb}")
+	return pdf
+}
+
+// pdfWriter lays out notes. It tracks the text style the markdown being
+// walked calls for.
+type pdfWriter struct {
+	pdf    *gofpdf.Fpdf
+	src    Source
+	source []byte
+
+	size         float64
+	bold, italic bool
+	mono         bool
+	color        [3]int
+	link         string  // URL of the link being written, if any
+	indent       float64 // beyond the left margin
+	bookmark     int     // level of the last heading bookmarked, -1 for none
+
+	outline    int            // outline level of the top headings of a note
+	noteLinks  map[string]int // link IDs of the notes in the document, by path
+	titlePage  int            // page of the title block of the current note
+	inContents bool
+
+	images map[string]pdfImage // registered in pdf, by import ID
+	loaded pdfImageCache
+}
+
+func newPDFWriter(pdf *gofpdf.Fpdf, loaded pdfImageCache) *pdfWriter {
+	pw := &pdfWriter{pdf: pdf, images: make(map[string]pdfImage), loaded: loaded}
+	pdf.SetHeaderFuncMode(pw.header, true)
+	pdf.SetFooterFunc(pw.footer)
+	return pw
+}
+
+// note writes a note from a new page, making it the destination of the
+// internal link given, if any
+func (pw *pdfWriter) note(src Source, link int) {
+	pw.src, pw.source = src, nil
+	pw.size, pw.color, pw.bookmark = pdfBodySize, pdfTextColor, pw.outline-1
+	pw.titlePage = pw.pdf.PageNo() + 1
+	pw.pdf.AddPage()
+	if link != 0 {
+		pw.pdf.SetLink(link, 0, -1)
+	}
+	if pw.outline > 0 {
+		pw.pdf.Bookmark(src.Note.Title, 0, -1)
+		pw.bookmark = 0
+	}
+	pw.titleBlock()
+
+	if src.Tree != nil {
+		pw.source = src.Tree.Source
+		pw.blocks(src.Tree.Root)
+	} else {
+		pw.font()
+		pw.pdf.Write(pw.lineHeight(), strings.ReplaceAll(src.Note.Content, "\r\n", "\n"))
+	}
+}
+
+// contents writes the title of a book and lists its notes with the pages
+// they start on, each linking to its note
+func (pw *pdfWriter) contents(book Book, starts, links []int) {
+	pw.inContents = true
+	defer func() { pw.inContents = false }()
+	pdf := pw.pdf
+	pdf.AddPage()
+	pdf.SetFont("go", "B", 22)
+	pdf.SetTextColor(pdfTextColor[0], pdfTextColor[1], pdfTextColor[2])
+	pdf.MultiCell(0, pdf.PointConvert(22)*1.3, book.Title, "", "L", false)
+	pdf.SetFont("go", "", 9)
+	pdf.SetTextColor(pdfMutedColor[0], pdfMutedColor[1], pdfMutedColor[2])
+	pdf.MultiCell(0, pdf.PointConvert(9)*pdfLineFactor, fmt.Sprintf("%d notes", len(book.Chapters)), "", "L", false)
+	pdf.Ln(2)
+	pw.rule()
+	pdf.Ln(4)
+
+	pdf.SetFont("go", "B", pdfHeadingSizes[2])
+	pdf.SetTextColor(pdfTextColor[0], pdfTextColor[1], pdfTextColor[2])
+	pdf.MultiCell(0, pdf.PointConvert(pdfHeadingSizes[2])*pdfLineFactor, "Contents", "", "L", false)
+	pdf.SetFont("go", "", pdfBodySize)
+	lh := pdf.PointConvert(pdfBodySize) * pdfLineFactor
+	width := pw.textWidth()
+	const pageWidth = 15.0
+	for i, ch := range book.Chapters {
+		pdf.CellFormat(width-pageWidth, lh, fitText(pdf, ch.Note.Title, width-pageWidth-2), "", 0, "L", false, links[i], "")
+		pdf.CellFormat(pageWidth, lh, strconv.Itoa(starts[i]), "", 1, "R", false, links[i], "")
+	}
+}
+
+// fitText shortens s with an ellipsis until it fits width in the current
+// font
+func fitText(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdf.GetStringWidth(string(r)+"…") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
+
+// pdfImageData is an image import ready to embed: a JPEG, or a PNG converted
+// from another format
+type pdfImageData struct {
+	data          []byte
+	imageType     string // as gofpdf names it
+	width, height int
+}
+
+// pdfImageCache holds the image imports read for a document by ID, nil for
+// those that cannot be shown, so laying it out again reads none twice
+type pdfImageCache map[string]*pdfImageData
+
+// pdfImage is an image registered in the PDF, with its size in pixels. Its
+// name is empty when the import cannot be shown.
+type pdfImage struct {
+	name          string
+	width, height int
+}
+
+// header repeats the title of the note at the top of its pages but the
+// first, which has the full title block
+func (pw *pdfWriter) header() {
+	if pw.inContents || pw.pdf.PageNo() == pw.titlePage {
+		return
+	}
+	pw.pdf.SetFont("go", "", 8)
+	pw.pdf.SetTextColor(pdfMutedColor[0], pdfMutedColor[1], pdfMutedColor[2])
+	pw.pdf.SetXY(pdfMargin, pdfMargin/2)
+	width, _ := pw.pdf.GetPageSize()
+	pw.pdf.CellFormat(width-2*pdfMargin, 5, pw.src.Note.Title, "B", 0, "L", false, 0, "")
+}
+
+// footer numbers the pages
+func (pw *pdfWriter) footer() {
+	pw.pdf.SetY(-pdfMargin / 1.5)
+	pw.pdf.SetFont("go", "", 8)
+	pw.pdf.SetTextColor(pdfMutedColor[0], pdfMutedColor[1], pdfMutedColor[2])
+	pw.pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pw.pdf.PageNo()), "", 0, "C", false, 0, "")
+}
+
+// titleBlock writes the title, then the tags and dates under it
+func (pw *pdfWriter) titleBlock() {
+	note := pw.src.Note
+	pw.pdf.SetFont("go", "B", 22)
+	pw.pdf.SetTextColor(pdfTextColor[0], pdfTextColor[1], pdfTextColor[2])
+	pw.pdf.MultiCell(0, pw.pdf.PointConvert(22)*1.3, note.Title, "", "L", false)
+
+	pw.pdf.SetFont("go", "", 9)
+	pw.pdf.SetTextColor(pdfMutedColor[0], pdfMutedColor[1], pdfMutedColor[2])
+	lh := pw.pdf.PointConvert(9) * pdfLineFactor
+	for _, line := range noteDetails(note) {
+		pw.pdf.MultiCell(0, lh, line, "", "L", false)
+	}
+
+	pw.pdf.Ln(2)
+	pw.rule()
+	pw.pdf.Ln(4)
+}
+
+// rule draws a line across the text width
+func (pw *pdfWriter) rule() {
+	width, _ := pw.pdf.GetPageSize()
+	y := pw.pdf.GetY()
+	pw.pdf.SetDrawColor(200, 200, 200)
+	pw.pdf.Line(pdfMargin+pw.indent, y, width-pdfMargin, y)
+}
+
+// font selects the font for the current style
+func (pw *pdfWriter) font() {
+	family, style := "go", ""
+	if pw.bold {
+		style += "B"
+	}
+	if pw.mono {
+		family = "gomono"
+	} else if pw.italic {
+		style += "I"
+	}
+	pw.pdf.SetFont(family, style, pw.size)
+	color := pw.color
+	if pw.link != "" {
+		color = pdfLinkColor
+	}
+	pw.pdf.SetTextColor(color[0], color[1], color[2])
+}
+
+func (pw *pdfWriter) lineHeight() float64 {
+	return pw.pdf.PointConvert(pw.size) * pdfLineFactor
+}
+
+// setIndent moves the left margin to the current indent
+func (pw *pdfWriter) setIndent() {
+	pw.pdf.SetLeftMargin(pdfMargin + pw.indent)
+	pw.pdf.SetX(pdfMargin + pw.indent)
+}
+
+// textWidth is the width left for text at the current indent
+func (pw *pdfWriter) textWidth() float64 {
+	width, _ := pw.pdf.GetPageSize()
+	return width - 2*pdfMargin - pw.indent
+}
+
+// ensureSpace starts a new page unless h more millimetres fit on this one
+func (pw *pdfWriter) ensureSpace(h float64) {
+	_, height := pw.pdf.GetPageSize()
+	if pw.pdf.GetY()+h > height-pdfMargin {
+		pw.pdf.AddPage()
+		pw.setIndent()
+	}
+}
+
+// endBlock ends the line being written and leaves space after the block
+func (pw *pdfWriter) endBlock(space float64) {
+	pw.pdf.Ln(pw.lineHeight())
+	pw.pdf.Ln(space)
+}
+
+func (pw *pdfWriter) blocks(parent ast.Node) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		pw.block(n)
+	}
+}
+
+func (pw *pdfWriter) block(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		pw.heading(n)
+	case *ast.Paragraph:
+		pw.inlines(n)
+		pw.endBlock(pw.lineHeight() * 0.4)
+	case *ast.TextBlock:
+		// The text of a tight list item
+		pw.inlines(n)
+		pw.endBlock(0)
+	case *ast.List:
+		pw.list(n)
+	case *ast.FencedCodeBlock:
+		pw.code(n)
+	case *ast.CodeBlock:
+		pw.code(n)
+	case *ast.Blockquote:
+		pw.quote(n)
+	case *ast.ThematicBreak:
+		pw.pdf.Ln(2)
+		pw.rule()
+		pw.pdf.Ln(4)
+	case *east.Table:
+		pw.table(n)
+	case *ast.HTMLBlock:
+		// Raw HTML is left out, as in the rendered HTML
+	default:
+		pw.blocks(n)
+	}
+}
+
+func (pw *pdfWriter) heading(n *ast.Heading) {
+	size := pdfHeadingSizes[min(n.Level, len(pdfHeadingSizes)-1)]
+	saved := pw.size
+	pw.size, pw.bold = size, true
+	pw.pdf.Ln(pw.lineHeight() * 0.3)
+	// Keep a heading with the first lines below it
+	pw.ensureSpace(pw.lineHeight() + 3*pdfBodySize*pdfLineFactor*25.4/72)
+
+	// Outline levels may only go one deeper at a time
+	level := min(pw.outline+n.Level-1, pw.bookmark+1)
+	pw.pdf.Bookmark(render.Text(n, pw.source), level, -1)
+	pw.bookmark = level
+
+	pw.inlines(n)
+	pw.endBlock(pw.lineHeight() * 0.2)
+	pw.size, pw.bold = saved, false
+}
+
+func (pw *pdfWriter) list(l *ast.List) {
+	number := l.Start
+	for item := l.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "•"
+		if l.IsOrdered() {
+			marker = fmt.Sprintf("%d%c", number, l.Marker)
+			number++
+		}
+		pw.setIndent()
+		pw.font()
+		pw.pdf.Write(pw.lineHeight(), marker)
+
+		pw.indent += pdfIndent
+		pw.pdf.SetLeftMargin(pdfMargin + pw.indent)
+		pw.pdf.SetX(pdfMargin + pw.indent)
+		pw.blocks(item)
+		pw.indent -= pdfIndent
+		pw.setIndent()
+	}
+	if l.Parent() == nil || l.Parent().Kind() != ast.KindListItem {
+		pw.pdf.Ln(pw.lineHeight() * 0.4)
+	}
+}
+
+func (pw *pdfWriter) quote(n *ast.Blockquote) {
+	saved := pw.color
+	pw.indent += pdfIndent
+	pw.color, pw.italic = pdfMutedColor, true
+	pw.setIndent()
+	top := pw.pdf.GetY()
+	pw.blocks(n)
+	if pw.pdf.GetY() > top {
+		pw.pdf.SetDrawColor(200, 200, 200)
+		pw.pdf.Line(pdfMargin+pw.indent-pdfIndent/2, top, pdfMargin+pw.indent-pdfIndent/2, pw.pdf.GetY()-pw.lineHeight()*0.4)
+	}
+	pw.indent -= pdfIndent
+	pw.color, pw.italic = saved, false
+	pw.setIndent()
+}
+
+func (pw *pdfWriter) code(n ast.Node) {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		b.Write(segment.Value(pw.source))
+	}
+	text := strings.ReplaceAll(strings.TrimRight(b.String(), "\n"), "\t", "    ")
+
+	saved := pw.size
+	pw.size, pw.mono = pdfCodeSize, true
+	pw.font()
+	pw.setIndent()
+	pw.pdf.SetFillColor(244, 244, 244)
+	pw.pdf.MultiCell(pw.textWidth(), pw.lineHeight(), text, "", "L", true)
+	pw.size, pw.mono = saved, false
+	pw.pdf.Ln(pw.lineHeight() * 0.6)
+}
+
+// table lays the cells of a table out in columns of equal width, wrapping
+// their text
+func (pw *pdfWriter) table(t *east.Table) {
+	columns := len(t.Alignments)
+	if columns == 0 {
+		return
+	}
+	pw.setIndent()
+	width := pw.textWidth() / float64(columns)
+	saved := pw.size
+	pw.size = pdfBodySize - 1
+	lh := pw.lineHeight()
+
+	for row := t.FirstChild(); row != nil; row = row.NextSibling() {
+		header := row.Kind() == east.KindTableHeader
+		pw.bold = header
+		pw.font()
+
+		var cells []string
+		lines := 1
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			text := render.Text(cell, pw.source)
+			cells = append(cells, text)
+			lines = max(lines, len(pw.pdf.SplitText(text, width-2)))
+		}
+		height := float64(lines)*lh + 2
+		pw.ensureSpace(height)
+
+		x, y := pdfMargin+pw.indent, pw.pdf.GetY()
+		for i := 0; i < columns; i++ {
+			var text string
+			if i < len(cells) {
+				text = cells[i]
+			}
+			align := "L"
+			switch t.Alignments[i] {
+			case east.AlignCenter:
+				align = "C"
+			case east.AlignRight:
+				align = "R"
+			}
+			pw.pdf.SetDrawColor(190, 190, 190)
+			pw.pdf.SetFillColor(238, 238, 238)
+			style := "D"
+			if header {
+				style = "FD"
+			}
+			pw.pdf.Rect(x+float64(i)*width, y, width, height, style)
+			pw.pdf.SetXY(x+float64(i)*width, y+1)
+			pw.pdf.MultiCell(width, lh, text, "", align, false)
+		}
+		pw.pdf.SetXY(x, y+height)
+	}
+	pw.size, pw.bold = saved, false
+	pw.pdf.Ln(lh * 0.6)
+}
+
+func (pw *pdfWriter) inlines(parent ast.Node) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		pw.inline(n)
+	}
+}
+
+func (pw *pdfWriter) inline(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Text:
+		pw.write(string(n.Segment.Value(pw.source)))
+		if n.HardLineBreak() {
+			pw.pdf.Ln(pw.lineHeight())
+		} else if n.SoftLineBreak() {
+			pw.write(" ")
+		}
+	case *ast.String:
+		pw.write(string(n.Value))
+	case *ast.CodeSpan:
+		saved := pw.mono
+		pw.mono = true
+		pw.inlines(n)
+		pw.mono = saved
+	case *ast.Emphasis:
+		saved := [2]bool{pw.bold, pw.italic}
+		if n.Level >= 2 {
+			pw.bold = true
+		} else {
+			pw.italic = true
+		}
+		pw.inlines(n)
+		pw.bold, pw.italic = saved[0], saved[1]
+	case *ast.Link:
+		pw.linked(string(n.Destination), func() { pw.inlines(n) })
+	case *ast.AutoLink:
+		url := string(n.URL(pw.source))
+		pw.linked(url, func() { pw.write(string(n.Label(pw.source))) })
+	case *render.Reference:
+		pw.linked(n.Href, func() { pw.write(n.Label) })
+	case *ast.Image:
+		pw.image(n)
+	case *east.TaskCheckBox:
+		if n.IsChecked {
+			pw.write("[x] ")
+		} else {
+			pw.write("[ ] ")
+		}
+	case *ast.RawHTML:
+		// Left out, as in the rendered HTML
+	default:
+		pw.inlines(n)
+	}
+}
+
+// linked writes what write writes as a link to url. Web and mail links, and
+// links to notes in the same document, are clickable; other links to notes
+// and imports are coloured like them.
+func (pw *pdfWriter) linked(url string, write func()) {
+	saved := pw.link
+	pw.link = url
+	write()
+	pw.link = saved
+}
+
+func (pw *pdfWriter) write(s string) {
+	pw.font()
+	if id, ok := pw.noteLinks[pw.link]; ok {
+		pw.pdf.WriteLinkID(pw.lineHeight(), s, id)
+		return
+	}
+	if webLink(pw.link) {
+		pw.pdf.WriteLinkString(pw.lineHeight(), s, pw.link)
+		return
+	}
+	pw.pdf.Write(pw.lineHeight(), s)
+}
+
+// image shows an image from an import on its own lines, scaled to fit the
+// page. Images that cannot be shown are replaced by their alt text.
+func (pw *pdfWriter) image(n *ast.Image) {
+	alt := render.Text(n, pw.source)
+	var img pdfImage
+	if id, ok := render.ImportID(n); ok {
+		img = pw.registerImage(id)
+	}
+	if img.name == "" {
+		if alt != "" {
+			saved := pw.italic
+			pw.italic = true
+			pw.write("[" + alt + "]")
+			pw.italic = saved
+		}
+		return
+	}
+
+	w := float64(img.width) * 25.4 / pdfImageDPI
+	h := float64(img.height) * 25.4 / pdfImageDPI
+	if maxW := pw.textWidth(); w > maxW {
+		w, h = maxW, h*maxW/w
+	}
+	_, pageH := pw.pdf.GetPageSize()
+	if maxH := pageH - 2*pdfMargin - 10; h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+
+	if pw.pdf.GetX() > pdfMargin+pw.indent {
+		pw.pdf.Ln(pw.lineHeight())
+	}
+	pw.ensureSpace(h)
+	y := pw.pdf.GetY()
+	pw.pdf.ImageOptions(img.name, pdfMargin+pw.indent, y, w, h, false, gofpdf.ImageOptions{}, 0, "")
+	pw.pdf.SetXY(pdfMargin+pw.indent, y+h+1)
+}
+
+// registerImage embeds an image import in the PDF once
+func (pw *pdfWriter) registerImage(id string) pdfImage {
+	if img, ok := pw.images[id]; ok {
+		return img
+	}
+	pw.images[id] = pdfImage{}
+	loaded := pw.loadImage(id)
+	if loaded == nil {
+		return pdfImage{}
+	}
+
+	name := "import-" + id
+	pw.pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: loaded.imageType}, bytes.NewReader(loaded.data))
+	if pw.pdf.Err() {
+		// A JPEG gofpdf cannot read must not fail the whole document
+		pw.pdf.ClearError()
+		return pdfImage{}
+	}
+	img := pdfImage{name: name, width: loaded.width, height: loaded.height}
+	pw.images[id] = img
+	return img
+}
+
+// loadImage reads an image import, once per document. JPEGs are kept as they
+// are; other formats are converted to PNG, which gofpdf reads in every
+// variant.
+func (pw *pdfWriter) loadImage(id string) *pdfImageData {
+	if loaded, ok := pw.loaded[id]; ok {
+		return loaded
+	}
+	pw.loaded[id] = nil
+	if pw.src.Images == nil {
+		return nil
+	}
+	data, err := pw.src.Images.Image(id)
+	if err != nil {
+		return nil
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > thumbnail.MaxPixels {
+		return nil
+	}
+
+	imageType := "JPG"
+	if format != "jpeg" {
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, decoded); err != nil {
+			return nil
+		}
+		data, imageType = buf.Bytes(), "PNG"
+	}
+	loaded := &pdfImageData{data: data, imageType: imageType, width: cfg.Width, height: cfg.Height}
+	pw.loaded[id] = loaded
+	return loaded
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bytes"
+	"knowledge_base_backend/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+)
+
+func TestLoadFonts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	regular := write("regular.ttf", gosmallcaps.TTF)
+	mono := write("mono.ttf", goregular.TTF)
+	otf := write("font.otf", append([]byte("OTTO"), make([]byte, 64)...))
+	junk := write("junk.ttf", []byte("not a font"))
+
+	fonts, err := LoadFonts(FontFiles{})
+	if fonts != nil || err != nil {
+		t.Errorf("LoadFonts of no files = %v, %v, want nil", fonts, err)
+	}
+	for _, files := range []FontFiles{
+		{Regular: otf},
+		{Bold: junk},
+		{Mono: filepath.Join(dir, "missing.ttf")},
+	} {
+		if _, err := LoadFonts(files); err == nil {
+			t.Errorf("LoadFonts(%+v) succeeded", files)
+		}
+	}
+
+	fonts, err = LoadFonts(FontFiles{Regular: regular})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ttf := range fonts.faces() {
+		if !bytes.Equal(ttf, gosmallcaps.TTF) {
+			t.Errorf("face %s %q does not use the regular font given", pdfFonts[i].family, pdfFonts[i].style)
+		}
+	}
+
+	fonts, err = LoadFonts(FontFiles{Mono: mono})
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces := fonts.faces()
+	for i, font := range pdfFonts {
+		want := font.ttf
+		if font.family == "gomono" {
+			want = goregular.TTF
+		}
+		if !bytes.Equal(faces[i], want) {
+			t.Errorf("face %s %q uses the wrong font", font.family, font.style)
+		}
+	}
+	if faces := (*Fonts)(nil).faces(); !bytes.Equal(faces[4], gomono.TTF) {
+		t.Error("without Fonts, the monospaced face is not Go Mono")
+	}
+}
+
+func TestWritePDFFonts(t *testing.T) {
+	// Go Smallcaps sets lower case letters wider than Go Regular does
+	width := func(fonts *Fonts) float64 {
+		pdf := newPDF(fonts, "Fonts", nil, time.Time{}, time.Time{})
+		pdf.AddPage()
+		pdf.SetFont("go", "B", 10)
+		return pdf.GetStringWidth("lower case")
+	}
+	if width(&Fonts{Regular: goregular.TTF}) == width(&Fonts{Regular: gosmallcaps.TTF}) {
+		t.Error("the bold face does not use the regular font given")
+	}
+
+	src := Source{Note: models.Note{Title: "Fonts", Content: "plain text"}, Fonts: &Fonts{Regular: gosmallcaps.TTF}}
+	var buf bytes.Buffer
+	if err := writePDF(&buf, src); err != nil {
+		t.Fatalf("writePDF: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package export writes exported files, confined to one root directory
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrUnsafePath is returned for a path that is absolute, climbs out with
+	// "..", or leads out of the root through a symlink
+	ErrUnsafePath = errors.New("export: path is outside the export root")
+	// ErrExists is returned when the file is already there and the conflict
+	// policy is Fail
+	ErrExists = errors.New("export: file already exists")
+)
+
+// Policy says what a write does when its file already exists
+type Policy string
+
+const (
+	// Fail leaves the existing file alone and returns ErrExists
+	Fail Policy = "fail"
+	// Overwrite replaces the existing file
+	Overwrite Policy = "overwrite"
+	// Rename writes beside it, as "name (1).ext", "name (2).ext" and so on
+	Rename Policy = "rename"
+)
+
+// renameAttempts bounds the numbered names Rename tries
+const renameAttempts = 1000
+
+// ParsePolicy reads a conflict policy, Fail when empty
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return Fail, nil
+	case Fail, Overwrite, Rename:
+		return p, nil
+	}
+	return "", fmt.Errorf("conflict policy must be %s, %s or %s", Fail, Overwrite, Rename)
+}
+
+// Root is a directory exported files are written under. Paths given to it
+// are relative to it and can never name a file outside it.
+type Root struct {
+	dir string // absolute, with symlinks resolved
+}
+
+// Open returns the Root at dir, creating the directory if needed
+func Open(dir string) (*Root, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	return &Root{dir: resolved}, nil
+}
+
+// Dir returns the absolute path of the root directory
+func (r *Root) Dir() string {
+	return r.dir
+}
+
+// Write writes a file at name, a slash-separated path under the root, with
+// what write produces. The content goes to a temporary file beside it that is
+// renamed into place once complete, so readers never see a partial file and
+// a failed write leaves nothing behind. Missing directories are created. It
+// returns the path written, which differs from name under Rename.
+func (r *Root) Write(name string, policy Policy, write func(io.Writer) error) (string, error) {
+	parts, err := splitPath(name)
+	if err != nil {
+		return "", err
+	}
+	dir, err := r.mkdirs(parts[:len(parts)-1])
+	if err != nil {
+		return "", err
+	}
+	base := parts[len(parts)-1]
+
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	// CreateTemp makes files only the owner can read; exports are for everyone
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	final, err := place(tmp.Name(), dir, base, policy)
+	if err != nil {
+		return "", err
+	}
+	parts[len(parts)-1] = final
+	return strings.Join(parts, "/"), nil
+}
+
+// place moves the finished temporary file to base in dir under policy and
+// returns the name it took
+func place(tmp, dir, base string, policy Policy) (string, error) {
+	if policy == Overwrite {
+		// Renaming over a symlink replaces the link, not what it points at
+		return base, os.Rename(tmp, filepath.Join(dir, base))
+	}
+
+	// Claiming fails if the name is taken, so no other writer can slip a
+	// file in between checking for the name and claiming it
+	name := base
+	for n := 1; ; n++ {
+		err := claim(tmp, filepath.Join(dir, name))
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		if policy != Rename {
+			return "", ErrExists
+		}
+		if n > renameAttempts {
+			return "", fmt.Errorf("export: no free name for %s after %d attempts", base, renameAttempts)
+		}
+		ext := filepath.Ext(base)
+		name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), n, ext)
+	}
+}
+
+// claim moves tmp to path unless path exists, failing with os.ErrExist then.
+// It hard links tmp there, or where the file system has no hard links
+// creates path exclusively and renames tmp over it.
+func claim(tmp, path string) error {
+	err := os.Link(tmp, path)
+	if err == nil || errors.Is(err, os.ErrExist) ||
+		!(errors.Is(err, errors.ErrUnsupported) || errors.Is(err, os.ErrPermission)) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// splitPath checks that name is a relative path without ".." and returns its
+// elements
+func splitPath(name string) ([]string, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrUnsafePath)
+	}
+	if strings.ContainsRune(name, 0) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+
+	var parts []string
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch part {
+		case ".":
+			continue
+		case "..":
+			return nil, fmt.Errorf("%w: %q", ErrUnsafePath, name)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 || strings.HasSuffix(name, "/") || strings.HasSuffix(name, `\`) {
+		return nil, fmt.Errorf("%w: %q names a directory", ErrUnsafePath, name)
+	}
+	return parts, nil
+}
+
+// mkdirs walks down the directories under the root one at a time, creating
+// those missing. Each symlink met is resolved and must stay inside the root,
+// so nothing is ever created outside it. It returns the resolved directory.
+func (r *Root) mkdirs(parts []string) (string, error) {
+	dir := r.dir
+	for _, part := range parts {
+		next := filepath.Join(dir, part)
+		info, err := os.Lstat(next)
+		if errors.Is(err, os.ErrNotExist) {
+			if err := os.Mkdir(next, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+				return "", err
+			}
+			info, err = os.Lstat(next)
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if next, err = filepath.EvalSymlinks(next); err != nil {
+				return "", err
+			}
+			if !r.contains(next) {
+				return "", fmt.Errorf("%w: %s leads outside it", ErrUnsafePath, part)
+			}
+			if info, err = os.Stat(next); err != nil {
+				return "", err
+			}
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("export: %s is not a directory", part)
+		}
+		dir = next
+	}
+	return dir, nil
+}
+
+// contains reports whether the resolved path p is the root or inside it
+func (r *Root) contains(p string) bool {
+	rel, err := filepath.Rel(r.dir, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
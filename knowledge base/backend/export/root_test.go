@@ -0,0 +1,198 @@
+package export
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeString writes s at name under r
+func writeString(r *Root, name string, policy Policy, s string) (string, error) {
+	return r.Write(name, policy, func(w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	})
+}
+
+func openRoot(t *testing.T) *Root {
+	t.Helper()
+	r, err := Open(filepath.Join(t.TempDir(), "exports"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return r
+}
+
+func TestRootConfinement(t *testing.T) {
+	r := openRoot(t)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(r.Dir(), "out")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(r.Dir(), "inside"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(r.Dir(), "inside"), filepath.Join(r.Dir(), "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string // the path written, or "" when ErrUnsafePath is expected
+	}{
+		{"note.txt", "note.txt"},
+		{"a/b/note.txt", "a/b/note.txt"},
+		{"./a/./c.txt", "a/c.txt"},
+		{`win\dir\note.txt`, "win/dir/note.txt"},
+		{"alias/note.txt", "alias/note.txt"},
+		{"", ""},
+		{"../escape.txt", ""},
+		{"a/../../escape.txt", ""},
+		{"a/..", ""},
+		{"/etc/escape.txt", ""},
+		{`\escape.txt`, ""},
+		{"dir/", ""},
+		{".", ""},
+		{"nul\x00.txt", ""},
+		{"out/escape.txt", ""},
+		{"out/deeper/escape.txt", ""},
+	}
+	for _, tt := range tests {
+		got, err := writeString(r, tt.name, Fail, "x")
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("Write(%q) = %q, %v, want ErrUnsafePath", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Write(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("wrote %d entries outside the root", len(entries))
+	}
+}
+
+func TestRootPolicies(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		want     string // path written by the second write
+		err      error
+		contents map[string]string
+	}{
+		{Fail, "", ErrExists, map[string]string{"n.txt": "first"}},
+		{Overwrite, "n.txt", nil, map[string]string{"n.txt": "second"}},
+		{Rename, "n (1).txt", nil, map[string]string{"n.txt": "first", "n (1).txt": "second"}},
+	}
+	for _, tt := range tests {
+		r := openRoot(t)
+		if _, err := writeString(r, "n.txt", tt.policy, "first"); err != nil {
+			t.Fatalf("%s: first write: %v", tt.policy, err)
+		}
+		got, err := writeString(r, "n.txt", tt.policy, "second")
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: second write = %q, %v, want %q, %v", tt.policy, got, err, tt.want, tt.err)
+		}
+
+		entries, err := os.ReadDir(r.Dir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(tt.contents) {
+			t.Errorf("%s: %d files in the root, want %d", tt.policy, len(entries), len(tt.contents))
+		}
+		for name, want := range tt.contents {
+			data, err := os.ReadFile(filepath.Join(r.Dir(), name))
+			if err != nil || string(data) != want {
+				t.Errorf("%s: %s holds %q, %v, want %q", tt.policy, name, data, err, want)
+			}
+		}
+	}
+}
+
+func TestRootRenameNumbers(t *testing.T) {
+	r := openRoot(t)
+	for _, want := range []string{"n.txt", "n (1).txt", "n (2).txt"} {
+		got, err := writeString(r, "n.txt", Rename, want)
+		if err != nil || got != want {
+			t.Errorf("Write = %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestRootOverwriteReplacesSymlink(t *testing.T) {
+	r := openRoot(t)
+	target := filepath.Join(t.TempDir(), "target.txt")
+	if err := os.WriteFile(target, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(r.Dir(), "link.txt")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if _, err := writeString(r, "link.txt", Overwrite, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "keep" {
+		t.Errorf("the symlink target was overwritten with %q", data)
+	}
+	info, err := os.Lstat(filepath.Join(r.Dir(), "link.txt"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("link.txt is not a regular file: %v, %v", info, err)
+	}
+}
+
+func TestRootWrite(t *testing.T) {
+	r := openRoot(t)
+	if _, err := writeString(r, "n.txt", Fail, "x"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(r.Dir(), "n.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o644 {
+		t.Errorf("file mode %v, want 0644", perm)
+	}
+
+	// A failed write leaves neither the file nor its temporary file
+	failed := errors.New("failed")
+	if _, err := r.Write("broken.txt", Fail, func(w io.Writer) error { return failed }); !errors.Is(err, failed) {
+		t.Errorf("Write error = %v, want %v", err, failed)
+	}
+	entries, err := os.ReadDir(r.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the root after a failed write, want 1", len(entries))
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Policy
+		ok   bool
+	}{
+		{"", Fail, true},
+		{"fail", Fail, true},
+		{"overwrite", Overwrite, true},
+		{"rename", Rename, true},
+		{"Rename", "", false},
+		{"skip", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
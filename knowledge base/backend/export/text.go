@@ -0,0 +1,71 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/render"
+	"strings"
+)
+
+// writeText writes the content of the note as it was written
+func writeText(w io.Writer, src Source) error {
+	_, err := io.WriteString(w, src.Note.Content)
+	return err
+}
+
+// writeMarkdown writes the note as markdown under its title. Plain notes
+// have each line ended with a hard break so their line breaks survive.
+func writeMarkdown(w io.Writer, src Source) error {
+	content := src.Note.Content
+	if src.Note.Format != models.FormatMarkdown {
+		content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "  \n")
+	}
+	_, err := io.WriteString(w, "# "+src.Note.Title+"\n\n"+content+"\n")
+	return err
+}
+
+// htmlPage is the standalone page writeHTML fills in
+var htmlPage = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+{{- if .TOC}}
+<nav>
+<ul>
+{{- range .TOC}}
+<li style="margin-left: {{.Indent}}em"><a href="#{{.ID}}">{{.Text}}</a></li>
+{{- end}}
+</ul>
+</nav>
+{{- end}}
+{{.Body}}
+</article>
+</body>
+</html>
+`))
+
+// tocEntry is a heading as listed in the contents of an HTML page
+type tocEntry struct {
+	render.Heading
+	Indent int
+}
+
+// writeHTML writes the rendered note as a standalone HTML page, with its
+// table of contents
+func writeHTML(w io.Writer, src Source) error {
+	toc := make([]tocEntry, len(src.Document.TOC))
+	for i, h := range src.Document.TOC {
+		toc[i] = tocEntry{Heading: h, Indent: 2 * (h.Level - 1)}
+	}
+	return htmlPage.Execute(w, struct {
+		Title string
+		TOC   []tocEntry
+		Body  template.HTML
+	}{src.Note.Title, toc, template.HTML(src.Document.HTML)}) // sanitized by render
+}
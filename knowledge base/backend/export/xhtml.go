@@ -0,0 +1,80 @@
+package export
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// voidElements are written as empty elements in XHTML
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Br: true, atom.Col: true, atom.Hr: true,
+	atom.Img: true, atom.Input: true, atom.Wbr: true,
+}
+
+// toXHTML rewrites a fragment of rendered HTML as XHTML. rewrite is given
+// the href of each link and the src of each image and returns the URL to use
+// instead, or false to drop it; a link then keeps its text and an image is
+// replaced by its alt text.
+func toXHTML(fragment string, rewrite func(n *html.Node, url string) (string, bool)) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeXHTML(&b, n, rewrite)
+	}
+	return b.String(), nil
+}
+
+func writeXHTML(b *strings.Builder, n *html.Node, rewrite func(n *html.Node, url string) (string, bool)) {
+	switch n.Type {
+	case html.TextNode:
+		xml.EscapeText(b, []byte(n.Data))
+	case html.ElementNode:
+		var attrs strings.Builder
+		for _, a := range n.Attr {
+			value := a.Val
+			if (n.DataAtom == atom.A && a.Key == "href") || (n.DataAtom == atom.Img && a.Key == "src") {
+				var ok bool
+				if value, ok = rewrite(n, a.Val); !ok {
+					if n.DataAtom == atom.Img {
+						xml.EscapeText(b, []byte("["+attr(n, "alt")+"]"))
+						return
+					}
+					continue
+				}
+			}
+			attrs.WriteString(" " + a.Key + `="`)
+			xml.EscapeText(&attrs, []byte(value))
+			attrs.WriteString(`"`)
+		}
+		b.WriteString("<" + n.Data + attrs.String())
+		if voidElements[n.DataAtom] {
+			b.WriteString("/>")
+			return
+		}
+		b.WriteString(">")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTML(b, c, rewrite)
+		}
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// attr returns the value of an attribute of n, or "" if it has none
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package export
+
+import (
+	"archive/zip"
+	"hash/crc32"
+	"io"
+)
+
+// writeZipFile adds a compressed file to a zip archive
+func writeZipFile(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+// writeMimetype adds the mimetype file ODF and EPUB readers look for at the
+// start of the archive: uncompressed, and without the data descriptor a
+// streamed entry would have
+func writeMimetype(zw *zip.Writer, mimeType string) error {
+	f, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(mimeType)),
+		CompressedSize64:   uint64(len(mimeType)),
+		UncompressedSize64: uint64(len(mimeType)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, mimeType)
+	return err
+}
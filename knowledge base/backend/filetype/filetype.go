@@ -0,0 +1,323 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind is the broad category of a file
+type Kind string
+
+// File categories
+const (
+	Image    Kind = "image"
+	Video    Kind = "video"
+	Audio    Kind = "audio"
+	Document Kind = "document"
+	Archive  Kind = "archive"
+	Unknown  Kind = "unknown"
+)
+
+// Type is the detected category and MIME type of a file
+type Type struct {
+	Kind Kind
+	MIME string
+}
+
+// activeMIME are the MIME types of markup browsers run scripts in
+var activeMIME = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// Active reports whether content of the MIME type can run scripts when a
+// browser opens it
+func Active(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	return activeMIME[mediaType]
+}
+
+// sniffLen is how much of the file is inspected for signatures
+const sniffLen = 512
+
+// signature matches a magic byte sequence at a fixed offset
+type signature struct {
+	offset int
+	magic  string
+	kind   Kind
+	mime   string
+}
+
+var signatures = []signature{
+	{0, "\xff\xd8\xff", Image, "image/jpeg"},
+	{0, "\x89PNG\r\n\x1a\n", Image, "image/png"},
+	{0, "GIF87a", Image, "image/gif"},
+	{0, "GIF89a", Image, "image/gif"},
+	{0, "II*\x00", Image, "image/tiff"},
+	{0, "MM\x00*", Image, "image/tiff"},
+	{0, "\x00\x00\x01\x00", Image, "image/x-icon"},
+	{0, "\x1aE\xdf\xa3", Video, "video/x-matroska"},
+	{0, "FLV\x01", Video, "video/x-flv"},
+	{0, "\x00\x00\x01\xba", Video, "video/mpeg"},
+	{0, "\x00\x00\x01\xb3", Video, "video/mpeg"},
+	{0, "0&\xb2u\x8ef\xcf\x11", Video, "video/x-ms-asf"},
+	{0, "ID3\x02", Audio, "audio/mpeg"},
+	{0, "ID3\x03", Audio, "audio/mpeg"},
+	{0, "ID3\x04", Audio, "audio/mpeg"},
+	{0, "\xff\xfb", Audio, "audio/mpeg"},
+	{0, "\xff\xf3", Audio, "audio/mpeg"},
+	{0, "\xff\xf2", Audio, "audio/mpeg"},
+	{0, "\xff\xf1", Audio, "audio/aac"},
+	{0, "\xff\xf9", Audio, "audio/aac"},
+	{0, "fLaC", Audio, "audio/flac"},
+	{0, "OggS", Audio, "audio/ogg"},
+	{0, "MThd\x00\x00\x00\x06", Audio, "audio/midi"},
+	{0, "#!AMR", Audio, "audio/amr"},
+	{0, "%PDF-", Document, "application/pdf"},
+	{0, "{\\rtf", Document, "application/rtf"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", Document, "application/x-ole-storage"},
+	{0, "PK\x03\x04", Archive, "application/zip"},
+	{0, "PK\x05\x06", Archive, "application/zip"},
+	{0, "\x1f\x8b", Archive, "application/gzip"},
+	{0, "BZh", Archive, "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", Archive, "application/x-xz"},
+	{0, "7z\xbc\xaf'\x1c", Archive, "application/x-7z-compressed"},
+	{0, "Rar!\x1a\x07", Archive, "application/vnd.rar"},
+	{0, "(\xb5/\xfd", Archive, "application/zstd"},
+	{257, "ustar", Archive, "application/x-tar"},
+}
+
+// byExtension is the fallback for content without a signature, such as text
+var byExtension = map[string]Type{
+	".txt":      {Document, "text/plain"},
+	".text":     {Document, "text/plain"},
+	".log":      {Document, "text/plain"},
+	".md":       {Document, "text/markdown"},
+	".markdown": {Document, "text/markdown"},
+	".html":     {Document, "text/html"},
+	".htm":      {Document, "text/html"},
+	".csv":      {Document, "text/csv"},
+	".json":     {Document, "application/json"},
+	".xml":      {Document, "application/xml"},
+	".rtf":      {Document, "application/rtf"},
+	".pdf":      {Document, "application/pdf"},
+	".doc":      {Document, "application/msword"},
+	".xls":      {Document, "application/vnd.ms-excel"},
+	".ppt":      {Document, "application/vnd.ms-powerpoint"},
+	".docx":     {Document, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	".xlsx":     {Document, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	".pptx":     {Document, "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	".odt":      {Document, "application/vnd.oasis.opendocument.text"},
+	".ods":      {Document, "application/vnd.oasis.opendocument.spreadsheet"},
+	".odp":      {Document, "application/vnd.oasis.opendocument.presentation"},
+	".epub":     {Document, "application/epub+zip"},
+	".jpg":      {Image, "image/jpeg"},
+	".jpeg":     {Image, "image/jpeg"},
+	".png":      {Image, "image/png"},
+	".gif":      {Image, "image/gif"},
+	".webp":     {Image, "image/webp"},
+	".bmp":      {Image, "image/bmp"},
+	".tif":      {Image, "image/tiff"},
+	".tiff":     {Image, "image/tiff"},
+	".svg":      {Image, "image/svg+xml"},
+	".heic":     {Image, "image/heic"},
+	".avif":     {Image, "image/avif"},
+	".ico":      {Image, "image/x-icon"},
+	".mp4":      {Video, "video/mp4"},
+	".m4v":      {Video, "video/x-m4v"},
+	".mov":      {Video, "video/quicktime"},
+	".avi":      {Video, "video/x-msvideo"},
+	".mkv":      {Video, "video/x-matroska"},
+	".webm":     {Video, "video/webm"},
+	".flv":      {Video, "video/x-flv"},
+	".wmv":      {Video, "video/x-ms-wmv"},
+	".mpg":      {Video, "video/mpeg"},
+	".mpeg":     {Video, "video/mpeg"},
+	".3gp":      {Video, "video/3gpp"},
+	".mp3":      {Audio, "audio/mpeg"},
+	".m4a":      {Audio, "audio/mp4"},
+	".aac":      {Audio, "audio/aac"},
+	".wav":      {Audio, "audio/wav"},
+	".flac":     {Audio, "audio/flac"},
+	".ogg":      {Audio, "audio/ogg"},
+	".oga":      {Audio, "audio/ogg"},
+	".opus":     {Audio, "audio/opus"},
+	".mid":      {Audio, "audio/midi"},
+	".midi":     {Audio, "audio/midi"},
+	".zip":      {Archive, "application/zip"},
+	".gz":       {Archive, "application/gzip"},
+	".tgz":      {Archive, "application/gzip"},
+	".tar":      {Archive, "application/x-tar"},
+	".bz2":      {Archive, "application/x-bzip2"},
+	".xz":       {Archive, "application/x-xz"},
+	".7z":       {Archive, "application/x-7z-compressed"},
+	".rar":      {Archive, "application/vnd.rar"},
+	".zst":      {Archive, "application/zstd"},
+}
+
+// Detect identifies a file from its magic bytes, falling back to the
+// extension of fileName for text formats and unrecognised content
+func Detect(r io.ReaderAt, size int64, fileName string) Type {
+	header := make([]byte, sniffLen)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	if t, ok := detectContainer(r, size, header); ok {
+		return t
+	}
+	for _, sig := range signatures {
+		if len(header) >= sig.offset+len(sig.magic) && string(header[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			t := Type{sig.kind, sig.mime}
+			// Formats that share a container are told apart by extension
+			if fallback, ok := byExtension[ext]; ok && refines(t, fallback) {
+				return fallback
+			}
+			return t
+		}
+	}
+	if isText(header) {
+		return detectText(header, ext)
+	}
+	if t, ok := byExtension[ext]; ok {
+		return t
+	}
+	return Type{Unknown, "application/octet-stream"}
+}
+
+// detectContainer handles signatures whose payload names the real format
+func detectContainer(r io.ReaderAt, size int64, header []byte) (Type, bool) {
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF":
+		switch string(header[8:12]) {
+		case "WEBP":
+			return Type{Image, "image/webp"}, true
+		case "AVI ":
+			return Type{Video, "video/x-msvideo"}, true
+		case "WAVE":
+			return Type{Audio, "audio/wav"}, true
+		}
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		switch string(header[8:12]) {
+		case "heic", "heix", "mif1", "msf1":
+			return Type{Image, "image/heic"}, true
+		case "avif", "avis":
+			return Type{Image, "image/avif"}, true
+		case "qt  ":
+			return Type{Video, "video/quicktime"}, true
+		case "M4A ", "M4B ":
+			return Type{Audio, "audio/mp4"}, true
+		case "M4V ", "M4VH", "M4VP":
+			return Type{Video, "video/x-m4v"}, true
+		case "3gp4", "3gp5", "3gp6", "3ge6", "3gg6":
+			return Type{Video, "video/3gpp"}, true
+		default:
+			return Type{Video, "video/mp4"}, true
+		}
+	case len(header) >= 14 && string(header[0:2]) == "BM" && string(header[6:10]) == "\x00\x00\x00\x00":
+		// Bitmaps are only told apart from text by their reserved header bytes
+		return Type{Image, "image/bmp"}, true
+	case bytes.HasPrefix(header, []byte("\x1aE\xdf\xa3")) && bytes.Contains(header, []byte("webm")):
+		return Type{Video, "video/webm"}, true
+	case bytes.HasPrefix(header, []byte("OggS")) && bytes.Contains(header, []byte("theora")):
+		return Type{Video, "video/ogg"}, true
+	case bytes.HasPrefix(header, []byte("OggS")) && bytes.Contains(header, []byte("OpusHead")):
+		return Type{Audio, "audio/opus"}, true
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return detectZip(r, size, header)
+	}
+	return Type{}, false
+}
+
+// detectZip recognises the office and e-book formats packaged as zip files
+func detectZip(r io.ReaderAt, size int64, header []byte) (Type, bool) {
+	// ODF and EPUB store their MIME type uncompressed as the first entry
+	if len(header) >= 38 && string(header[30:38]) == "mimetype" {
+		rest := header[38:]
+		for _, t := range []Type{
+			{Document, "application/epub+zip"},
+			{Document, "application/vnd.oasis.opendocument.text"},
+			{Document, "application/vnd.oasis.opendocument.spreadsheet"},
+			{Document, "application/vnd.oasis.opendocument.presentation"},
+		} {
+			if bytes.HasPrefix(rest, []byte(t.MIME)) {
+				return t, true
+			}
+		}
+	}
+
+	// Office Open XML is identified by its top-level part directories
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Type{}, false
+	}
+	for _, f := range zr.File {
+		switch {
+		case strings.HasPrefix(f.Name, "word/"):
+			return byExtension[".docx"], true
+		case strings.HasPrefix(f.Name, "xl/"):
+			return byExtension[".xlsx"], true
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return byExtension[".pptx"], true
+		}
+	}
+	return Type{Archive, "application/zip"}, true
+}
+
+// refines reports whether the extension names a more specific format than the
+// signature, as with legacy Office files inside an OLE container
+func refines(sniffed, byExt Type) bool {
+	return sniffed.MIME == "application/x-ole-storage" && byExt.Kind == Document
+}
+
+// isText reports whether the header looks like UTF-8 text
+func isText(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+	if len(header) == sniffLen {
+		// A multi-byte rune may be cut off at the end of the header
+		for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(header); i++ {
+			header = header[:len(header)-1]
+		}
+	}
+	if !utf8.Valid(header) {
+		return false
+	}
+	for _, b := range header {
+		if b == 0 || (b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f') {
+			return false
+		}
+	}
+	return true
+}
+
+// detectText classifies text content by its markup, then by extension
+func detectText(header []byte, ext string) Type {
+	trimmed := bytes.ToLower(bytes.TrimSpace(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf"))))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<!doctype html")), bytes.HasPrefix(trimmed, []byte("<html")):
+		return Type{Document, "text/html"}
+	case bytes.HasPrefix(trimmed, []byte("<svg")),
+		bytes.HasPrefix(trimmed, []byte("<?xml")) && bytes.Contains(trimmed, []byte("<svg")):
+		return Type{Image, "image/svg+xml"}
+	}
+	if t, ok := byExtension[ext]; ok && (strings.HasPrefix(t.MIME, "text/") || t.MIME == "application/json" || t.MIME == "application/xml") {
+		return t
+	}
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) {
+		return Type{Document, "application/xml"}
+	}
+	return Type{Document, "text/plain"}
+}
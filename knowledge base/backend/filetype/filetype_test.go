@@ -0,0 +1,131 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipped builds a zip archive holding empty files with the given names
+func zipped(t *testing.T, names ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		fileName string
+		want     Type
+	}{
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00", "x.bin", Type{Image, "image/png"}},
+		{"jpeg named png", "\xff\xd8\xff\xe0", "photo.png", Type{Image, "image/jpeg"}},
+		{"webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", "", Type{Image, "image/webp"}},
+		{"wav", "RIFF\x00\x00\x00\x00WAVEfmt ", "", Type{Audio, "audio/wav"}},
+		{"mp4", "\x00\x00\x00\x18ftypisom", "", Type{Video, "video/mp4"}},
+		{"quicktime", "\x00\x00\x00\x14ftypqt  ", "", Type{Video, "video/quicktime"}},
+		{"heic", "\x00\x00\x00\x18ftypheic", "", Type{Image, "image/heic"}},
+		{"m4a", "\x00\x00\x00\x18ftypM4A ", "", Type{Audio, "audio/mp4"}},
+		{"pdf", "%PDF-1.7\n", "", Type{Document, "application/pdf"}},
+		{"legacy word", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "old.doc", Type{Document, "application/msword"}},
+		{"ole without extension", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "", Type{Document, "application/x-ole-storage"}},
+		{"zip", zipped(t, "a.txt"), "", Type{Archive, "application/zip"}},
+		{"docx", zipped(t, "[Content_Types].xml", "word/document.xml"), "", byExtension[".docx"]},
+		{"xlsx", zipped(t, "[Content_Types].xml", "xl/workbook.xml"), "", byExtension[".xlsx"]},
+		{"tar", strings.Repeat("\x00", 257) + "ustar", "", Type{Archive, "application/x-tar"}},
+		{"html", "  <!DOCTYPE html><p>hi", "page.txt", Type{Document, "text/html"}},
+		{"svg", "<?xml version=\"1.0\"?><svg></svg>", "image.txt", Type{Image, "image/svg+xml"}},
+		{"xml", "<?xml version=\"1.0\"?><a/>", "", Type{Document, "application/xml"}},
+		{"markdown", "# Title\n", "notes.md", Type{Document, "text/markdown"}},
+		{"text named png", "plain words", "fake.png", Type{Document, "text/plain"}},
+		{"utf-8 text", "привет мир", "", Type{Document, "text/plain"}},
+		{"binary by extension", "\x00\x01\x02", "clip.mkv", Type{Video, "video/x-matroska"}},
+		{"unknown", "\x00\x01\x02", "", Type{Unknown, "application/octet-stream"}},
+		{"empty", "", "", Type{Unknown, "application/octet-stream"}},
+	}
+	for _, tt := range tests {
+		r := strings.NewReader(tt.content)
+		if got := Detect(r, int64(len(tt.content)), tt.fileName); got != tt.want {
+			t.Errorf("%s: Detect = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A multi-byte rune cut off by the sniffed header still reads as text
+func TestDetectTextAcrossHeader(t *testing.T) {
+	content := strings.Repeat("a", sniffLen-1) + "é"
+	if got := Detect(strings.NewReader(content), int64(len(content)), ""); got.MIME != "text/plain" {
+		t.Errorf("Detect = %v, want text/plain", got)
+	}
+}
+
+func TestActive(t *testing.T) {
+	tests := []struct {
+		mime string
+		want bool
+	}{
+		{"text/html", true},
+		{"text/html; charset=utf-8", true},
+		{"TEXT/HTML", true},
+		{"image/svg+xml", true},
+		{"application/xml", true},
+		{"text/plain", false},
+		{"image/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Active(tt.mime); got != tt.want {
+			t.Errorf("Active(%q) = %v, want %v", tt.mime, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	png := Type{Image, "image/png"}
+	mp3 := Type{Audio, "audio/mpeg"}
+	pdf := Type{Document, "application/pdf"}
+	tests := []struct {
+		policy Policy
+		t      Type
+		want   bool
+	}{
+		{Policy{}, png, true},
+		{Policy{Allow: []string{"image"}}, png, true},
+		{Policy{Allow: []string{"image"}}, mp3, false},
+		{Policy{Allow: []string{"audio/*"}}, mp3, true},
+		{Policy{Allow: []string{"Application/PDF"}}, pdf, true},
+		{Policy{Allow: []string{"*"}, Deny: []string{"audio"}}, mp3, false},
+		{Policy{Deny: []string{"image/png"}}, png, false},
+		{Policy{Deny: []string{"image/png"}}, pdf, true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Permits(tt.t); got != tt.want {
+			t.Errorf("%+v.Permits(%v) = %v, want %v", tt.policy, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	for _, rule := range []string{"image", "VIDEO", "*", "audio/*", "application/pdf"} {
+		if err := ValidateRule(rule); err != nil {
+			t.Errorf("ValidateRule(%q) = %v", rule, err)
+		}
+	}
+	for _, rule := range []string{"", "pictures", "image/", "/png"} {
+		if err := ValidateRule(rule); err == nil {
+			t.Errorf("ValidateRule(%q) accepted", rule)
+		}
+	}
+}
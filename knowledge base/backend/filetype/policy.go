@@ -0,0 +1,59 @@
+package filetype
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy decides which file types may be imported. Each rule is a kind such as
+// "video", a MIME type such as "application/pdf", a MIME wildcard such as
+// "audio/*", or "*". Deny rules win over allow rules, and an empty allow list
+// permits everything that is not denied.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Permits reports whether files of type t may be imported
+func (p Policy) Permits(t Type) bool {
+	for _, rule := range p.Deny {
+		if ruleMatches(rule, t) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, rule := range p.Allow {
+		if ruleMatches(rule, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRule reports whether rule is a known kind, "*", or a MIME pattern
+func ValidateRule(rule string) error {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	switch Kind(rule) {
+	case Image, Video, Audio, Document, Archive, Unknown, "*":
+		return nil
+	}
+	if major, minor, ok := strings.Cut(rule, "/"); ok && major != "" && minor != "" {
+		return nil
+	}
+	return fmt.Errorf("file type rule %q: must be a kind (image, video, audio, document, archive, unknown), a MIME type, or *", rule)
+}
+
+func ruleMatches(rule string, t Type) bool {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	switch {
+	case rule == "*":
+		return true
+	case Kind(rule) == t.Kind:
+		return true
+	case strings.HasSuffix(rule, "/*"):
+		return strings.HasPrefix(t.MIME, strings.TrimSuffix(rule, "*"))
+	}
+	return rule == t.MIME
+}
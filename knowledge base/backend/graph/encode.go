@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteGraphML writes the graph as GraphML. Shared tag edges are undirected
+// and link edges directed. Truncated tags are listed in a comment.
+func WriteGraphML(w io.Writer, g Graph) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	bw.WriteString(`  <key id="title" for="node" attr.name="title" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <key id="tags" for="node" attr.name="tags" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <key id="kind" for="edge" attr.name="kind" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <key id="weight" for="edge" attr.name="weight" attr.type="int"/>` + "\n")
+	bw.WriteString(`  <key id="shared" for="edge" attr.name="shared_tags" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <graph id="notes" edgedefault="undirected">` + "\n")
+	if len(g.TruncatedTags) > 0 {
+		fmt.Fprintf(bw, "    <!-- %s -->\n", commentXML(truncatedNote(strings.Join(g.TruncatedTags, ", "))))
+	}
+
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, "    <node id=\"%s\">\n", n.ID.Hex())
+		fmt.Fprintf(bw, "      <data key=\"title\">%s</data>\n", escapeXML(n.Title))
+		fmt.Fprintf(bw, "      <data key=\"tags\">%s</data>\n", escapeXML(strings.Join(n.Tags, ",")))
+		bw.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(bw, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\" directed=\"%t\">\n",
+			i, e.Source.Hex(), e.Target.Hex(), e.Kind == Reference)
+		fmt.Fprintf(bw, "      <data key=\"kind\">%s</data>\n", e.Kind)
+		fmt.Fprintf(bw, "      <data key=\"weight\">%d</data>\n", e.Weight)
+		if len(e.Tags) > 0 {
+			fmt.Fprintf(bw, "      <data key=\"shared\">%s</data>\n", escapeXML(strings.Join(e.Tags, ",")))
+		}
+		bw.WriteString("    </edge>\n")
+	}
+
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Link edges are
+// arrows; shared tag edges are dashed lines labelled with the tags.
+// Truncated tags are listed in a comment.
+func WriteDOT(w io.Writer, g Graph) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph notes {\n")
+	if len(g.TruncatedTags) > 0 {
+		quoted := make([]string, len(g.TruncatedTags))
+		for i, tag := range g.TruncatedTags {
+			quoted[i] = quoteDOT(tag)
+		}
+		fmt.Fprintf(bw, "  // %s\n", truncatedNote(strings.Join(quoted, ", ")))
+	}
+	bw.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, "  %s [label=%s];\n", quoteDOT(n.ID.Hex()), quoteDOT(n.Title))
+	}
+	for _, e := range g.Edges {
+		if e.Kind == SharedTag {
+			fmt.Fprintf(bw, "  %s -> %s [dir=none, style=dashed, label=%s, weight=%d];\n",
+				quoteDOT(e.Source.Hex()), quoteDOT(e.Target.Hex()), quoteDOT(strings.Join(e.Tags, ", ")), e.Weight)
+			continue
+		}
+		fmt.Fprintf(bw, "  %s -> %s [weight=%d];\n", quoteDOT(e.Source.Hex()), quoteDOT(e.Target.Hex()), e.Weight)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// truncatedNote explains that the tags listed make no edges
+func truncatedNote(list string) string {
+	return fmt.Sprintf("tags on more than %d notes, without edges: %s", MaxTagNotes, list)
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// commentXML makes s safe to write inside an XML comment, which must not
+// hold "--" or end with "-"
+func commentXML(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	if strings.HasSuffix(s, "-") {
+		s += " "
+	}
+	return s
+}
+
+// quoteDOT quotes s as a DOT string, escaping quotes and backslashes and
+// turning line breaks into DOT's
+func quoteDOT(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+	return `"` + s + `"`
+}
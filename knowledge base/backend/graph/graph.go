@@ -0,0 +1,197 @@
+// Package graph builds the graph of how notes connect, through the tags they
+// share and the links between them
+package graph
+
+import (
+	"knowledge_base_backend/models"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kind says how an Edge connects two notes
+type Kind string
+
+const (
+	// SharedTag connects two notes carrying the same tags. It has no direction.
+	SharedTag Kind = "tag"
+	// Reference points from a note to a note it links to
+	Reference Kind = "link"
+)
+
+// Node is a note in the graph
+type Node struct {
+	ID    primitive.ObjectID `json:"id"`
+	Title string             `json:"title"`
+	Tags  []string           `json:"tags"`
+}
+
+// Edge connects two notes. Weight counts the tags they share or the links
+// from Source to Target.
+type Edge struct {
+	Source primitive.ObjectID `json:"source"`
+	Target primitive.ObjectID `json:"target"`
+	Kind   Kind               `json:"kind"`
+	Weight int                `json:"weight"`
+	Tags   []string           `json:"tags,omitempty"` // the shared tags
+}
+
+// Graph is the notes and the edges between them
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// TruncatedTags are the tags on more than MaxTagNotes notes, which make
+	// no edges
+	TruncatedTags []string `json:"truncated_tags,omitempty"`
+}
+
+// Build returns the graph of the notes, with the kinds of edges asked for.
+// Links from or to notes not in notes are left out.
+func Build(notes []models.Note, links []models.Link, kinds []Kind) Graph {
+	g := Graph{Nodes: make([]Node, 0, len(notes)), Edges: []Edge{}}
+	present := make(map[primitive.ObjectID]bool, len(notes))
+	for _, note := range notes {
+		present[note.ID] = true
+		tags := note.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		g.Nodes = append(g.Nodes, Node{ID: note.ID, Title: note.Title, Tags: tags})
+	}
+
+	for _, kind := range kinds {
+		switch kind {
+		case SharedTag:
+			edges, truncated := sharedTags(notes)
+			g.Edges = append(g.Edges, edges...)
+			g.TruncatedTags = truncated
+		case Reference:
+			g.Edges = append(g.Edges, references(links, present)...)
+		}
+	}
+	return g
+}
+
+// MaxTagNotes bounds the notes a tag connects. A tag carried by more notes
+// makes no edges: it says little about how two of them relate, and the pairs
+// grow with the square of the notes.
+const MaxTagNotes = 50
+
+// sharedTags connects every pair of notes sharing a tag, once per pair, for
+// the tags on no more than MaxTagNotes notes. It returns the other tags too.
+func sharedTags(notes []models.Note) ([]Edge, []string) {
+	byTag := make(map[string][]int)
+	for i, note := range notes {
+		for _, tag := range note.Tags {
+			byTag[tag] = append(byTag[tag], i)
+		}
+	}
+	tagNames := make([]string, 0, len(byTag))
+	var truncated []string
+	for tag, members := range byTag {
+		if len(members) <= MaxTagNotes {
+			tagNames = append(tagNames, tag)
+		} else {
+			truncated = append(truncated, tag)
+		}
+	}
+	sort.Strings(tagNames)
+	sort.Strings(truncated)
+
+	type pair struct{ a, b int }
+	shared := make(map[pair][]string)
+	var order []pair
+	for _, tag := range tagNames {
+		members := byTag[tag]
+		for i := 0; i < len(members); i++ {
+			for j := i + 1; j < len(members); j++ {
+				p := pair{members[i], members[j]}
+				if _, ok := shared[p]; !ok {
+					order = append(order, p)
+				}
+				shared[p] = append(shared[p], tag)
+			}
+		}
+	}
+
+	edges := make([]Edge, 0, len(order))
+	for _, p := range order {
+		edges = append(edges, Edge{
+			Source: notes[p.a].ID,
+			Target: notes[p.b].ID,
+			Kind:   SharedTag,
+			Weight: len(shared[p]),
+			Tags:   shared[p],
+		})
+	}
+	return edges, truncated
+}
+
+// references turns the resolved links between present notes into edges,
+// once per linked pair in each direction
+func references(links []models.Link, present map[primitive.ObjectID]bool) []Edge {
+	type pair struct{ from, to primitive.ObjectID }
+	index := make(map[pair]int)
+	var edges []Edge
+	for _, link := range links {
+		if link.TargetID == nil || !present[link.SourceID] || !present[*link.TargetID] {
+			continue
+		}
+		p := pair{link.SourceID, *link.TargetID}
+		if i, ok := index[p]; ok {
+			edges[i].Weight++
+			continue
+		}
+		index[p] = len(edges)
+		edges = append(edges, Edge{Source: p.from, Target: p.to, Kind: Reference, Weight: 1})
+	}
+	return edges
+}
+
+// Neighbourhood returns the part of the graph within depth edges of center,
+// following edges either way. Of the truncated tags it keeps those on the
+// notes included.
+func (g Graph) Neighbourhood(center primitive.ObjectID, depth int) Graph {
+	adjacent := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, e := range g.Edges {
+		adjacent[e.Source] = append(adjacent[e.Source], e.Target)
+		adjacent[e.Target] = append(adjacent[e.Target], e.Source)
+	}
+
+	within := map[primitive.ObjectID]bool{center: true}
+	frontier := []primitive.ObjectID{center}
+	for d := 0; d < depth && len(frontier) > 0; d++ {
+		var next []primitive.ObjectID
+		for _, id := range frontier {
+			for _, neighbour := range adjacent[id] {
+				if !within[neighbour] {
+					within[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	sub := Graph{Nodes: []Node{}, Edges: []Edge{}}
+	carried := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if within[n.ID] {
+			sub.Nodes = append(sub.Nodes, n)
+			for _, tag := range n.Tags {
+				carried[tag] = true
+			}
+		}
+	}
+	for _, tag := range g.TruncatedTags {
+		if carried[tag] {
+			sub.TruncatedTags = append(sub.TruncatedTags, tag)
+		}
+	}
+	for _, e := range g.Edges {
+		if within[e.Source] && within[e.Target] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	return sub
+}
@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"knowledge_base_backend/models"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testNotes returns notes titled a, b, c... carrying the tags given
+func testNotes(tags ...[]string) []models.Note {
+	notes := make([]models.Note, len(tags))
+	for i, t := range tags {
+		notes[i] = models.Note{ID: primitive.NewObjectID(), Title: string(rune('a' + i)), Tags: t}
+	}
+	return notes
+}
+
+// edgeNames describes edges as "a-b" for shared tags and "a>b" for links,
+// by the titles of the notes they join
+func edgeNames(notes []models.Note, edges []Edge) []string {
+	titles := make(map[primitive.ObjectID]string)
+	for _, n := range notes {
+		titles[n.ID] = n.Title
+	}
+	names := make([]string, len(edges))
+	for i, e := range edges {
+		sep := "-"
+		if e.Kind == Reference {
+			sep = ">"
+		}
+		names[i] = fmt.Sprintf("%s%s%s:%d", titles[e.Source], sep, titles[e.Target], e.Weight)
+	}
+	return names
+}
+
+func link(from, to models.Note) models.Link {
+	return models.Link{SourceID: from.ID, TargetID: &to.ID}
+}
+
+func TestBuild(t *testing.T) {
+	notes := testNotes([]string{"x", "y"}, []string{"x", "y"}, []string{"y"}, nil)
+	outside := primitive.NewObjectID()
+	links := []models.Link{
+		link(notes[0], notes[2]),
+		link(notes[0], notes[2]),
+		link(notes[2], notes[0]),
+		{SourceID: notes[3].ID, TargetID: &outside},
+		{SourceID: notes[3].ID}, // unresolved
+	}
+
+	tests := []struct {
+		kinds []Kind
+		want  []string
+	}{
+		{[]Kind{SharedTag}, []string{"a-b:2", "a-c:1", "b-c:1"}},
+		{[]Kind{Reference}, []string{"a>c:2", "c>a:1"}},
+		{[]Kind{SharedTag, Reference}, []string{"a-b:2", "a-c:1", "b-c:1", "a>c:2", "c>a:1"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		g := Build(notes, links, tt.kinds)
+		if got := edgeNames(notes, g.Edges); !slices.Equal(got, tt.want) {
+			t.Errorf("Build(%v) edges = %v, want %v", tt.kinds, got, tt.want)
+		}
+		if len(g.Nodes) != len(notes) {
+			t.Errorf("Build(%v) has %d nodes, want %d", tt.kinds, len(g.Nodes), len(notes))
+		}
+	}
+
+	g := Build(notes, links, []Kind{SharedTag})
+	if !slices.Equal(g.Edges[0].Tags, []string{"x", "y"}) {
+		t.Errorf("shared tags of a-b = %v", g.Edges[0].Tags)
+	}
+	if g.Nodes[3].Tags == nil {
+		t.Error("a note without tags has nil tags")
+	}
+}
+
+func TestBuildTruncatesCommonTags(t *testing.T) {
+	tags := make([][]string, MaxTagNotes+1)
+	for i := range tags {
+		tags[i] = []string{"common"}
+	}
+	tags[0] = []string{"common", "rare"}
+	tags[1] = []string{"common", "rare"}
+	notes := testNotes(tags...)
+
+	g := Build(notes, nil, []Kind{SharedTag})
+	if got := edgeNames(notes, g.Edges); !slices.Equal(got, []string{"a-b:1"}) {
+		t.Errorf("edges = %v, want only the rare tag's", got)
+	}
+	if !slices.Equal(g.TruncatedTags, []string{"common"}) {
+		t.Errorf("truncated tags = %v, want [common]", g.TruncatedTags)
+	}
+	if g := Build(notes, nil, []Kind{Reference}); g.TruncatedTags != nil {
+		t.Errorf("truncated tags without tag edges = %v", g.TruncatedTags)
+	}
+}
+
+func TestNeighbourhood(t *testing.T) {
+	// a > b > c > d, and e on its own
+	notes := testNotes([]string{"many"}, nil, nil, []string{"many"}, nil)
+	links := []models.Link{link(notes[0], notes[1]), link(notes[1], notes[2]), link(notes[2], notes[3])}
+	g := Build(notes, links, []Kind{Reference})
+	g.TruncatedTags = []string{"many"}
+
+	titles := func(g Graph) []string {
+		var names []string
+		for _, n := range g.Nodes {
+			names = append(names, n.Title)
+		}
+		return names
+	}
+	tests := []struct {
+		center    int
+		depth     int
+		want      []string
+		truncated []string
+	}{
+		{1, 1, []string{"a", "b", "c"}, []string{"many"}},
+		{2, 1, []string{"b", "c", "d"}, []string{"many"}},
+		{1, 2, []string{"a", "b", "c", "d"}, []string{"many"}},
+		{1, 0, []string{"b"}, nil},
+		{4, 3, []string{"e"}, nil},
+	}
+	for _, tt := range tests {
+		sub := g.Neighbourhood(notes[tt.center].ID, tt.depth)
+		if got := titles(sub); !slices.Equal(got, tt.want) {
+			t.Errorf("Neighbourhood(%s, %d) = %v, want %v", notes[tt.center].Title, tt.depth, got, tt.want)
+		}
+		if !slices.Equal(sub.TruncatedTags, tt.truncated) {
+			t.Errorf("Neighbourhood(%s, %d) truncated tags = %v, want %v", notes[tt.center].Title, tt.depth, sub.TruncatedTags, tt.truncated)
+		}
+		for _, e := range sub.Edges {
+			if !slices.ContainsFunc(sub.Nodes, func(n Node) bool { return n.ID == e.Source }) ||
+				!slices.ContainsFunc(sub.Nodes, func(n Node) bool { return n.ID == e.Target }) {
+				t.Errorf("Neighbourhood(%s, %d) keeps an edge to a note left out", notes[tt.center].Title, tt.depth)
+			}
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	notes := testNotes([]string{"x"}, []string{"x"})
+	notes[0].Title = `<"a" & b>`
+	g := Build(notes, []models.Link{link(notes[0], notes[1])}, []Kind{SharedTag, Reference})
+	g.TruncatedTags = []string{"a--b-"}
+
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Directed bool `xml:"directed,attr"`
+			} `xml:"edge"`
+			Comment string `xml:",comment"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Graph.Nodes) != 2 || doc.Graph.Nodes[0].Data[0].Value != notes[0].Title {
+		t.Errorf("nodes = %+v", doc.Graph.Nodes)
+	}
+	directed := []bool{}
+	for _, e := range doc.Graph.Edges {
+		directed = append(directed, e.Directed)
+	}
+	if !reflect.DeepEqual(directed, []bool{false, true}) {
+		t.Errorf("edges directed = %v, want [false true]", directed)
+	}
+	if !strings.Contains(doc.Graph.Comment, "a- -b-") {
+		t.Errorf("comment %q does not list the truncated tag", doc.Graph.Comment)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	notes := testNotes([]string{"x"}, []string{"x"})
+	notes[0].Title = "say \"hi\"\nthen \\ leave"
+	g := Build(notes, []models.Link{link(notes[0], notes[1])}, []Kind{SharedTag, Reference})
+	g.TruncatedTags = []string{"line\nbreak"}
+
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	a, b := notes[0].ID.Hex(), notes[1].ID.Hex()
+	for _, want := range []string{
+		`label="say \"hi\"\nthen \\ leave"`,
+		fmt.Sprintf(`"%s" -> "%s" [dir=none, style=dashed, label="x", weight=1];`, a, b),
+		fmt.Sprintf(`"%s" -> "%s" [weight=1];`, a, b),
+		`// tags on more than 50 notes, without edges: "line\nbreak"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output lacks %s:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "\n") != 8 {
+		t.Errorf("DOT output has %d lines, want 8:\n%s", strings.Count(out, "\n"), out)
+	}
+}
@@ -0,0 +1,117 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustDecode(t *testing.T, data string) any {
+	t.Helper()
+	v, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatalf("Decode(%s): %v", data, err)
+	}
+	return v
+}
+
+// The examples of RFC 7396, appendix A
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		target := mustDecode(t, tt.target)
+		got := Merge(target, mustDecode(t, tt.patch))
+		if !Equal(got, mustDecode(t, tt.want)) {
+			t.Errorf("Merge(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+		if !Equal(target, mustDecode(t, tt.target)) {
+			t.Errorf("Merge(%s, %s) changed the target", tt.target, tt.patch)
+		}
+	}
+}
+
+// Mostly the examples of RFC 6902, appendix A
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc, patch string
+		want       string // the patched document, when err is nil
+		err        error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":2}]`, `{"foo":[1,2]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, nil},
+		{"test passes", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"numbers compare by value", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0}]`, `{"n":1}`, nil},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"replace","path":"/~01","value":11}]`, `{"/":9,"~1":11}`, nil},
+		{"replace whole document", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`, nil},
+
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrConflict},
+		{"missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", ErrConflict},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrConflict},
+		{"index out of range", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":3}]`, "", ErrConflict},
+		{"leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`, "", ErrInvalid},
+		{"unknown op", `{}`, `[{"op":"frobnicate","path":"/a"}]`, "", ErrInvalid},
+		{"missing path", `{}`, `[{"op":"add","value":1}]`, "", ErrInvalid},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, "", ErrInvalid},
+		{"pointer without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, "", ErrInvalid},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, "", ErrInvalid},
+		{"not an array", `{}`, `{"op":"add"}`, "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		doc := mustDecode(t, tt.doc)
+		got, err := Apply(doc, []byte(tt.patch))
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		} else if !Equal(got, mustDecode(t, tt.want)) {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+		if !Equal(doc, mustDecode(t, tt.doc)) {
+			t.Errorf("%s: the document was changed", tt.name)
+		}
+	}
+}
+
+// A patch applies all or nothing
+func TestApplyAtomic(t *testing.T) {
+	doc := mustDecode(t, `{"a":[1,2]}`)
+	_, err := Apply(doc, []byte(`[{"op":"remove","path":"/a/0"},{"op":"test","path":"/a/0","value":1}]`))
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("error = %v, want %v", err, ErrConflict)
+	}
+	if !Equal(doc, mustDecode(t, `{"a":[1,2]}`)) {
+		t.Errorf("document changed to %v by a failed patch", doc)
+	}
+}
@@ -0,0 +1,107 @@
+// Package links finds the [[wiki links]] between notes
+package links
+
+import (
+	"knowledge_base_backend/models"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ref is one [[target]] or [[target|label]] written in a note, with the byte
+// span of the whole link
+type Ref struct {
+	Target     string
+	Label      string
+	Start, End int
+}
+
+// Parse returns the links in content in the order they appear. A link sits
+// on one line and holds no brackets; anything else is left as plain text.
+func Parse(content string) []Ref {
+	var refs []Ref
+	for i := 0; i < len(content); {
+		open := strings.Index(content[i:], "[[")
+		if open < 0 {
+			break
+		}
+		start := i + open
+		body := content[start+2:]
+		end := strings.Index(body, "]]")
+		if end < 0 {
+			break
+		}
+		inner := body[:end]
+		if strings.ContainsAny(inner, "[]\n") {
+			// Skip one bracket so a later [[ on the line is still found
+			i = start + 1
+			continue
+		}
+
+		target, label, _ := strings.Cut(inner, "|")
+		if target = strings.TrimSpace(target); target != "" {
+			refs = append(refs, Ref{
+				Target: target,
+				Label:  strings.TrimSpace(label),
+				Start:  start,
+				End:    start + 2 + end + 2,
+			})
+		}
+		i = start + 2 + end + 2
+	}
+	return refs
+}
+
+// Key is the form targets are matched in: titles match ignoring case and
+// runs of whitespace
+func Key(target string) string {
+	return strings.Join(strings.Fields(strings.ToLower(target)), " ")
+}
+
+// ID returns the note ID a target names, if it is one
+func ID(target string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(target)
+	return id, err == nil
+}
+
+// Edges turns the links written in content into edges, pointing each at the
+// note resolve finds for it, or leaving it broken when resolve returns nil
+func Edges(content string, resolve func(Ref) *primitive.ObjectID) []models.Link {
+	refs := Parse(content)
+	edges := make([]models.Link, 0, len(refs))
+	for _, ref := range refs {
+		edges = append(edges, models.Link{
+			TargetID: resolve(ref),
+			Target:   ref.Target,
+			Key:      Key(ref.Target),
+			Label:    ref.Label,
+			Position: ref.Start,
+		})
+	}
+	return edges
+}
+
+// Rewrite replaces the target of every link in content for which retarget
+// returns a new one, keeping labels
+func Rewrite(content string, retarget func(Ref) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, ref := range Parse(content) {
+		target, ok := retarget(ref)
+		if !ok {
+			continue
+		}
+		b.WriteString(content[last:ref.Start])
+		b.WriteString("[[" + target)
+		if ref.Label != "" {
+			b.WriteString("|" + ref.Label)
+		}
+		b.WriteString("]]")
+		last = ref.End
+	}
+	if last == 0 {
+		return content
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package links
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Ref
+	}{
+		{"see [[Go]] and [[ Rust | the crab ]].", []Ref{
+			{Target: "Go", Start: 4, End: 10},
+			{Target: "Rust", Label: "the crab", Start: 15, End: 36},
+		}},
+		{"[[a]][[b]]", []Ref{{Target: "a", Start: 0, End: 5}, {Target: "b", Start: 5, End: 10}}},
+		{"[[[nested]]", []Ref{{Target: "nested", Start: 1, End: 11}}},
+		{"[[broken\nacross lines]] then [[ok]]", []Ref{{Target: "ok", Start: 29, End: 35}}},
+		{"[[]] [[ |label]]", nil},
+		{"[[never closed", nil},
+		{"no links", nil},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"Meeting Notes":       "meeting notes",
+		"  meeting \t NOTES ": "meeting notes",
+		"Über":                "über",
+	} {
+		if got := Key(in); got != want {
+			t.Errorf("Key(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEdges(t *testing.T) {
+	id := primitive.NewObjectID()
+	edges := Edges("[[Known|it]] and [[Missing Note]]", func(ref Ref) *primitive.ObjectID {
+		if ref.Target == "Known" {
+			return &id
+		}
+		return nil
+	})
+	if len(edges) != 2 {
+		t.Fatalf("%d edges, want 2", len(edges))
+	}
+	if e := edges[0]; e.TargetID == nil || *e.TargetID != id || e.Label != "it" || e.Key != "known" || e.Position != 0 {
+		t.Errorf("resolved edge = %+v", e)
+	}
+	if e := edges[1]; e.TargetID != nil || e.Target != "Missing Note" || e.Key != "missing note" || e.Position != 17 {
+		t.Errorf("broken edge = %+v", e)
+	}
+
+	if got, ok := ID(id.Hex()); !ok || got != id {
+		t.Errorf("ID(%s) = %v, %v", id.Hex(), got, ok)
+	}
+	if _, ok := ID("Known"); ok {
+		t.Error("ID of a title succeeded")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rename := func(ref Ref) (string, bool) {
+		if Key(ref.Target) == "old title" {
+			return "New Title", true
+		}
+		return "", false
+	}
+	tests := []struct{ in, want string }{
+		{"[[Old Title]] and [[old  title|label]] but not [[Other]]",
+			"[[New Title]] and [[New Title|label]] but not [[Other]]"},
+		{"nothing to change [[Other]]", "nothing to change [[Other]]"},
+		{"ends with [[Old Title]]", "ends with [[New Title]]"},
+	}
+	for _, tt := range tests {
+		if got := Rewrite(tt.in, rename); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if in := strings.Repeat("x", 10); Rewrite(in, rename) != in {
+		t.Error("Rewrite changed content without links")
+	}
+}
@@ -1,19 +1,146 @@
 package main
 
 import (
+	"context"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/config"
+	"knowledge_base_backend/controllers"
+	"knowledge_base_backend/export"
+	"knowledge_base_backend/filetype"
+	"knowledge_base_backend/migrate"
 	"knowledge_base_backend/routes"
+	"knowledge_base_backend/search"
+	"knowledge_base_backend/store"
 	"log"
+	"os"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
+	// Load and validate the configuration before touching any backend
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Pick the storage backend
+	var notes store.NoteStore
+	var revisions store.RevisionStore
+	var notebooks store.NotebookStore
+	var links store.LinkStore
+	var imports store.ImportStore
+	var blobs blob.Store
+	switch cfg.Storage.Backend {
+	case "mongo":
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
+		client, err := store.ConnectMongo(ctx, cfg.Mongo.URI)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to connect to MongoDB at %s: %s", cfg.Mongo.URI, err)
+		}
+		defer client.Disconnect(context.Background())
+		db := client.Database(cfg.Mongo.Database)
+		collections := store.MongoCollections{
+			Notes:     db.Collection(cfg.Mongo.NotesCollection),
+			Imports:   db.Collection(cfg.Mongo.ImportsCollection),
+			Revisions: db.Collection(cfg.Mongo.RevisionsCollection),
+			Notebooks: db.Collection(cfg.Mongo.NotebooksCollection),
+			Links:     db.Collection(cfg.Mongo.LinksCollection),
+		}
+		gridfs, err := blob.NewGridFSStore(db, cfg.Mongo.BlobBucket)
+		if err != nil {
+			log.Fatalf("Failed to open GridFS bucket %s: %s", cfg.Mongo.BlobBucket, err)
+		}
+		blobs = gridfs
+
+		// Upgrade documents written by older versions before serving them
+		applied, err := migrate.Run(context.Background(), db.Collection(cfg.Mongo.MigrationsCollection),
+			store.MongoMigrations(collections, blobs))
+		if err != nil {
+			log.Fatalf("Failed to migrate the database: %s", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d: %s", m.Version, m.Description)
+		}
+
+		notes = store.NewMongoNoteStore(collections.Notes)
+		revisions = store.NewMongoRevisionStore(collections.Revisions)
+		notebooks = store.NewMongoNotebookStore(collections.Notebooks)
+		links = store.NewMongoLinkStore(collections.Links)
+		imports = store.NewMongoImportStore(collections.Imports)
+	case "memory":
+		notes = store.NewMemoryNoteStore()
+		revisions = store.NewMemoryRevisionStore()
+		notebooks = store.NewMemoryNotebookStore()
+		links = store.NewMemoryLinkStore()
+		imports = store.NewMemoryImportStore()
+		blobs = blob.NewMemoryStore()
+	}
+
+	// Build the search index from the stored notes
+	index := search.NewIndex()
+	allNotes, err := notes.List(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load notes for the search index: %s", err)
+	}
+	for _, note := range allNotes {
+		index.Add(note)
+	}
+
+	// Confine exported files to the export directory
+	exports, err := export.Open(cfg.Exports.Root)
+	if err != nil {
+		log.Fatalf("Failed to open export directory %s: %s", cfg.Exports.Root, err)
+	}
+
+	// Write PDFs in the fonts configured for scripts the Go fonts lack
+	pdfFonts, err := export.LoadFonts(export.FontFiles(cfg.Exports.PDFFonts))
+	if err != nil {
+		log.Fatalf("Failed to load PDF fonts: %s", err)
+	}
+
+	// Keep the bundles exported in the background until they expire
+	jobs := export.NewJobs(cfg.Exports.JobTTL, cfg.Exports.MaxJobs, cfg.Exports.JobTimeout)
+
 	// Create a new Fiber app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    int(cfg.Server.UploadLimit),
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ReadTimeout:                  cfg.Server.ReadTimeout,
+		WriteTimeout:                 cfg.Server.WriteTimeout,
+		IdleTimeout:                  cfg.Server.IdleTimeout,
+	})
+
+	// Uploads read their body as it arrives; every other request is read in
+	// whole, up to the same limit
+	app.Use(controllers.BufferBody(int64(cfg.Server.UploadLimit), func(c *fiber.Ctx) bool {
+		return c.Method() == fiber.MethodPost && c.Path() == "/imports"
+	}))
 
 	// Set up the routes
-	routes.SetupRoutes(app) // Changed from DefineRoutes to SetupRoutes
+	routes.SetupRoutes(app,
+		controllers.NewNoteController(notes, notebooks, revisions, links, imports, blobs, controllers.ExportSettings{
+			Root:            exports,
+			Jobs:            jobs,
+			BackgroundNotes: cfg.Exports.BackgroundNotes,
+			PDFFonts:        pdfFonts,
+		}, index),
+		controllers.NewImportController(imports, blobs, controllers.ImportSettings{
+			Exports: exports,
+			Types: filetype.Policy{
+				Allow: cfg.Imports.AllowedTypes,
+				Deny:  cfg.Imports.DeniedTypes,
+			},
+			ThumbnailSizes: cfg.Imports.ThumbnailSizes,
+			UploadLimit:    int64(cfg.Server.UploadLimit),
+		}),
+		controllers.NewTagController(notes, imports, revisions, index),
+		controllers.NewNotebookController(notebooks, notes, revisions, links, index),
+		controllers.NewGraphController(notes, links),
+	)
 
-	// Start the server on port 8080
-	log.Fatal(app.Listen(":8080"))
+	// Start the server on the configured address
+	log.Fatal(app.Listen(cfg.Server.ListenAddr))
 }
@@ -0,0 +1,140 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"knowledge_base_backend/models"
+	"strings"
+)
+
+// aviAudioFormats maps WAVEFORMATEX format tags to codec names
+var aviAudioFormats = map[uint16]string{
+	0x0001: "pcm",
+	0x0055: "mp3",
+	0x00ff: "aac",
+	0x2000: "ac3",
+	0x2001: "dts",
+}
+
+func matchAVI(header []byte) bool {
+	return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI "
+}
+
+// probeAVI reads the main AVI header for the frame rate, frame count and size,
+// then each stream header for its codec. Only the hdrl list is read.
+func probeAVI(r io.ReadSeeker) (*models.MediaInfo, error) {
+	info := &models.MediaInfo{Format: "avi"}
+
+	// Skip the RIFF header and find the hdrl list
+	offset := int64(12)
+	for {
+		id, size, err := readRIFFChunk(r, offset)
+		if err != nil {
+			return nil, err
+		}
+		if id == "LIST" {
+			listType := make([]byte, 4)
+			if _, err := io.ReadFull(r, listType); err != nil {
+				return nil, err
+			}
+			if string(listType) == "hdrl" {
+				return info, walkAVIHeaders(r, offset+12, offset+8+size, info)
+			}
+		}
+		offset += 8 + size + size%2
+	}
+}
+
+// walkAVIHeaders visits the avih chunk and strl lists inside hdrl
+func walkAVIHeaders(r io.ReadSeeker, start, end int64, info *models.MediaInfo) error {
+	var streamType string
+	for offset := start; offset+8 <= end; {
+		id, size, err := readRIFFChunk(r, offset)
+		if err != nil {
+			return err
+		}
+		switch id {
+		case "LIST":
+			// strl lists hold one stream's strh and strf chunks
+			if err := walkAVIHeaders(r, offset+12, offset+8+size, info); err != nil {
+				return err
+			}
+		case "avih":
+			p, err := readChunkData(r, size, 40)
+			if err != nil {
+				return err
+			}
+			microSecPerFrame := binary.LittleEndian.Uint32(p[0:4])
+			totalFrames := binary.LittleEndian.Uint32(p[16:20])
+			info.Duration = float64(totalFrames) * float64(microSecPerFrame) / 1e6
+			info.Width = int(binary.LittleEndian.Uint32(p[32:36]))
+			info.Height = int(binary.LittleEndian.Uint32(p[36:40]))
+		case "strh":
+			p, err := readChunkData(r, size, 8)
+			if err != nil {
+				return err
+			}
+			streamType = string(p[0:4])
+			if streamType == "vids" && info.VideoCodec == "" {
+				info.VideoCodec = fourccName(p[4:8])
+			}
+		case "strf":
+			switch streamType {
+			case "vids":
+				// BITMAPINFOHEADER.biCompression is more reliable than fccHandler
+				p, err := readChunkData(r, size, 20)
+				if err == nil {
+					if codec := fourccName(p[16:20]); codec != "" {
+						info.VideoCodec = codec
+					}
+				}
+			case "auds":
+				p, err := readChunkData(r, size, 2)
+				if err == nil && info.AudioCodec == "" {
+					tag := binary.LittleEndian.Uint16(p[0:2])
+					if name, ok := aviAudioFormats[tag]; ok {
+						info.AudioCodec = name
+					}
+				}
+			}
+		}
+		offset += 8 + size + size%2
+	}
+	return nil
+}
+
+// readRIFFChunk reads the chunk header at offset, leaving r at the chunk data
+func readRIFFChunk(r io.ReadSeeker, offset int64) (string, int64, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", 0, err
+	}
+	return string(header[0:4]), int64(binary.LittleEndian.Uint32(header[4:8])), nil
+}
+
+// readChunkData reads the first n bytes of the chunk data at the current offset
+func readChunkData(r io.Reader, size int64, n int) ([]byte, error) {
+	if size < int64(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(r, p)
+	return p, err
+}
+
+// fourccName normalises a video fourcc such as "H264" or "XVID"
+func fourccName(b []byte) string {
+	name := strings.ToLower(strings.TrimRight(string(b), "\x00 "))
+	switch name {
+	case "h264", "x264", "avc1":
+		return "h264"
+	case "xvid", "divx", "dx50", "fmp4":
+		return "mpeg4"
+	case "mjpg":
+		return "mjpeg"
+	}
+	return name
+}
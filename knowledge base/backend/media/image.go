@@ -0,0 +1,34 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"knowledge_base_backend/models"
+
+	_ "golang.org/x/image/webp"
+)
+
+func matchImage(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("\xff\xd8\xff")) ||
+		bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")) ||
+		bytes.HasPrefix(header, []byte("GIF87a")) ||
+		bytes.HasPrefix(header, []byte("GIF89a")) ||
+		(len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP")
+}
+
+// probeImage decodes only the image header, never the pixel data
+func probeImage(r io.ReadSeeker) (*models.MediaInfo, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MediaInfo{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}, nil
+}
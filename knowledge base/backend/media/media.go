@@ -0,0 +1,44 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"knowledge_base_backend/models"
+)
+
+// ErrUnknownFormat is returned when the content is not a supported image or video
+var ErrUnknownFormat = errors.New("media: unknown format")
+
+// prober extracts metadata from one container format
+type prober struct {
+	match func(header []byte) bool
+	probe func(r io.ReadSeeker) (*models.MediaInfo, error)
+}
+
+var probers = []prober{
+	{matchImage, probeImage},
+	{matchMP4, probeMP4},
+	{matchAVI, probeAVI},
+}
+
+// Probe reads the dimensions, duration and codecs of an image or video.
+// The reader is left at an unspecified offset.
+func Probe(r io.ReadSeeker) (*models.MediaInfo, error) {
+	header := make([]byte, 16)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, ErrUnknownFormat
+	}
+	header = header[:n]
+
+	for _, p := range probers {
+		if !p.match(header) {
+			continue
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return p.probe(r)
+	}
+	return nil, ErrUnknownFormat
+}
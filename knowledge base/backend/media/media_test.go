@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"knowledge_base_backend/models"
+	"strings"
+	"testing"
+)
+
+// box builds an ISO base media box
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, boxType...), body...)
+}
+
+// mvhd builds a version 0 movie header with the given timescale and duration
+func mvhd(timescale, duration uint32) []byte {
+	p := make([]byte, 20)
+	binary.BigEndian.PutUint32(p[12:16], timescale)
+	binary.BigEndian.PutUint32(p[16:20], duration)
+	return box("mvhd", p)
+}
+
+// track builds a trak box of the handler, sample entry and size
+func track(handler, fourcc string, width, height uint32) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:80], width<<16)
+	binary.BigEndian.PutUint32(tkhd[80:84], height<<16)
+	hdlr := append(make([]byte, 8), handler...)
+	stsd := append(make([]byte, 12), fourcc...)
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia", box("hdlr", hdlr), box("minf", box("stbl", box("stsd", stsd)))),
+	)
+}
+
+// riff builds a RIFF chunk, padded to an even length
+func riff(id string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	b := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(body)))
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testAVI() []byte {
+	avih := make([]byte, 40)
+	binary.LittleEndian.PutUint32(avih[0:4], 40000) // 25 fps
+	binary.LittleEndian.PutUint32(avih[16:20], 50)
+	binary.LittleEndian.PutUint32(avih[32:36], 320)
+	binary.LittleEndian.PutUint32(avih[36:40], 240)
+	bih := make([]byte, 20)
+	copy(bih[16:20], "XVID")
+	wave := binary.LittleEndian.AppendUint16(nil, 0x0055)
+	hdrl := riff("LIST", []byte("hdrl"),
+		riff("avih", avih),
+		riff("LIST", []byte("strl"), riff("strh", []byte("vidsxvid")), riff("strf", bih)),
+		riff("LIST", []byte("strl"), riff("strh", []byte("auds\x00\x00\x00\x00")), riff("strf", wave)),
+	)
+	return riff("RIFF", []byte("AVI "), hdrl)
+}
+
+func TestProbe(t *testing.T) {
+	mp4 := bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		box("moov", mvhd(1000, 2500), track("vide", "avc1", 1920, 1080), track("soun", "mp4a", 0, 0)),
+		box("mdat", []byte("not read")),
+	}, nil)
+	mov := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  \x00\x00\x00\x00")),
+		box("moov", mvhd(600, 600), track("vide", "xyz1", 640, 480)),
+	}, nil)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    models.MediaInfo
+	}{
+		{"png", testPNG(t), models.MediaInfo{Format: "png", Width: 3, Height: 2}},
+		{"mp4", mp4, models.MediaInfo{Format: "mp4", Width: 1920, Height: 1080, Duration: 2.5, VideoCodec: "h264", AudioCodec: "aac"}},
+		{"mov with unknown codec", mov, models.MediaInfo{Format: "mov", Width: 640, Height: 480, Duration: 1, VideoCodec: "xyz1"}},
+		{"avi", testAVI(), models.MediaInfo{Format: "avi", Width: 320, Height: 240, Duration: 2, VideoCodec: "mpeg4", AudioCodec: "mp3"}},
+	}
+	for _, tt := range tests {
+		got, err := Probe(bytes.NewReader(tt.content))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: Probe = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestProbeMalformed(t *testing.T) {
+	deep := box("stbl")
+	for i := 0; i < maxBoxDepth+1; i++ {
+		deep = box("stbl", deep)
+	}
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"unknown", []byte("just some text here")},
+		{"empty", nil},
+		{"mp4 without moov", box("ftyp", []byte("isom"))},
+		{"box past the end", append(box("ftyp", []byte("isom")), "\x00\x00\x10\x00moov"...)},
+		{"box smaller than its header", append(box("ftyp", []byte("isom")), "\x00\x00\x00\x04moov"...)},
+		{"boxes nested too deeply", append(box("ftyp", []byte("isom")), box("moov", deep)...)},
+		{"truncated png", testPNG(t)[:20]},
+	}
+	for _, tt := range tests {
+		if info, err := Probe(bytes.NewReader(tt.content)); err == nil {
+			t.Errorf("%s: Probe = %+v, want an error", tt.name, info)
+		}
+	}
+}
+
+// Boxes nested far past maxBoxDepth are rejected rather than walked
+func TestProbeNestingBound(t *testing.T) {
+	var b strings.Builder
+	b.Write(box("ftyp", []byte("isom")))
+	const levels = 100000
+	for i := levels; i > 0; i-- {
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(8*i)))
+		b.WriteString("moov")
+	}
+	if _, err := Probe(strings.NewReader(b.String())); err == nil {
+		t.Error("Probe accepted boxes nested", levels, "deep")
+	}
+}
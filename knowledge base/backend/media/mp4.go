@@ -0,0 +1,248 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"knowledge_base_backend/models"
+)
+
+// maxBoxPayload bounds how much of a metadata box is read into memory
+const maxBoxPayload = 1 << 20
+
+// maxBoxDepth bounds how deeply container boxes may nest; real files stop
+// at moov/trak/mdia/minf/stbl
+const maxBoxDepth = 16
+
+// mp4Codecs maps sample entry fourccs to codec names
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "h265",
+	"hev1": "h265",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"av01": "av1",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"alac": "alac",
+}
+
+func matchMP4(header []byte) bool {
+	if len(header) < 8 {
+		return false
+	}
+	switch string(header[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// mp4Track collects what one trak box says about its track
+type mp4Track struct {
+	handler       string
+	codec         string
+	width, height int
+}
+
+// probeMP4 walks the ISO base media box tree of MP4 and QuickTime files,
+// reading mvhd for the duration and each trak's tkhd, hdlr and stsd boxes
+// for the resolution and codecs. Media data boxes are skipped, not read.
+func probeMP4(r io.ReadSeeker) (*models.MediaInfo, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	info := &models.MediaInfo{Format: "mp4"}
+	var tracks []*mp4Track
+	var track *mp4Track
+	var foundMoov bool
+
+	var walk func(start, end int64, depth int) error
+	walk = func(start, end int64, depth int) error {
+		if depth > maxBoxDepth {
+			return errors.New("media: mp4 boxes nest too deeply")
+		}
+		for offset := start; offset+8 <= end; {
+			size, boxType, headerLen, err := readBoxHeader(r, offset, end)
+			if err != nil {
+				return err
+			}
+			payloadStart, boxEnd := offset+headerLen, offset+size
+
+			switch boxType {
+			case "ftyp":
+				payload, err := readPayload(r, payloadStart, boxEnd)
+				if err != nil {
+					return err
+				}
+				if len(payload) >= 4 && string(payload[:4]) == "qt  " {
+					info.Format = "mov"
+				}
+			case "moov":
+				foundMoov = true
+				if err := walk(payloadStart, boxEnd, depth+1); err != nil {
+					return err
+				}
+			case "trak":
+				track = &mp4Track{}
+				tracks = append(tracks, track)
+				if err := walk(payloadStart, boxEnd, depth+1); err != nil {
+					return err
+				}
+				track = nil
+			case "mdia", "minf", "stbl":
+				if err := walk(payloadStart, boxEnd, depth+1); err != nil {
+					return err
+				}
+			case "mvhd":
+				payload, err := readPayload(r, payloadStart, boxEnd)
+				if err != nil {
+					return err
+				}
+				info.Duration = parseMvhd(payload)
+			case "tkhd":
+				payload, err := readPayload(r, payloadStart, boxEnd)
+				if err != nil {
+					return err
+				}
+				if track != nil {
+					track.width, track.height = parseTkhd(payload)
+				}
+			case "hdlr":
+				payload, err := readPayload(r, payloadStart, boxEnd)
+				if err != nil {
+					return err
+				}
+				if track != nil && len(payload) >= 12 {
+					track.handler = string(payload[8:12])
+				}
+			case "stsd":
+				payload, err := readPayload(r, payloadStart, boxEnd)
+				if err != nil {
+					return err
+				}
+				if track != nil && len(payload) >= 16 {
+					fourcc := string(payload[12:16])
+					if name, ok := mp4Codecs[fourcc]; ok {
+						track.codec = name
+					} else {
+						track.codec = fourcc
+					}
+				}
+			}
+			offset = boxEnd
+		}
+		return nil
+	}
+	if err := walk(0, end, 0); err != nil {
+		return nil, err
+	}
+	if !foundMoov {
+		return nil, errors.New("media: mp4 has no moov box")
+	}
+
+	for _, t := range tracks {
+		switch t.handler {
+		case "vide":
+			if info.VideoCodec == "" {
+				info.VideoCodec = t.codec
+				info.Width, info.Height = t.width, t.height
+			}
+		case "soun":
+			if info.AudioCodec == "" {
+				info.AudioCodec = t.codec
+			}
+		}
+	}
+	return info, nil
+}
+
+// readBoxHeader reads the size and type of the box at offset, resolving
+// 64-bit and to-end-of-file sizes
+func readBoxHeader(r io.ReadSeeker, offset, end int64) (size int64, boxType string, headerLen int64, err error) {
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	var header [16]byte
+	if _, err = io.ReadFull(r, header[:8]); err != nil {
+		return
+	}
+	size, boxType, headerLen = int64(binary.BigEndian.Uint32(header[0:4])), string(header[4:8]), 8
+	switch size {
+	case 0:
+		size = end - offset
+	case 1:
+		if _, err = io.ReadFull(r, header[8:16]); err != nil {
+			return
+		}
+		size, headerLen = int64(binary.BigEndian.Uint64(header[8:16])), 16
+	}
+	if size < headerLen || offset+size > end {
+		err = errors.New("media: malformed mp4 box " + boxType)
+	}
+	return
+}
+
+// readPayload reads a box payload, truncated to maxBoxPayload bytes
+func readPayload(r io.ReadSeeker, start, end int64) ([]byte, error) {
+	n := end - start
+	if n > maxBoxPayload {
+		n = maxBoxPayload
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+// parseMvhd returns the movie duration in seconds
+func parseMvhd(p []byte) float64 {
+	if len(p) < 1 {
+		return 0
+	}
+	var timescale, duration uint64
+	if p[0] == 1 {
+		if len(p) < 32 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(p[20:24]))
+		duration = binary.BigEndian.Uint64(p[24:32])
+	} else {
+		if len(p) < 20 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(p[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(p[16:20]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return float64(duration) / float64(timescale)
+}
+
+// parseTkhd returns the track's presentation size, stored as 16.16 fixed point
+func parseTkhd(p []byte) (int, int) {
+	at := 76
+	if len(p) > 0 && p[0] == 1 {
+		at = 88
+	}
+	if len(p) < at+8 {
+		return 0, 0
+	}
+	width := binary.BigEndian.Uint32(p[at : at+4])
+	height := binary.BigEndian.Uint32(p[at+4 : at+8])
+	return int(width >> 16), int(height >> 16)
+}
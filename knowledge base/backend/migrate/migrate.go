@@ -0,0 +1,75 @@
+// Package migrate applies versioned schema migrations to a MongoDB database
+// and records which have run
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration upgrades stored documents to its schema version. Up must be safe
+// to run twice: a crash between Up finishing and the migration being recorded
+// runs it again on the next start.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context) error
+}
+
+// record is how an applied migration is stored
+type record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Run applies the migrations not yet recorded in records, in version order,
+// recording each as it completes. It returns the migrations it applied. A
+// database already migrated past the newest known version is an error, as it
+// was written by a newer server.
+func Run(ctx context.Context, records *mongo.Collection, migrations []Migration) ([]Migration, error) {
+	migrations = append([]Migration(nil), migrations...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version < 1 || (i > 0 && m.Version == migrations[i-1].Version) {
+			return nil, fmt.Errorf("migrate: invalid or duplicate version %d", m.Version)
+		}
+	}
+
+	cursor, err := records.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var done []record
+	if err := cursor.All(ctx, &done); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool, len(done))
+	for _, r := range done {
+		applied[r.Version] = true
+		if len(migrations) == 0 || r.Version > migrations[len(migrations)-1].Version {
+			return nil, fmt.Errorf("migrate: database has migration %d (%s), newer than this server supports", r.Version, r.Description)
+		}
+	}
+
+	var ran []Migration
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := m.Up(ctx); err != nil {
+			return ran, fmt.Errorf("migrate: migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		r := record{Version: m.Version, Description: m.Description, AppliedAt: time.Now().UTC()}
+		if _, err := records.InsertOne(ctx, r); err != nil {
+			return ran, fmt.Errorf("migrate: recording migration %d: %w", m.Version, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// recorded answers the find for applied migrations with these versions
+func recorded(versions ...int) bson.D {
+	docs := make([]bson.D, len(versions))
+	for i, v := range versions {
+		docs[i] = bson.D{{Key: "_id", Value: v}, {Key: "description", Value: "earlier"}}
+	}
+	return mtest.CreateCursorResponse(0, "kb.migrations", mtest.FirstBatch, docs...)
+}
+
+// migrations returns migrations with the given versions that log to ran
+// when applied, failing at version fail
+func migrations(ran *[]int, fail int, versions ...int) []Migration {
+	var list []Migration
+	for _, v := range versions {
+		list = append(list, Migration{Version: v, Description: "test", Up: func(context.Context) error {
+			if v == fail {
+				return errors.New("boom")
+			}
+			*ran = append(*ran, v)
+			return nil
+		}})
+	}
+	return list
+}
+
+func versions(list []Migration) []int {
+	var vs []int
+	for _, m := range list {
+		vs = append(vs, m.Version)
+	}
+	return vs
+}
+
+// insertedVersions lists the versions Run recorded
+func insertedVersions(mt *mtest.T) []int {
+	var vs []int
+	for _, e := range mt.GetAllStartedEvents() {
+		if e.CommandName != "insert" {
+			continue
+		}
+		docs, _ := e.Command.Lookup("documents").Array().Values()
+		for _, doc := range docs {
+			v, _ := doc.Document().Lookup("_id").AsInt64OK()
+			vs = append(vs, int(v))
+		}
+	}
+	return vs
+}
+
+func TestRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+
+	mt.Run("applies pending migrations in order", func(mt *mtest.T) {
+		mt.AddMockResponses(recorded(1), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		var ran []int
+		applied, err := Run(ctx, mt.Coll, migrations(&ran, 0, 3, 1, 2))
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if !slices.Equal(ran, []int{2, 3}) || !slices.Equal(versions(applied), []int{2, 3}) {
+			mt.Errorf("ran %v and returned %v, want [2 3]", ran, versions(applied))
+		}
+		if got := insertedVersions(mt); !slices.Equal(got, []int{2, 3}) {
+			mt.Errorf("recorded %v, want [2 3]", got)
+		}
+	})
+
+	mt.Run("nothing pending", func(mt *mtest.T) {
+		mt.AddMockResponses(recorded(1, 2))
+		var ran []int
+		applied, err := Run(ctx, mt.Coll, migrations(&ran, 0, 1, 2))
+		if err != nil || len(applied) != 0 || len(ran) != 0 {
+			mt.Errorf("Run = %v, %v after running %v, want nothing run", versions(applied), err, ran)
+		}
+	})
+
+	mt.Run("failed migration is not recorded", func(mt *mtest.T) {
+		mt.AddMockResponses(recorded(), mtest.CreateSuccessResponse())
+		var ran []int
+		applied, err := Run(ctx, mt.Coll, migrations(&ran, 2, 1, 2, 3))
+		if err == nil || !strings.Contains(err.Error(), "migration 2 (test): boom") {
+			mt.Errorf("error %v, want migration 2's", err)
+		}
+		if !slices.Equal(versions(applied), []int{1}) || !slices.Equal(ran, []int{1}) {
+			mt.Errorf("ran %v and returned %v, want [1]", ran, versions(applied))
+		}
+		if got := insertedVersions(mt); !slices.Equal(got, []int{1}) {
+			mt.Errorf("recorded %v, want [1]", got)
+		}
+	})
+
+	mt.Run("recording fails", func(mt *mtest.T) {
+		mt.AddMockResponses(recorded(), mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}))
+		var ran []int
+		applied, err := Run(ctx, mt.Coll, migrations(&ran, 0, 1, 2))
+		if err == nil || !strings.Contains(err.Error(), "recording migration 1") || !mongo.IsDuplicateKeyError(err) {
+			mt.Errorf("error %v, want a duplicate key recording migration 1", err)
+		}
+		if len(applied) != 0 || !slices.Equal(ran, []int{1}) {
+			mt.Errorf("ran %v and returned %v, want migration 1 run but not returned", ran, versions(applied))
+		}
+	})
+
+	mt.Run("database newer than server", func(mt *mtest.T) {
+		mt.AddMockResponses(recorded(1, 4))
+		var ran []int
+		_, err := Run(ctx, mt.Coll, migrations(&ran, 0, 1, 2))
+		if err == nil || !strings.Contains(err.Error(), "has migration 4") {
+			mt.Errorf("error %v, want one naming migration 4", err)
+		}
+		if len(ran) != 0 {
+			mt.Errorf("ran %v against a newer database", ran)
+		}
+	})
+
+	mt.Run("invalid versions", func(mt *mtest.T) {
+		for _, vs := range [][]int{{0, 1}, {1, 2, 2}, {-3}} {
+			var ran []int
+			if _, err := Run(ctx, mt.Coll, migrations(&ran, 0, vs...)); err == nil || !strings.Contains(err.Error(), "invalid or duplicate version") {
+				mt.Errorf("Run with versions %v: error %v", vs, err)
+			}
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			mt.Errorf("Run sent %d commands before rejecting the versions", n)
+		}
+	})
+}
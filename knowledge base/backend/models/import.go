@@ -6,15 +6,38 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Import represents a file imported into the knowledge base
+// Import represents a file imported into the knowledge base. The file content
+// itself lives in a blob store under BlobID.
 type Import struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	FileName   string             `bson:"file_name" json:"file_name"`
-	Location   string             `bson:"location" json:"location"`
-	Tags       string             `bson:"tags" json:"tags"`
-	FileType   string             `bson:"file_type" json:"file_type"`
-	Data       []byte             `bson:"data" json:"data"`
-	Resolution *string            `bson:"resolution,omitempty" json:"resolution,omitempty"`
-	Duration   *string            `bson:"duration,omitempty" json:"duration,omitempty"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileName       string             `bson:"file_name" json:"file_name"`
+	Location       string             `bson:"location" json:"location"`
+	Tags           []string           `bson:"tags" json:"tags"`
+	FileType       string             `bson:"file_type" json:"file_type"`
+	MIMEType       string             `bson:"mime_type,omitempty" json:"mime_type,omitempty"`
+	BlobID         string             `bson:"blob_id" json:"blob_id"`
+	Size           int64              `bson:"size" json:"size"`
+	Media          *MediaInfo         `bson:"media,omitempty" json:"media,omitempty"`
+	Thumbnails     []Thumbnail        `bson:"thumbnails,omitempty" json:"thumbnails,omitempty"`
+	ThumbnailError string             `bson:"thumbnail_error,omitempty" json:"thumbnail_error,omitempty"` // why none could be made, so they are not retried
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MediaInfo holds the properties read from an image or video file
+type MediaInfo struct {
+	Format     string  `bson:"format" json:"format"`
+	Width      int     `bson:"width,omitempty" json:"width,omitempty"`
+	Height     int     `bson:"height,omitempty" json:"height,omitempty"`
+	Duration   float64 `bson:"duration,omitempty" json:"duration,omitempty"` // seconds
+	VideoCodec string  `bson:"video_codec,omitempty" json:"video_codec,omitempty"`
+	AudioCodec string  `bson:"audio_codec,omitempty" json:"audio_codec,omitempty"`
+}
+
+// Thumbnail is a downscaled rendition of an image import stored as its own blob
+type Thumbnail struct {
+	Size   int    `bson:"size" json:"size"`
+	Width  int    `bson:"width" json:"width"`
+	Height int    `bson:"height" json:"height"`
+	MIME   string `bson:"mime_type" json:"mime_type"`
+	BlobID string `bson:"blob_id" json:"-"`
 }
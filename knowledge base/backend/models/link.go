@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Link is a [[wiki link]] from one note to another, stored as an edge so
+// backlinks can be looked up. A link whose target matches no note is broken
+// and has no TargetID until a note with that title or ID appears.
+type Link struct {
+	ID       primitive.ObjectID  `json:"-" bson:"_id,omitempty"`
+	SourceID primitive.ObjectID  `json:"source_id" bson:"source_id"`
+	TargetID *primitive.ObjectID `json:"target_id" bson:"target_id"`
+	Target   string              `json:"target" bson:"target"` // as written between the brackets
+	Key      string              `json:"-" bson:"key"`         // Target as matched against titles
+	Label    string              `json:"label,omitempty" bson:"label,omitempty"`
+	Position int                 `json:"position" bson:"position"` // byte offset of the link in the source content
+}
@@ -1,12 +1,50 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
-
-type Note struct { //creates a note struct for the note model
-	ID            primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Title         string             `json:"title"`
-	Content       string             `json:"content"`
-	Tags          []string           `json:"tags"`
-	CreatedAt     string             `json:"created_at"`
-	FormattedDate string             `json:"formatted_date"`
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Formats a note's content can be written in
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// Note is a titled piece of text with tags, filed in a notebook or in none.
+// The server sets its timestamps and version; clients only edit the title,
+// content, format, tags and notebook.
+type Note struct {
+	ID         primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	Title      string              `json:"title" bson:"title"`
+	Content    string              `json:"content,omitempty" bson:"content"` // left out of listings unless asked for
+	Format     string              `json:"format" bson:"format"`             // FormatPlain or FormatMarkdown
+	Tags       []string            `json:"tags" bson:"tags"`
+	NotebookID *primitive.ObjectID `json:"notebook_id" bson:"notebook_id"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at" bson:"updated_at"`
+	Version    int                 `json:"version" bson:"version"` // bumped by every write, for optimistic concurrency
+}
+
+// IsFormat reports whether format is one notes can be written in
+func IsFormat(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown
+}
+
+// FormattedDate is the creation date as shown to readers, in server local time
+func (n Note) FormattedDate() string {
+	return n.CreatedAt.Local().Format("January 2, 2006")
+}
+
+// noteFields is Note without its methods, so MarshalJSON can embed it
+type noteFields Note
+
+// MarshalJSON adds the formatted_date computed from created_at
+func (n Note) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		noteFields
+		FormattedDate string `json:"formatted_date"`
+	}{noteFields(n), n.FormattedDate()})
 }
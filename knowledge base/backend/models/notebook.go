@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notebook is a folder of notes. Notebooks nest: a notebook without a parent
+// sits at the top level.
+type Notebook struct {
+	ID        primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name      string              `json:"name" bson:"name"`
+	ParentID  *primitive.ObjectID `json:"parent_id" bson:"parent_id"`
+	Inbox     bool                `json:"inbox,omitempty" bson:"inbox,omitempty"` // receives the notes of deleted notebooks
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision is an immutable snapshot of a note taken each time it is written.
+// Revisions of a note are numbered from 1 in the order they were recorded.
+type Revision struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	NoteID       primitive.ObjectID `bson:"note_id" json:"note_id"`
+	Number       int                `bson:"number" json:"number"`
+	Title        string             `bson:"title" json:"title"`
+	Content      string             `bson:"content" json:"content"`
+	Format       string             `bson:"format,omitempty" json:"format,omitempty"` // empty in revisions taken before notes had formats
+	Tags         []string           `bson:"tags" json:"tags"`
+	Author       string             `bson:"author,omitempty" json:"author,omitempty"`
+	Hash         string             `bson:"hash" json:"hash"`
+	RestoredFrom int                `bson:"restored_from,omitempty" json:"restored_from,omitempty"` // revision this one restored
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NewRevision snapshots the editable fields of the note
+func NewRevision(note Note, author string) Revision {
+	return Revision{
+		NoteID:    note.ID,
+		Title:     note.Title,
+		Content:   note.Content,
+		Format:    note.Format,
+		Tags:      append([]string(nil), note.Tags...),
+		Author:    author,
+		Hash:      ContentHash(note.Title, note.Content, note.Tags),
+		CreatedAt: time.Now(),
+	}
+}
+
+// NoteFormat is the format of the snapshotted content. Revisions taken
+// before notes had formats hold plain text.
+func (r Revision) NoteFormat() string {
+	if r.Format == "" {
+		return FormatPlain
+	}
+	return r.Format
+}
+
+// ContentHash returns the hex SHA-256 of a note's title, content and tags,
+// so identical versions of a note hash alike
+func ContentHash(title, content string, tags []string) string {
+	h := sha256.New()
+	h.Write([]byte(title))
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+	for _, tag := range tags {
+		h.Write([]byte{0})
+		h.Write([]byte(tag))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Node is a parsed query expression
+type Node interface {
+	node()
+}
+
+// Field names a part of a note that a term is matched against
+type Field string
+
+// Searchable fields
+const (
+	AnyField Field = ""
+	Title    Field = "title"
+	Content  Field = "content"
+	Tags     Field = "tag"
+	Created  Field = "created"
+	Updated  Field = "updated"
+)
+
+// And matches notes matching every child
+type And struct {
+	Nodes []Node
+}
+
+// Or matches notes matching any child
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches notes the child does not match
+type Not struct {
+	Node Node
+}
+
+// Text matches a word or phrase in the title, content or tags. A word also
+// matches its inflections, so "planned" matches "planning".
+type Text struct {
+	Field  Field // AnyField, Title or Content
+	Value  string
+	Phrase bool
+}
+
+// Tag matches notes carrying the tag or a tag below it, as in "project"
+// matching "project/alpha", once both are normalized
+type Tag struct {
+	Value string
+}
+
+// DateRange matches notes whose date field falls in [From, To). A zero
+// bound leaves that side of the range open.
+type DateRange struct {
+	Field    Field
+	From, To time.Time
+}
+
+// Notebook matches notes filed in any of the notebooks, or notes in no
+// notebook when IDs is empty. Queries cannot spell it; callers build it.
+type Notebook struct {
+	IDs []primitive.ObjectID
+}
+
+// TitleIs matches notes titled Value, ignoring case and runs of whitespace.
+// Queries cannot spell it; callers build it.
+type TitleIs struct {
+	Value string
+}
+
+// NoteIDs matches the notes with any of the IDs. Queries cannot spell it;
+// Resolve builds it from words and phrases.
+type NoteIDs struct {
+	IDs []primitive.ObjectID
+}
+
+func (And) node()       {}
+func (Or) node()        {}
+func (Not) node()       {}
+func (Text) node()      {}
+func (Tag) node()       {}
+func (DateRange) node() {}
+func (Notebook) node()  {}
+func (TitleIs) node()   {}
+func (NoteIDs) node()   {}
+
+// Terms returns the words and phrases the query asks to find, leaving out
+// negated ones, for ranking and highlighting the matches
+func Terms(n Node) []string {
+	var terms []string
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case And:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case Or:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case Text:
+			terms = append(terms, n.Value)
+		}
+	}
+	walk(n)
+	return terms
+}
@@ -0,0 +1,107 @@
+package query
+
+import (
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/tags"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Matcher evaluates a query against notes held in memory
+type Matcher struct {
+	root Node
+	res  map[Text]*regexp.Regexp
+}
+
+// NewMatcher compiles the query for repeated matching
+func NewMatcher(n Node) *Matcher {
+	m := &Matcher{root: n, res: make(map[Text]*regexp.Regexp)}
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case And:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case Or:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case Not:
+			walk(n.Node)
+		case Text:
+			if _, ok := m.res[n]; !ok {
+				m.res[n] = regexp.MustCompile("(?i)" + n.pattern())
+			}
+		}
+	}
+	walk(n)
+	return m
+}
+
+// Match reports whether the note satisfies the query. A nil query matches
+// every note.
+func (m *Matcher) Match(note models.Note) bool {
+	if m.root == nil {
+		return true
+	}
+	return m.match(m.root, note)
+}
+
+func (m *Matcher) match(n Node, note models.Note) bool {
+	switch n := n.(type) {
+	case And:
+		for _, child := range n.Nodes {
+			if !m.match(child, note) {
+				return false
+			}
+		}
+		return true
+	case Or:
+		for _, child := range n.Nodes {
+			if m.match(child, note) {
+				return true
+			}
+		}
+		return false
+	case Not:
+		return !m.match(n.Node, note)
+	case Text:
+		re := m.res[n]
+		switch n.Field {
+		case Title:
+			return re.MatchString(note.Title)
+		case Content:
+			return re.MatchString(note.Content)
+		}
+		if re.MatchString(note.Title) || re.MatchString(note.Content) {
+			return true
+		}
+		for _, tag := range note.Tags {
+			if re.MatchString(tag) {
+				return true
+			}
+		}
+		return false
+	case Tag:
+		prefix := tags.Normalize(n.Value)
+		return slices.ContainsFunc(note.Tags, func(tag string) bool { return tags.Within(tag, prefix) })
+	case DateRange:
+		t := note.CreatedAt
+		if n.Field == Updated {
+			t = note.UpdatedAt
+		}
+		return (n.From.IsZero() || !t.Before(n.From)) && (n.To.IsZero() || t.Before(n.To))
+	case TitleIs:
+		return strings.EqualFold(strings.Join(strings.Fields(note.Title), " "), strings.Join(strings.Fields(n.Value), " "))
+	case Notebook:
+		if len(n.IDs) == 0 {
+			return note.NotebookID == nil
+		}
+		return note.NotebookID != nil && slices.Contains(n.IDs, *note.NotebookID)
+	case NoteIDs:
+		return slices.Contains(n.IDs, note.ID)
+	}
+	return false
+}
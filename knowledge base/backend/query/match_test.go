@@ -0,0 +1,160 @@
+package query
+
+import (
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/search"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTextPattern(t *testing.T) {
+	tests := []struct {
+		text    Text
+		match   []string
+		nomatch []string
+	}{
+		{Text{Value: "planned"}, []string{"we plan", "Planning ahead", "(plans)"}, []string{"airplane", "explained"}},
+		{Text{Value: "über"}, []string{"Über alles", "kurz über lang"}, []string{"drüber"}},
+		{Text{Value: "мир"}, []string{"Привет, мир!", "МИР"}, []string{"примир"}},
+		{Text{Value: "привет мир", Phrase: true}, []string{"привет, мир", "ПРИВЕТ  МИР"}, []string{"привет мирный", "мир привет"}},
+		{Text{Value: "exact phrase", Phrase: true}, []string{"an exact-phrase here"}, []string{"exact phrases", "inexact phrase"}},
+		{Text{Value: "2024"}, []string{"in 2024."}, []string{"a2024"}},
+		{Text{Value: "a+b"}, []string{"a + b"}, []string{"ab"}},
+		{Text{Value: "++"}, []string{"c++"}, []string{"c+"}},
+	}
+	for _, tt := range tests {
+		re, err := regexp.Compile("(?i)" + tt.text.pattern())
+		if err != nil {
+			t.Errorf("%+v: pattern %q does not compile: %v", tt.text, tt.text.pattern(), err)
+			continue
+		}
+		for _, s := range tt.match {
+			if !re.MatchString(s) {
+				t.Errorf("%+v: pattern %q does not match %q", tt.text, tt.text.pattern(), s)
+			}
+		}
+		for _, s := range tt.nomatch {
+			if re.MatchString(s) {
+				t.Errorf("%+v: pattern %q matches %q", tt.text, tt.text.pattern(), s)
+			}
+		}
+	}
+}
+
+func TestMongo(t *testing.T) {
+	id := primitive.NewObjectID()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		node Node
+		want bson.M
+	}{
+		{nil, bson.M{}},
+		{Tag{Value: "Work"}, bson.M{"tags": bson.M{"$regex": `^work(/|$)`}}},
+		{Text{Field: Title, Value: "x"}, bson.M{"title": bson.M{"$regex": wordStart + "x", "$options": "i"}}},
+		{Not{Node: NoteIDs{IDs: []primitive.ObjectID{id}}}, bson.M{"$nor": bson.A{bson.M{"_id": bson.M{"$in": bson.A{id}}}}}},
+		{NoteIDs{}, bson.M{"_id": bson.M{"$in": bson.A{}}}},
+		{Notebook{}, bson.M{"notebook_id": nil}},
+		{DateRange{Field: Created, From: day}, bson.M{"created_at": bson.M{"$gte": day}}},
+		{TitleIs{Value: "a  b"}, bson.M{"title": bson.M{"$regex": `^\s*a\s+b\s*$`, "$options": "i"}}},
+		{And{Nodes: []Node{Tag{Value: "a"}, Notebook{IDs: []primitive.ObjectID{id}}}}, bson.M{"$and": bson.A{
+			bson.M{"tags": bson.M{"$regex": `^a(/|$)`}},
+			bson.M{"notebook_id": bson.M{"$in": []primitive.ObjectID{id}}},
+		}}},
+	}
+	for _, tt := range tests {
+		got := Mongo(tt.node)
+		gotBytes, err := bson.MarshalExtJSON(got, false, false)
+		if err != nil {
+			t.Errorf("%#v: %v", tt.node, err)
+			continue
+		}
+		wantBytes, _ := bson.MarshalExtJSON(tt.want, false, false)
+		if string(gotBytes) != string(wantBytes) {
+			t.Errorf("Mongo(%#v) = %s, want %s", tt.node, gotBytes, wantBytes)
+		}
+	}
+}
+
+// Every pattern Mongo sends must compile, as MongoDB would reject the query
+func TestMongoPatternsCompile(t *testing.T) {
+	for _, q := range []string{`über`, `"привет мир"`, `title:Über`, `a.b*c`, `"(x) [y]"`, `tag:a/b`, `\d+`} {
+		parsed, err := Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		var walk func(v any)
+		walk = func(v any) {
+			switch v := v.(type) {
+			case bson.M:
+				if re, ok := v["$regex"].(string); ok {
+					if _, err := regexp.Compile(re); err != nil {
+						t.Errorf("%s: pattern %q does not compile: %v", q, re, err)
+					}
+				}
+				for _, child := range v {
+					walk(child)
+				}
+			case bson.A:
+				for _, child := range v {
+					walk(child)
+				}
+			}
+		}
+		walk(Mongo(parsed))
+	}
+}
+
+func TestResolve(t *testing.T) {
+	notes := []models.Note{
+		{ID: primitive.NewObjectID(), Title: "Über Straßen", Content: "привет мир", Tags: []string{"travel"}},
+		{ID: primitive.NewObjectID(), Title: "Happy days", Content: "What will happen next"},
+		{ID: primitive.NewObjectID(), Title: "Planning", Content: "We planned a happier day", Tags: []string{"work/plans"}},
+	}
+	ix := search.NewIndex()
+	for _, note := range notes {
+		ix.Add(note)
+	}
+
+	tests := []struct {
+		query string
+		want  []int // indexes of the matching notes
+	}{
+		{"über", []int{0}},
+		{"title:Über", []int{0}},
+		{"content:über", nil},
+		{`"привет мир"`, []int{0}},
+		{`"мир привет"`, nil},
+		{"мир", []int{0}},
+		{"happy", []int{1}},
+		{"happen", []int{1}},
+		{"plans", []int{2}},
+		{"title:plan", []int{2}},
+		{"travel", []int{0}},
+		{`"planned a happier"`, []int{2}},
+		{"-happy", []int{0, 2}},
+		{"happy OR planning", []int{1, 2}},
+		{"planning tag:work", []int{2}},
+		{"the", nil},
+	}
+	for _, tt := range tests {
+		parsed, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		m := NewMatcher(Resolve(parsed, ix))
+		var got []int
+		for i, note := range notes {
+			if m.Match(note) {
+				got = append(got, i)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q matches notes %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"knowledge_base_backend/tags"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Mongo compiles the query into a MongoDB filter on the notes collection.
+// A nil query matches every note.
+func Mongo(n Node) bson.M {
+	if n == nil {
+		return bson.M{}
+	}
+	switch n := n.(type) {
+	case And:
+		return bson.M{"$and": mongoAll(n.Nodes)}
+	case Or:
+		return bson.M{"$or": mongoAll(n.Nodes)}
+	case Not:
+		return bson.M{"$nor": bson.A{Mongo(n.Node)}}
+	case Text:
+		re := bson.M{"$regex": n.pattern(), "$options": "i"}
+		switch n.Field {
+		case Title:
+			return bson.M{"title": re}
+		case Content:
+			return bson.M{"content": re}
+		}
+		return bson.M{"$or": bson.A{
+			bson.M{"title": re},
+			bson.M{"content": re},
+			bson.M{"tags": re},
+		}}
+	case Tag:
+		return bson.M{"tags": bson.M{"$regex": tags.Pattern(tags.Normalize(n.Value))}}
+	case Notebook:
+		if len(n.IDs) == 0 {
+			return bson.M{"notebook_id": nil}
+		}
+		return bson.M{"notebook_id": bson.M{"$in": n.IDs}}
+	case NoteIDs:
+		ids := make(bson.A, len(n.IDs))
+		for i, id := range n.IDs {
+			ids[i] = id
+		}
+		return bson.M{"_id": bson.M{"$in": ids}}
+	case TitleIs:
+		words := strings.Fields(n.Value)
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		return bson.M{"title": bson.M{"$regex": `^\s*` + strings.Join(words, `\s+`) + `\s*$`, "$options": "i"}}
+	case DateRange:
+		bounds := bson.M{}
+		if !n.From.IsZero() {
+			bounds["$gte"] = n.From
+		}
+		if !n.To.IsZero() {
+			bounds["$lt"] = n.To
+		}
+		return bson.M{string(n.Field) + "_at": bounds}
+	}
+	return bson.M{}
+}
+
+func mongoAll(nodes []Node) bson.A {
+	filters := make(bson.A, len(nodes))
+	for i, child := range nodes {
+		filters[i] = Mongo(child)
+	}
+	return filters
+}
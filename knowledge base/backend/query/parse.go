@@ -0,0 +1,334 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError reports where a query could not be parsed
+type SyntaxError struct {
+	Pos int // byte offset into the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokField // a field name followed by ":", with any comparison operator
+	tokLParen
+	tokRParen
+	tokMinus
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	op    string // comparison operator of a tokField
+	pos   int
+	glued bool // no whitespace separates this token from the previous one
+}
+
+// lex splits the query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	glued := false
+	for i < len(input) {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			glued = false
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i, glued: glued})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i, glued: glued})
+			i++
+		case r == '-' && !glued:
+			tokens = append(tokens, token{kind: tokMinus, text: "-", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, &SyntaxError{Pos: start, Msg: "unterminated quoted phrase"}
+				}
+				if input[i] == '\\' && i+1 < len(input) && (input[i+1] == '"' || input[i+1] == '\\') {
+					sb.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: sb.String(), pos: start, glued: glued})
+		default:
+			start := i
+			for i < len(input) {
+				r, size := utf8.DecodeRuneInString(input[i:])
+				if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+					break
+				}
+				if r == ':' {
+					break
+				}
+				i += size
+			}
+			word := input[start:i]
+			if i < len(input) && input[i] == ':' {
+				// field:value, where the value may start with a comparison operator
+				i++
+				op := ""
+				for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+					if strings.HasPrefix(input[i:], candidate) {
+						op = candidate
+						i += len(candidate)
+						break
+					}
+				}
+				tokens = append(tokens, token{kind: tokField, text: word, op: op, pos: start, glued: glued})
+				glued = true
+				continue
+			}
+			kind := tokWord
+			switch word {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start, glued: glued})
+		}
+		glued = true
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(input)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a search query such as
+//
+//	release -tag:draft (title:"release plan" OR created:>2024-01-01)
+//
+// Adjacent terms are ANDed; AND, OR and NOT must be upper case; "-" negates
+// the term it prefixes; quotes match an exact phrase.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "unmatched )"}
+		}
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for p.peek().kind == tokOr {
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokPhrase, tokField, tokLParen, tokMinus, tokNot:
+			// Adjacent terms are implicitly ANDed
+		default:
+			if len(nodes) == 1 {
+				return first, nil
+			}
+			return And{Nodes: nodes}, nil
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	switch t := p.peek(); t.kind {
+	case tokNot, tokMinus:
+		p.next()
+		if next := p.peek(); t.kind == tokMinus && next.kind != tokEOF && !next.glued {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "\"-\" must be attached to the term it negates"}
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: fmt.Sprintf("missing ) to close ( at position %d", t.pos)}
+		}
+		return n, nil
+	case tokWord:
+		return Text{Value: t.text}, nil
+	case tokPhrase:
+		return Text{Value: t.text, Phrase: true}, nil
+	case tokField:
+		return p.parseField(t)
+	case tokEOF:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected end of query"}
+	}
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+}
+
+func (p *parser) parseField(field token) (Node, error) {
+	value := p.peek()
+	if (value.kind != tokWord && value.kind != tokPhrase) || !value.glued {
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("missing value for %s:", field.text)}
+	}
+	p.next()
+
+	name := Field(strings.ToLower(field.text))
+	if name != Created && name != Updated && field.op != "" {
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("%s: does not support %q", field.text, field.op)}
+	}
+	switch name {
+	case Title, Content:
+		return Text{Field: name, Value: value.text, Phrase: value.kind == tokPhrase}, nil
+	case Tags, "tags":
+		return Tag{Value: value.text}, nil
+	case Created, Updated:
+		r, err := ParseDateRange(field.op, value.text)
+		if err != nil {
+			return nil, &SyntaxError{Pos: value.pos, Msg: err.Error()}
+		}
+		r.Field = name
+		return r, nil
+	}
+	return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("unknown field %q, expected title, content, tag, created or updated", field.text)}
+}
+
+// ParseDateRange turns a comparison such as ">2024-01-01" or a range such as
+// "2024-01-01..2024-03-31" into a half-open interval. Dates cover whole days.
+func ParseDateRange(op, value string) (DateRange, error) {
+	if from, to, ok := strings.Cut(value, ".."); ok && op == "" {
+		start, _, err := parseDate(from)
+		if err != nil {
+			return DateRange{}, err
+		}
+		_, end, err := parseDate(to)
+		if err != nil {
+			return DateRange{}, err
+		}
+		if !start.Before(end) {
+			return DateRange{}, fmt.Errorf("date range %q ends before it starts", value)
+		}
+		return DateRange{From: start, To: end}, nil
+	}
+
+	start, end, err := parseDate(value)
+	if err != nil {
+		return DateRange{}, err
+	}
+	switch op {
+	case ">":
+		return DateRange{From: end}, nil
+	case ">=":
+		return DateRange{From: start}, nil
+	case "<":
+		return DateRange{To: start}, nil
+	case "<=":
+		return DateRange{To: end}, nil
+	}
+	return DateRange{From: start, To: end}, nil
+}
+
+// parseDate returns the interval a date or timestamp denotes: a whole day for
+// 2006-01-02, or one second for an RFC 3339 timestamp
+func parseDate(value string) (time.Time, time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Second), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or an RFC 3339 timestamp", value)
+}
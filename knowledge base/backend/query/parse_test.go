@@ -0,0 +1,67 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Node
+	}{
+		{"foo", Text{Value: "foo"}},
+		{"foo bar", And{Nodes: []Node{Text{Value: "foo"}, Text{Value: "bar"}}}},
+		{`"exact phrase"`, Text{Value: "exact phrase", Phrase: true}},
+		{"tag:work -title:draft", And{Nodes: []Node{Tag{Value: "work"}, Not{Node: Text{Field: Title, Value: "draft"}}}}},
+		{"(a OR b) c", And{Nodes: []Node{Or{Nodes: []Node{Text{Value: "a"}, Text{Value: "b"}}}, Text{Value: "c"}}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string // contained in the message
+	}{
+		{"", 0, "empty query"},
+		{"   ", 0, "empty query"},
+		{"foo)", 3, "unmatched )"},
+		{"(foo", 4, "missing ) to close ( at position 0"},
+		{"(a (b)", 6, "missing ) to close ( at position 0"},
+		{`"abc`, 0, "unterminated quoted phrase"},
+		{`a "b`, 2, "unterminated quoted phrase"},
+		{"- foo", 0, `"-" must be attached`},
+		{"title:", 0, "missing value for title:"},
+		{"nope:x", 0, `unknown field "nope"`},
+		{"tag:>x", 0, `tag: does not support ">"`},
+		{"created:notadate", 8, `invalid date "notadate"`},
+		{"created:>2024-13-01", 9, `invalid date "2024-13-01"`},
+		{"a AND", 5, "unexpected end of query"},
+		{"a OR OR b", 5, `unexpected "OR"`},
+		{"a AND )", 6, `unexpected ")"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want a *SyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || !strings.Contains(syntaxErr.Msg, tt.msg) {
+			t.Errorf("Parse(%q) error at %d %q, want at %d containing %q", tt.query, syntaxErr.Pos, syntaxErr.Msg, tt.pos, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"knowledge_base_backend/search"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Word boundaries in any script. \b and \W only know ASCII word characters,
+// so they would split "über" and never match "мир".
+const (
+	wordStart = `(?:^|[^\p{L}\p{Nd}])`
+	wordEnd   = `(?:[^\p{L}\p{Nd}]|$)`
+	wordGap   = `[^\p{L}\p{Nd}]+`
+)
+
+// pattern returns the case-insensitive regular expression a Text node
+// matches when a store is given the node itself rather than its Resolved
+// form. The syntax is shared by Go's regexp and MongoDB's PCRE so both
+// stores agree on what matches.
+//
+// A single word matches any word starting with the part it shares with its
+// stem, approximating the stemming the index uses: "planned" has stem "plan"
+// and matches "plans" and "planning". Phrases match their words in order,
+// separated by anything that is not a letter or digit.
+func (t Text) pattern() string {
+	words := strings.FieldsFunc(strings.ToLower(t.Value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	switch {
+	case len(words) == 0:
+		return regexp.QuoteMeta(t.Value)
+	case len(words) == 1 && !t.Phrase:
+		return wordStart + regexp.QuoteMeta(stemPrefix(words[0]))
+	}
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return wordStart + strings.Join(quoted, wordGap) + wordEnd
+}
+
+// stemPrefix returns the longest common prefix of word and its stem, which
+// differ when stemming rewrites letters as in "happy" and "happi"
+func stemPrefix(word string) string {
+	stem := search.Stem(word)
+	n := 0
+	for n < len(word) && n < len(stem) && word[n] == stem[n] {
+		n++
+	}
+	for n > 0 && n < len(word) && !utf8.RuneStart(word[n]) {
+		n--
+	}
+	if n == 0 {
+		return word
+	}
+	return word[:n]
+}
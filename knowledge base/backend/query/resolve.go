@@ -0,0 +1,29 @@
+package query
+
+import "knowledge_base_backend/search"
+
+// Resolve replaces the words and phrases of the query with the notes the
+// index finds them in, matching them against the same stemmed terms it ranks
+// by. What is left are structured filters a store runs without reading note
+// text. A nil query stays nil.
+func Resolve(n Node, ix *search.Index) Node {
+	switch n := n.(type) {
+	case And:
+		return And{Nodes: resolveAll(n.Nodes, ix)}
+	case Or:
+		return Or{Nodes: resolveAll(n.Nodes, ix)}
+	case Not:
+		return Not{Node: Resolve(n.Node, ix)}
+	case Text:
+		return NoteIDs{IDs: ix.Match(n.Value, string(n.Field))}
+	}
+	return n
+}
+
+func resolveAll(nodes []Node, ix *search.Index) []Node {
+	resolved := make([]Node, len(nodes))
+	for i, child := range nodes {
+		resolved[i] = Resolve(child, ix)
+	}
+	return resolved
+}
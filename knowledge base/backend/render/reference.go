@@ -0,0 +1,175 @@
+package render
+
+import (
+	"html"
+	"knowledge_base_backend/links"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Reference is a link the note makes to another note, or a link or image
+// naming an import that is gone. Href is empty when the link is broken.
+type Reference struct {
+	ast.BaseInline
+	Target string
+	Label  string
+	Href   string
+	Class  string
+}
+
+// KindReference is the ast.NodeKind of a Reference
+var KindReference = ast.NewNodeKind("Reference")
+
+// Kind implements ast.Node
+func (n *Reference) Kind() ast.NodeKind {
+	return KindReference
+}
+
+// Dump implements ast.Node
+func (n *Reference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target, "Href": n.Href}, nil)
+}
+
+// noteReference resolves a [[target|label]] to a reference
+func noteReference(target, label string, resolve Resolver) *Reference {
+	ref := &Reference{Target: target, Label: label, Class: BrokenLinkClass}
+	if ref.Label == "" {
+		ref.Label = target
+	}
+	if href, ok := resolve.Note(target); ok {
+		ref.Href, ref.Class = href, NoteLinkClass
+	}
+	return ref
+}
+
+// wikiLinkParser reads [[target]] and [[target|label]] the way links.Parse
+// does, so rendered links match the stored ones
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if len(line) < 2 || line[1] != '[' {
+		return nil
+	}
+	refs := links.Parse(string(line))
+	if len(refs) == 0 || refs[0].Start != 0 {
+		return nil
+	}
+	block.Advance(refs[0].End)
+	return &Reference{Target: refs[0].Target, Label: refs[0].Label}
+}
+
+// linkResolver points the wiki links of a document at the notes they name
+// and import: links and images at the imports
+type linkResolver struct {
+	resolve Resolver
+}
+
+func (t *linkResolver) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var replace [][2]ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *Reference:
+			resolved := noteReference(n.Target, n.Label, t.resolve)
+			n.Label, n.Href, n.Class = resolved.Label, resolved.Href, resolved.Class
+		case *ast.Link:
+			id, ok := importID(n.Destination)
+			if !ok {
+				break
+			}
+			href, name, ok := t.resolve.Import(id)
+			if !ok {
+				replace = append(replace, [2]ast.Node{n, brokenImport(id, Text(n, source))})
+				break
+			}
+			n.Destination = []byte(href)
+			n.SetAttributeString("class", []byte(ImportLinkClass))
+			n.SetAttributeString(importAttribute, []byte(id))
+			if n.ChildCount() == 0 {
+				n.AppendChild(n, ast.NewString([]byte(name)))
+			}
+		case *ast.Image:
+			id, ok := importID(n.Destination)
+			if !ok {
+				break
+			}
+			href, _, ok := t.resolve.Import(id)
+			if !ok {
+				replace = append(replace, [2]ast.Node{n, brokenImport(id, Text(n, source))})
+				break
+			}
+			n.Destination = []byte(href)
+			n.SetAttributeString("class", []byte(ImportLinkClass))
+			n.SetAttributeString(importAttribute, []byte(id))
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, r := range replace {
+		r[0].Parent().ReplaceChild(r[0].Parent(), r[0], r[1])
+	}
+}
+
+// importAttribute holds the import ID on a resolved link or image. The HTML
+// renderers leave it out and the sanitizer would drop it anyway.
+const importAttribute = "data-import-id"
+
+// ImportID returns the ID of the import a resolved link or image points at
+func ImportID(n ast.Node) (string, bool) {
+	value, ok := n.AttributeString(importAttribute)
+	if !ok {
+		return "", false
+	}
+	id, ok := value.([]byte)
+	return string(id), ok
+}
+
+// importID returns the import ID an import: URL names
+func importID(destination []byte) (string, bool) {
+	id, ok := strings.CutPrefix(string(destination), ImportScheme)
+	return id, ok && id != ""
+}
+
+// brokenImport stands in for a link or image to an import that is gone
+func brokenImport(id, text string) *Reference {
+	if text == "" {
+		text = ImportScheme + id
+	}
+	return &Reference{Target: ImportScheme + id, Label: text, Class: BrokenLinkClass}
+}
+
+// referenceRenderer writes references as links, or as marked text when broken
+type referenceRenderer struct{}
+
+func (referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindReference, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			var b strings.Builder
+			writeReference(&b, n.(*Reference))
+			w.WriteString(b.String())
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// writeReference writes ref as HTML
+func writeReference(b *strings.Builder, ref *Reference) {
+	text := html.EscapeString(ref.Label)
+	if ref.Href == "" {
+		b.WriteString(`<span class="` + ref.Class + `">` + text + `</span>`)
+		return
+	}
+	b.WriteString(`<a href="` + html.EscapeString(ref.Href) + `" class="` + ref.Class + `">` + text + `</a>`)
+}
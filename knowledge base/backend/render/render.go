@@ -0,0 +1,195 @@
+// Package render turns note content into sanitized HTML
+package render
+
+import (
+	"bytes"
+	"html"
+	"knowledge_base_backend/links"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ImportScheme starts the URL of a markdown link or image that points at an
+// import by its ID, as in ![diagram](import:64b...)
+const ImportScheme = "import:"
+
+// Classes given to the links a note makes, so clients can style them
+const (
+	NoteLinkClass   = "note-link"
+	ImportLinkClass = "import-link"
+	BrokenLinkClass = "broken-link"
+)
+
+// Resolver finds what the links in a note point at
+type Resolver interface {
+	// Note returns the URL of the note a [[target]] names
+	Note(target string) (href string, ok bool)
+	// Import returns the URL and file name of the import with the given ID
+	Import(id string) (href, name string, ok bool)
+}
+
+// Heading is one entry in the table of contents of a document
+type Heading struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"` // the id of the heading element, to link to
+	Text  string `json:"text"`
+}
+
+// Document is a note rendered as HTML, with its table of contents
+type Document struct {
+	HTML string    `json:"html"`
+	TOC  []Heading `json:"toc"`
+}
+
+// policy is what rendered HTML may keep: user generated content, plus the
+// classes and checkboxes the renderer itself writes
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(false)
+	p.RequireNoFollowOnFullyQualifiedLinks(true)
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w.+#-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(
+		`^(`+NoteLinkClass+`|`+ImportLinkClass+`|`+BrokenLinkClass+`)$`,
+	)).OnElements("a", "span", "img")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+	return p
+}()
+
+// paragraphBreak is the blank line between paragraphs of plain text
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// Markdown renders content as CommonMark with the GitHub extensions: tables,
+// task lists, strikethrough and bare URLs. Headings get IDs and make up the
+// table of contents, [[wiki links]] and import: URLs are resolved, and raw
+// HTML is dropped before the result is sanitized.
+func Markdown(content string, resolve Resolver) (Document, error) {
+	md := markdown(resolve)
+	tree := parse(md, content)
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, tree.Source, tree.Root); err != nil {
+		return Document{}, err
+	}
+	return Document{
+		HTML: policy.Sanitize(buf.String()),
+		TOC:  tableOfContents(tree.Root, tree.Source),
+	}, nil
+}
+
+// Tree is markdown parsed as Markdown parses it, links resolved, for writers
+// of formats other than HTML to walk. Wiki links and links to missing imports
+// are Reference nodes; ImportID tells which import a link or image shows.
+type Tree struct {
+	Root   ast.Node
+	Source []byte
+}
+
+// Parse parses markdown content without rendering it
+func Parse(content string, resolve Resolver) Tree {
+	return parse(markdown(resolve), content)
+}
+
+// markdown returns the goldmark setup behind Markdown and Parse
+func markdown(resolve Resolver) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199)),
+			parser.WithASTTransformers(util.Prioritized(&linkResolver{resolve: resolve}, 100)),
+		),
+		goldmark.WithRendererOptions(
+			renderer.WithNodeRenderers(util.Prioritized(referenceRenderer{}, 100)),
+		),
+	)
+}
+
+func parse(md goldmark.Markdown, content string) Tree {
+	source := []byte(content)
+	return Tree{Root: md.Parser().Parse(text.NewReader(source)), Source: source}
+}
+
+// Plain renders content as text: blank lines separate paragraphs, line breaks
+// are kept and [[wiki links]] are resolved. It has no table of contents.
+func Plain(content string, resolve Resolver) Document {
+	var b strings.Builder
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	for _, para := range paragraphBreak.Split(strings.TrimSpace(content), -1) {
+		if para == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		last := 0
+		for _, ref := range links.Parse(para) {
+			b.WriteString(plainText(para[last:ref.Start]))
+			writeReference(&b, noteReference(ref.Target, ref.Label, resolve))
+			last = ref.End
+		}
+		b.WriteString(plainText(para[last:]))
+		b.WriteString("</p>\n")
+	}
+	return Document{HTML: policy.Sanitize(b.String()), TOC: []Heading{}}
+}
+
+// plainText escapes text and turns its line breaks into <br>
+func plainText(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n")
+}
+
+// tableOfContents lists the headings of doc in order
+func tableOfContents(doc ast.Node, source []byte) []Heading {
+	toc := []Heading{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		var id string
+		if value, ok := heading.AttributeString("id"); ok {
+			if b, ok := value.([]byte); ok {
+				id = string(b)
+			}
+		}
+		toc = append(toc, Heading{Level: heading.Level, ID: id, Text: Text(heading, source)})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// Text is the text inside n, without markup
+func Text(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch child := child.(type) {
+		case *ast.Text:
+			b.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(child.Value)
+		case *Reference:
+			b.WriteString(child.Label)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
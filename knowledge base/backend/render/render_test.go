@@ -0,0 +1,104 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testImport = "64b000000000000000000001"
+
+// testResolver knows the note "Go" and the import testImport
+type testResolver struct{}
+
+func (testResolver) Note(target string) (string, bool) {
+	if strings.EqualFold(target, "go") {
+		return "/notes/go", true
+	}
+	return "", false
+}
+
+func (testResolver) Import(id string) (string, string, bool) {
+	if id == testImport {
+		return "/imports/" + id + "/content", "diagram.png", true
+	}
+	return "", "", false
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string // in the HTML
+		notWant []string
+	}{
+		{"emphasis", "*a* **b** ~~c~~", []string{"<em>a</em>", "<strong>b</strong>", "<del>c</del>"}, nil},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |", []string{"<table>", `<th align="left">a</th>`, `<td align="right">2</td>`}, nil},
+		{"task list", "- [x] done\n- [ ] todo", []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`}, nil},
+		{"bare url", "see https://example.com", []string{`<a href="https://example.com" rel="nofollow">https://example.com</a>`}, nil},
+		{"code language", "```go\nfmt.Println()\n```", []string{`<code class="language-go">`}, nil},
+		{"wiki link", "[[go|the language]]", []string{`<a href="/notes/go" class="note-link">the language</a>`}, nil},
+		{"broken wiki link", "[[Missing]]", []string{`<span class="broken-link">Missing</span>`}, nil},
+		{"import image", "![d](import:" + testImport + ")", []string{`src="/imports/` + testImport + `/content"`, `class="import-link"`}, []string{"data-import-id"}},
+		{"import link without text", "[](import:" + testImport + ")", []string{`class="import-link">diagram.png</a>`}, nil},
+		{"missing import", "![gone](import:64b000000000000000000002)", []string{`<span class="broken-link">gone</span>`}, []string{"<img"}},
+		{"raw html", "<script>alert(1)</script>\n\nhi <b onclick=\"x()\">there</b>", []string{"hi"}, []string{"<script", "onclick", "alert"}},
+		{"javascript link", "[x](javascript:alert(1))", nil, []string{"javascript:"}},
+	}
+	for _, tt := range tests {
+		doc, err := Markdown(tt.in, testResolver{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(doc.HTML, want) {
+				t.Errorf("%s: HTML lacks %s:\n%s", tt.name, want, doc.HTML)
+			}
+		}
+		for _, bad := range tt.notWant {
+			if strings.Contains(doc.HTML, bad) {
+				t.Errorf("%s: HTML holds %s:\n%s", tt.name, bad, doc.HTML)
+			}
+		}
+	}
+}
+
+func TestMarkdownTOC(t *testing.T) {
+	doc, err := Markdown("# Intro\n\ntext\n\n## Set *up*\n\n## Set up", testResolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Heading{
+		{Level: 1, ID: "intro", Text: "Intro"},
+		{Level: 2, ID: "set-up", Text: "Set up"},
+		{Level: 2, ID: "set-up-1", Text: "Set up"},
+	}
+	if !reflect.DeepEqual(doc.TOC, want) {
+		t.Errorf("TOC = %+v, want %+v", doc.TOC, want)
+	}
+	for _, h := range want {
+		if !strings.Contains(doc.HTML, `id="`+h.ID+`"`) {
+			t.Errorf("HTML lacks the heading id %s", h.ID)
+		}
+	}
+
+	if doc, _ := Markdown("no headings", testResolver{}); doc.TOC == nil || len(doc.TOC) != 0 {
+		t.Errorf("TOC without headings = %#v, want an empty list", doc.TOC)
+	}
+}
+
+func TestPlain(t *testing.T) {
+	doc := Plain("first <b>line</b>\r\nsecond\n\n\n  [[Go]] and [[nowhere|x]]\n", testResolver{})
+	want := "<p>first &lt;b&gt;line&lt;/b&gt;<br>\nsecond</p>\n" +
+		`<p>  <a href="/notes/go" class="note-link">Go</a> and <span class="broken-link">x</span></p>` + "\n"
+	if doc.HTML != want {
+		t.Errorf("Plain HTML = %q, want %q", doc.HTML, want)
+	}
+	if doc.TOC == nil || len(doc.TOC) != 0 {
+		t.Errorf("Plain TOC = %#v, want an empty list", doc.TOC)
+	}
+	if doc := Plain("  \n\n ", testResolver{}); doc.HTML != "" {
+		t.Errorf("Plain of blank content = %q", doc.HTML)
+	}
+}
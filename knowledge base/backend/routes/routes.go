@@ -7,20 +7,57 @@ import (
 )
 
 // SetupRoutes initializes the routes for the application
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, notes *controllers.NoteController, imports *controllers.ImportController, tags *controllers.TagController, notebooks *controllers.NotebookController, graph *controllers.GraphController) {
 	// Note routes
-	app.Get("/notes", controllers.GetNotes)
-	app.Get("/notes/:id", controllers.GetNote)
-	app.Post("/notes", controllers.CreateNote)
-	app.Put("/notes/:id", controllers.UpdateNote)
-	app.Delete("/notes/:id", controllers.DeleteNote)
-	app.Post("/notes/search", controllers.SearchNotes)
-	app.Post("/notes/save-file/:id", controllers.SaveFile)
+	app.Get("/notes", notes.GetNotes)
+	app.Get("/notes/:id", notes.GetNote)
+	app.Post("/notes", notes.CreateNote)
+	app.Put("/notes/:id", notes.UpdateNote)
+	app.Patch("/notes/:id", notes.PatchNote)
+	app.Delete("/notes/:id", notes.DeleteNote)
+	app.Post("/notes/search", notes.SearchNotes)
+	app.Post("/notes/move", notes.MoveNotes)
+	app.Post("/notes/save-file/:id", notes.SaveFile)
+	app.Get("/notes/:id/revisions", notes.ListRevisions)
+	app.Get("/notes/:id/revisions/:rev", notes.GetRevision)
+	app.Post("/notes/:id/revisions/:rev/restore", notes.RestoreRevision)
+	app.Get("/notes/:id/diff", notes.DiffRevisions)
+	app.Get("/notes/:id/links", notes.GetLinks)
+	app.Get("/notes/:id/backlinks", notes.GetBacklinks)
+	app.Get("/notes/:id/render", notes.RenderNote)
+	app.Get("/notes/:id/export", notes.ExportNote)
+	app.Get("/links/broken", notes.GetBrokenLinks)
 
 	// Import routes
-	app.Post("/imports", controllers.UploadFile)
-	app.Get("/imports", controllers.GetImports)
-	app.Get("/imports/:id", controllers.GetImport)
-	app.Delete("/imports/:id", controllers.DeleteImport)
-	app.Post("/imports/:id/export", controllers.ExportImport)
+	app.Post("/imports", imports.UploadFile)
+	app.Get("/imports", imports.GetImports)
+	app.Get("/imports/:id", imports.GetImport)
+	app.Get("/imports/:id/content", imports.GetImportContent)
+	app.Get("/imports/:id/thumbnail", imports.GetImportThumbnail)
+	app.Delete("/imports/:id", imports.DeleteImport)
+	app.Post("/imports/:id/export", imports.ExportImport)
+
+	// Tag routes
+	app.Get("/tags", tags.GetTags)
+	app.Post("/tags/merge", tags.MergeTags)
+	app.Post("/tags/:name/rename", tags.RenameTag)
+	app.Delete("/tags/:name", tags.DeleteTag)
+	app.Get("/tags/:name/export", notes.ExportTag)
+
+	// Notebook routes
+	app.Get("/notebooks", notebooks.GetNotebooks)
+	app.Get("/notebooks/:id", notebooks.GetNotebook)
+	app.Post("/notebooks", notebooks.CreateNotebook)
+	app.Put("/notebooks/:id", notebooks.UpdateNotebook)
+	app.Post("/notebooks/:id/move", notebooks.MoveNotebook)
+	app.Delete("/notebooks/:id", notebooks.DeleteNotebook)
+	app.Get("/notebooks/:id/export", notes.ExportNotebook)
+
+	// Export routes
+	app.Post("/exports", notes.CreateExport)
+	app.Get("/exports/:id", notes.GetExport)
+	app.Get("/exports/:id/download", notes.DownloadExport)
+
+	// Graph routes
+	app.Get("/graph", graph.GetGraph)
 }
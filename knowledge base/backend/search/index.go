@@ -0,0 +1,349 @@
+package search
+
+import (
+	"html"
+	"knowledge_base_backend/models"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// field identifies the part of a note a term occurred in
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldContent
+	fieldTags
+	numFields
+)
+
+// fieldWeights boost matches in titles and tags over matches in the body
+var fieldWeights = [numFields]float64{
+	fieldTitle:   3.0,
+	fieldContent: 1.0,
+	fieldTags:    2.0,
+}
+
+// BM25 parameters: k1 saturates term frequency, b normalises for field length
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// snippetTokens is the number of indexed words shown in a content snippet
+const snippetTokens = 30
+
+// Hit is one ranked search result
+type Hit struct {
+	ID             primitive.ObjectID
+	Score          float64
+	MatchedTerms   []string // query words found in the note
+	TitleHighlight string   // HTML-escaped title with matches wrapped in <mark>
+	Snippet        string   // HTML-escaped excerpt of the content around the best matches
+}
+
+// document is what the index remembers about one note
+type document struct {
+	text   [numFields]string
+	length [numFields]int
+	terms  map[string]bool
+}
+
+// Index is an in-memory inverted index over notes, ranked with BM25F
+type Index struct {
+	mu          sync.RWMutex
+	docs        map[primitive.ObjectID]*document
+	postings    map[string]map[primitive.ObjectID]*[numFields]int
+	totalLength [numFields]int
+}
+
+// NewIndex returns an empty Index
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[primitive.ObjectID]*document),
+		postings: make(map[string]map[primitive.ObjectID]*[numFields]int),
+	}
+}
+
+// Add indexes the note, replacing any previous version of it
+func (ix *Index) Add(note models.Note) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(note.ID)
+
+	doc := &document{
+		text: [numFields]string{
+			fieldTitle:   note.Title,
+			fieldContent: note.Content,
+			fieldTags:    strings.Join(note.Tags, " "),
+		},
+		terms: make(map[string]bool),
+	}
+	for f, text := range doc.text {
+		tokens := Tokenize(text)
+		doc.length[f] = len(tokens)
+		ix.totalLength[f] += len(tokens)
+		for _, t := range tokens {
+			docs := ix.postings[t.Term]
+			if docs == nil {
+				docs = make(map[primitive.ObjectID]*[numFields]int)
+				ix.postings[t.Term] = docs
+			}
+			tf := docs[note.ID]
+			if tf == nil {
+				tf = new([numFields]int)
+				docs[note.ID] = tf
+			}
+			tf[f]++
+			doc.terms[t.Term] = true
+		}
+	}
+	ix.docs[note.ID] = doc
+}
+
+// Remove drops the note from the index
+func (ix *Index) Remove(id primitive.ObjectID) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id primitive.ObjectID) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	for f := range doc.length {
+		ix.totalLength[f] -= doc.length[f]
+	}
+	delete(ix.docs, id)
+}
+
+// Len returns the number of indexed notes
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search ranks notes against the words of the query, best first. With nil
+// candidates every note matching any word is ranked; otherwise exactly the
+// indexed candidates are, scoring zero when they match no word. A limit of
+// zero or less returns every hit.
+func (ix *Index) Search(query string, candidates []primitive.ObjectID, limit int) []Hit {
+	// Remember which word the user typed for each term
+	words := make(map[string]string)
+	for _, t := range Tokenize(query) {
+		if _, ok := words[t.Term]; !ok {
+			words[t.Term] = strings.ToLower(query[t.Start:t.End])
+		}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := float64(len(ix.docs))
+	var avgLength [numFields]float64
+	for f := range avgLength {
+		if n > 0 {
+			avgLength[f] = float64(ix.totalLength[f]) / n
+		}
+	}
+
+	scores := make(map[primitive.ObjectID]float64)
+	matched := make(map[primitive.ObjectID][]string)
+	for _, id := range candidates {
+		if _, ok := ix.docs[id]; ok {
+			scores[id] = 0
+		}
+	}
+	for term, word := range words {
+		docs := ix.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range docs {
+			if candidates != nil {
+				if _, ok := scores[id]; !ok {
+					continue
+				}
+			}
+			doc := ix.docs[id]
+			var weighted float64
+			for f := field(0); f < numFields; f++ {
+				if tf[f] == 0 || avgLength[f] == 0 {
+					continue
+				}
+				norm := 1 - b + b*float64(doc.length[f])/avgLength[f]
+				weighted += fieldWeights[f] * float64(tf[f]) / norm
+			}
+			scores[id] += idf * weighted / (k1 + weighted)
+			matched[id] = append(matched[id], word)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		// Newer notes first on ties
+		return hits[i].ID.Hex() > hits[j].ID.Hex()
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	// Only the returned hits pay for highlighting
+	for i := range hits {
+		doc := ix.docs[hits[i].ID]
+		terms := matched[hits[i].ID]
+		if terms == nil {
+			terms = []string{}
+		}
+		sort.Strings(terms)
+		hits[i].MatchedTerms = terms
+		hits[i].TitleHighlight = highlight(doc.text[fieldTitle], words, 0)
+		hits[i].Snippet = highlight(doc.text[fieldContent], words, snippetTokens)
+	}
+	return hits
+}
+
+// Match returns the notes holding the words of text, stemmed as the index
+// stems them and in the same order. in narrows the search to "title" or
+// "content"; otherwise titles, content and tags are searched. Text with no
+// indexed words, such as only stopwords, matches no note.
+func (ix *Index) Match(text, in string) []primitive.ObjectID {
+	var terms []string
+	for _, t := range Tokenize(text) {
+		terms = append(terms, t.Term)
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	fields := []field{fieldTitle, fieldContent, fieldTags}
+	switch in {
+	case "title":
+		fields = []field{fieldTitle}
+	case "content":
+		fields = []field{fieldContent}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for id := range ix.postings[terms[0]] {
+		for _, f := range fields {
+			if ix.holds(id, f, terms) {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// holds reports whether field f of the note has the terms in a row. The
+// postings rule most notes out before the field is tokenized again.
+func (ix *Index) holds(id primitive.ObjectID, f field, terms []string) bool {
+	for _, term := range terms {
+		tf := ix.postings[term][id]
+		if tf == nil || tf[f] == 0 {
+			return false
+		}
+	}
+	if len(terms) == 1 {
+		return true
+	}
+	tokens := Tokenize(ix.docs[id].text[f])
+	for i := 0; i+len(terms) <= len(tokens); i++ {
+		j := 0
+		for j < len(terms) && tokens[i+j].Term == terms[j] {
+			j++
+		}
+		if j == len(terms) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight escapes text for HTML and wraps words matching the query terms in
+// <mark>. With a positive window only the stretch of that many indexed words
+// holding the most distinct matches is kept, with ellipses marking cuts.
+func highlight(text string, terms map[string]string, window int) string {
+	tokens := Tokenize(text)
+	from, to := 0, len(tokens)
+	if window > 0 && len(tokens) > window {
+		from = bestWindow(tokens, terms, window)
+		to = from + window
+	}
+
+	var sb strings.Builder
+	start := 0
+	if from > 0 {
+		start = tokens[from].Start
+		sb.WriteString("…")
+	}
+	end := len(text)
+	if to < len(tokens) {
+		end = tokens[to-1].End
+	}
+	pos := start
+	for _, t := range tokens[from:to] {
+		if _, ok := terms[t.Term]; !ok {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[pos:t.Start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[t.Start:t.End]))
+		sb.WriteString("</mark>")
+		pos = t.End
+	}
+	sb.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+// bestWindow returns the first token of the window containing the most
+// distinct query terms, starting a little before its first match
+func bestWindow(tokens []Token, terms map[string]string, window int) int {
+	const lead = 3
+	best, bestCount := 0, 0
+	for i, t := range tokens {
+		if _, ok := terms[t.Term]; !ok {
+			continue
+		}
+		// Matches near the end share the last full window
+		from := min(max(i-lead, 0), len(tokens)-window)
+		seen := make(map[string]bool)
+		for _, t := range tokens[from : from+window] {
+			if _, ok := terms[t.Term]; ok {
+				seen[t.Term] = true
+			}
+		}
+		if len(seen) > bestCount {
+			best, bestCount = from, len(seen)
+		}
+	}
+	return best
+}
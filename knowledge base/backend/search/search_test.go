@@ -0,0 +1,184 @@
+package search
+
+import (
+	"knowledge_base_backend/models"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Examples from Porter's paper and the reference vocabulary
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":    "caress",
+		"ponies":      "poni",
+		"cats":        "cat",
+		"feed":        "feed",
+		"agreed":      "agre",
+		"plastered":   "plaster",
+		"motoring":    "motor",
+		"sing":        "sing",
+		"conflated":   "conflat",
+		"hopping":     "hop",
+		"filing":      "file",
+		"happy":       "happi",
+		"relational":  "relat",
+		"rational":    "ration",
+		"generalize":  "gener",
+		"hopefulness": "hope",
+		"electrical":  "electr",
+		"adjustment":  "adjust",
+		"controlling": "control",
+		"planned":     "plan",
+		"planning":    "plan",
+		"is":          "is",
+		"über":        "über",
+		"x2":          "x2",
+	}
+	for word, want := range tests {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Token
+	}{
+		{"", nil},
+		{"The cats", []Token{{"cat", 4, 8}}},
+		{"e-mail, 2024!", []Token{{"e", 0, 1}, {"mail", 2, 6}, {"2024", 8, 12}}},
+		{"Über мир", []Token{{"über", 0, 5}, {"мир", 6, 12}}},
+		{"to be or not to be", nil},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// testIndex indexes the notes, giving each a fresh ID
+func testIndex(notes ...models.Note) (*Index, []primitive.ObjectID) {
+	ix := NewIndex()
+	ids := make([]primitive.ObjectID, len(notes))
+	for i, note := range notes {
+		note.ID = primitive.NewObjectID()
+		ids[i] = note.ID
+		ix.Add(note)
+	}
+	return ix, ids
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix, ids := testIndex(
+		models.Note{Title: "Gardening", Content: "Notes on soil and compost", Tags: []string{"home"}},
+		models.Note{Title: "Recipes", Content: "Compost the peels after gardening", Tags: []string{"food"}},
+		models.Note{Title: "Travel", Content: "Trains and planes", Tags: []string{"gardening"}},
+		models.Note{Title: "Errands", Content: "buy milk", Tags: []string{"todo"}},
+	)
+
+	tests := []struct {
+		query      string
+		candidates []primitive.ObjectID
+		limit      int
+		want       []primitive.ObjectID
+	}{
+		// Title matches outweigh tag matches, which outweigh content matches
+		{"garden", nil, 0, []primitive.ObjectID{ids[0], ids[2], ids[1]}},
+		{"gardening", nil, 2, []primitive.ObjectID{ids[0], ids[2]}},
+		// The rarer term counts for more
+		{"compost soil", nil, 0, []primitive.ObjectID{ids[0], ids[1]}},
+		{"nothing", nil, 0, []primitive.ObjectID{}},
+		{"the", nil, 0, []primitive.ObjectID{}},
+		// Candidates are ranked whether or not they match
+		{"garden", []primitive.ObjectID{ids[1], ids[3]}, 0, []primitive.ObjectID{ids[1], ids[3]}},
+	}
+	for _, tt := range tests {
+		hits := ix.Search(tt.query, tt.candidates, tt.limit)
+		got := make([]primitive.ObjectID, len(hits))
+		for i, hit := range hits {
+			got[i] = hit.ID
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q, %v, %d) = %v, want %v", tt.query, tt.candidates, tt.limit, got, tt.want)
+		}
+	}
+
+	hits := ix.Search("garden", []primitive.ObjectID{ids[3]}, 0)
+	if len(hits) != 1 || hits[0].Score != 0 || len(hits[0].MatchedTerms) != 0 {
+		t.Errorf("unmatched candidate hit = %+v, want a zero score", hits)
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	ix, _ := testIndex(models.Note{
+		Title:   "Planning <b>",
+		Content: "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty twenty-one twenty-two twenty-three twenty-four twenty-five twenty-six twenty-seven twenty-eight twenty-nine thirty we planned it",
+	})
+	hits := ix.Search("plans", nil, 0)
+	if len(hits) != 1 {
+		t.Fatalf("%d hits, want 1", len(hits))
+	}
+	hit := hits[0]
+	if want := "<mark>Planning</mark> &lt;b&gt;"; hit.TitleHighlight != want {
+		t.Errorf("TitleHighlight = %q, want %q", hit.TitleHighlight, want)
+	}
+	// A match near the end is shown in the last window of the content
+	if want := "thirty we <mark>planned</mark> it"; !strings.HasPrefix(hit.Snippet, "…") || !strings.HasSuffix(hit.Snippet, want) {
+		t.Errorf("Snippet = %q, want a cut start and the end %q", hit.Snippet, want)
+	}
+	if !slices.Equal(hit.MatchedTerms, []string{"plans"}) {
+		t.Errorf("MatchedTerms = %v", hit.MatchedTerms)
+	}
+}
+
+func TestIndexUpdates(t *testing.T) {
+	ix, ids := testIndex(models.Note{Title: "alpha"}, models.Note{Title: "beta"})
+	ix.Add(models.Note{ID: ids[0], Title: "gamma"})
+	if hits := ix.Search("alpha", nil, 0); len(hits) != 0 {
+		t.Errorf("replaced words still match: %+v", hits)
+	}
+	if hits := ix.Search("gamma", nil, 0); len(hits) != 1 || hits[0].ID != ids[0] {
+		t.Errorf("new words do not match: %+v", hits)
+	}
+	ix.Remove(ids[1])
+	if ix.Len() != 1 {
+		t.Errorf("Len = %d after a removal, want 1", ix.Len())
+	}
+	if hits := ix.Search("beta", nil, 0); len(hits) != 0 {
+		t.Errorf("removed note still matches: %+v", hits)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	ix, ids := testIndex(
+		models.Note{Title: "Weekly planning", Content: "plan the next sprint"},
+		models.Note{Title: "Sprint review", Content: "what was planned", Tags: []string{"next/sprint"}},
+	)
+	tests := []struct {
+		text, in string
+		want     []primitive.ObjectID
+	}{
+		{"plans", "", []primitive.ObjectID{ids[0], ids[1]}},
+		{"planning", "title", []primitive.ObjectID{ids[0]}},
+		{"planning", "content", []primitive.ObjectID{ids[0], ids[1]}},
+		{"next sprint", "", []primitive.ObjectID{ids[0], ids[1]}},
+		{"next sprint", "content", []primitive.ObjectID{ids[0]}},
+		{"sprint next", "", nil},
+		{"review sprint", "", nil},
+		{"the", "", nil},
+	}
+	for _, tt := range tests {
+		got := ix.Match(tt.text, tt.in)
+		slices.SortFunc(got, func(a, b primitive.ObjectID) int { return slices.Compare(a[:], b[:]) })
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.text, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/tags"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// match reports whether the import passes the filter
+func (f ImportFilter) match(imp models.Import) bool {
+	if len(f.FileTypes) > 0 {
+		found := false
+		for _, t := range f.FileTypes {
+			if strings.EqualFold(t, imp.FileType) || strings.EqualFold(t, imp.MIMEType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Tag != "" {
+		prefix := tags.Normalize(f.Tag)
+		if !slices.ContainsFunc(imp.Tags, func(tag string) bool { return tags.Within(tag, prefix) }) {
+			return false
+		}
+	}
+	if !f.CreatedFrom.IsZero() && imp.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !imp.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// mongo compiles the filter into a MongoDB filter on the imports collection
+func (f ImportFilter) mongo() bson.M {
+	filter := bson.M{}
+	if len(f.FileTypes) > 0 {
+		types := bson.A{}
+		for _, t := range f.FileTypes {
+			types = append(types, strings.ToLower(t))
+		}
+		filter["$or"] = bson.A{
+			bson.M{"file_type": bson.M{"$in": types}},
+			bson.M{"mime_type": bson.M{"$in": types}},
+		}
+	}
+	if f.Tag != "" {
+		filter["tags"] = bson.M{"$regex": tags.Pattern(tags.Normalize(f.Tag))}
+	}
+	created := bson.M{}
+	if !f.CreatedFrom.IsZero() {
+		created["$gte"] = f.CreatedFrom
+	}
+	if !f.CreatedTo.IsZero() {
+		created["$lt"] = f.CreatedTo
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	return filter
+}
+
+// replaceTag returns list with from replaced by to, or removed when to is
+// empty, and whether from was present. to is not duplicated if list has it.
+func replaceTag(list []string, from, to string) ([]string, bool) {
+	i := slices.Index(list, from)
+	if i < 0 {
+		return list, false
+	}
+	out := slices.Clone(list)
+	if to == "" || slices.Contains(list, to) {
+		return slices.Delete(out, i, i+1), true
+	}
+	out[i] = to
+	return out, true
+}
@@ -0,0 +1,640 @@
+package store
+
+import (
+	"context"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryNoteStore is a NoteStore that keeps notes in process memory
+type MemoryNoteStore struct {
+	mu    sync.RWMutex
+	order []primitive.ObjectID
+	notes map[primitive.ObjectID]models.Note
+}
+
+// NewMemoryNoteStore returns an empty in-memory NoteStore
+func NewMemoryNoteStore() *MemoryNoteStore {
+	return &MemoryNoteStore{notes: make(map[primitive.ObjectID]models.Note)}
+}
+
+func (s *MemoryNoteStore) List(ctx context.Context) ([]models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := make([]models.Note, 0, len(s.order))
+	for _, id := range s.order {
+		notes = append(notes, cloneNote(s.notes[id]))
+	}
+	return notes, nil
+}
+
+func (s *MemoryNoteStore) Find(ctx context.Context, q query.Node) ([]models.Note, error) {
+	matcher := query.NewMatcher(q)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []models.Note{}
+	for _, id := range s.order {
+		if note := s.notes[id]; matcher.Match(note) {
+			notes = append(notes, cloneNote(note))
+		}
+	}
+	return notes, nil
+}
+
+func (s *MemoryNoteStore) FindPage(ctx context.Context, q query.Node, page Page) ([]models.Note, *Cursor, error) {
+	key, err := lookupSort(NoteSorts(), page)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes, err := s.Find(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes, next := paginate(notes, page, key, func(note models.Note) position {
+		switch page.Sort {
+		case "updated":
+			return position{time: note.UpdatedAt, id: note.ID}
+		case "title":
+			return position{text: note.Title, id: note.ID}
+		}
+		return position{time: note.CreatedAt, id: note.ID}
+	})
+	if page.Summary {
+		for i := range notes {
+			notes[i].Content = ""
+		}
+	}
+	return notes, next, nil
+}
+
+func (s *MemoryNoteStore) Get(ctx context.Context, id primitive.ObjectID) (models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	note, ok := s.notes[id]
+	if !ok {
+		return models.Note{}, ErrNotFound
+	}
+	return cloneNote(note), nil
+}
+
+func (s *MemoryNoteStore) Create(ctx context.Context, note *models.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if note.ID.IsZero() {
+		note.ID = primitive.NewObjectID()
+	}
+	note.Version = 1
+	if _, ok := s.notes[note.ID]; !ok {
+		s.order = append(s.order, note.ID)
+	}
+	s.notes[note.ID] = cloneNote(*note)
+	return nil
+}
+
+func (s *MemoryNoteStore) Update(ctx context.Context, note *models.Note, ifVersion int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.notes[note.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != AnyVersion && stored.Version != ifVersion {
+		return ErrVersionConflict
+	}
+	note.CreatedAt = stored.CreatedAt
+	note.Version = stored.Version + 1
+	s.notes[note.ID] = cloneNote(*note)
+	return nil
+}
+
+func (s *MemoryNoteStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.notes[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != AnyVersion && stored.Version != ifVersion {
+		return ErrVersionConflict
+	}
+	delete(s.notes, id)
+	s.order = removeID(s.order, id)
+	return nil
+}
+
+func (s *MemoryNoteStore) TagCounts(ctx context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, note := range s.notes {
+		for _, tag := range note.Tags {
+			counts[tag]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryNoteStore) Move(ctx context.Context, id primitive.ObjectID, notebookID *primitive.ObjectID, updatedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if note.NotebookID == nil && notebookID == nil ||
+		note.NotebookID != nil && notebookID != nil && *note.NotebookID == *notebookID {
+		return false, nil
+	}
+	note.NotebookID = notebookID
+	note.UpdatedAt = updatedAt
+	note.Version++
+	s.notes[id] = cloneNote(note)
+	return true, nil
+}
+
+func (s *MemoryNoteStore) ReplaceTag(ctx context.Context, from, to string, updatedAt time.Time) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []primitive.ObjectID
+	for _, id := range s.order {
+		note := s.notes[id]
+		list, ok := replaceTag(note.Tags, from, to)
+		if !ok {
+			continue
+		}
+		note.Tags = list
+		note.UpdatedAt = updatedAt
+		note.Version++
+		s.notes[id] = note
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
+
+// MemoryImportStore is an ImportStore that keeps imports in process memory
+type MemoryImportStore struct {
+	mu      sync.RWMutex
+	order   []primitive.ObjectID
+	imports map[primitive.ObjectID]models.Import
+}
+
+// NewMemoryImportStore returns an empty in-memory ImportStore
+func NewMemoryImportStore() *MemoryImportStore {
+	return &MemoryImportStore{imports: make(map[primitive.ObjectID]models.Import)}
+}
+
+func (s *MemoryImportStore) List(ctx context.Context) ([]models.Import, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imports := make([]models.Import, 0, len(s.order))
+	for _, id := range s.order {
+		imports = append(imports, cloneImport(s.imports[id]))
+	}
+	return imports, nil
+}
+
+func (s *MemoryImportStore) FindPage(ctx context.Context, filter ImportFilter, page Page) ([]models.Import, *Cursor, error) {
+	key, err := lookupSort(ImportSorts(), page)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.RLock()
+	imports := []models.Import{}
+	for _, id := range s.order {
+		if imp := s.imports[id]; filter.match(imp) {
+			imports = append(imports, cloneImport(imp))
+		}
+	}
+	s.mu.RUnlock()
+
+	imports, next := paginate(imports, page, key, func(imp models.Import) position {
+		if page.Sort == "name" {
+			return position{text: imp.FileName, id: imp.ID}
+		}
+		return position{time: imp.CreatedAt, id: imp.ID}
+	})
+	return imports, next, nil
+}
+
+func (s *MemoryImportStore) Get(ctx context.Context, id primitive.ObjectID) (models.Import, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imp, ok := s.imports[id]
+	if !ok {
+		return models.Import{}, ErrNotFound
+	}
+	return cloneImport(imp), nil
+}
+
+func (s *MemoryImportStore) Create(ctx context.Context, imp *models.Import) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if imp.ID.IsZero() {
+		imp.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.imports[imp.ID]; !ok {
+		s.order = append(s.order, imp.ID)
+	}
+	s.imports[imp.ID] = cloneImport(*imp)
+	return nil
+}
+
+func (s *MemoryImportStore) Update(ctx context.Context, imp models.Import) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.imports[imp.ID]; !ok {
+		return ErrNotFound
+	}
+	s.imports[imp.ID] = cloneImport(imp)
+	return nil
+}
+
+func (s *MemoryImportStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.imports[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.imports, id)
+	s.order = removeID(s.order, id)
+	return nil
+}
+
+func (s *MemoryImportStore) SetThumbnails(ctx context.Context, id primitive.ObjectID, thumbnails []models.Thumbnail, failure string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp, ok := s.imports[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if len(imp.Thumbnails) > 0 || imp.ThumbnailError != "" {
+		return false, nil
+	}
+	imp.Thumbnails, imp.ThumbnailError = thumbnails, failure
+	s.imports[id] = cloneImport(imp)
+	return true, nil
+}
+
+func (s *MemoryImportStore) TagCounts(ctx context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, imp := range s.imports {
+		for _, tag := range imp.Tags {
+			counts[tag]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryImportStore) ReplaceTag(ctx context.Context, from, to string) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []primitive.ObjectID
+	for _, id := range s.order {
+		imp := s.imports[id]
+		list, ok := replaceTag(imp.Tags, from, to)
+		if !ok {
+			continue
+		}
+		imp.Tags = list
+		s.imports[id] = imp
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
+
+// MemoryNotebookStore is a NotebookStore that keeps notebooks in process memory
+type MemoryNotebookStore struct {
+	mu        sync.RWMutex
+	order     []primitive.ObjectID
+	notebooks map[primitive.ObjectID]models.Notebook
+}
+
+// NewMemoryNotebookStore returns an empty in-memory NotebookStore
+func NewMemoryNotebookStore() *MemoryNotebookStore {
+	return &MemoryNotebookStore{notebooks: make(map[primitive.ObjectID]models.Notebook)}
+}
+
+func (s *MemoryNotebookStore) List(ctx context.Context) ([]models.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notebooks := make([]models.Notebook, 0, len(s.order))
+	for _, id := range s.order {
+		notebooks = append(notebooks, s.notebooks[id])
+	}
+	return notebooks, nil
+}
+
+func (s *MemoryNotebookStore) Get(ctx context.Context, id primitive.ObjectID) (models.Notebook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notebook, ok := s.notebooks[id]
+	if !ok {
+		return models.Notebook{}, ErrNotFound
+	}
+	return notebook, nil
+}
+
+func (s *MemoryNotebookStore) Create(ctx context.Context, notebook *models.Notebook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.create(notebook)
+	return nil
+}
+
+func (s *MemoryNotebookStore) create(notebook *models.Notebook) {
+	if notebook.ID.IsZero() {
+		notebook.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.notebooks[notebook.ID]; !ok {
+		s.order = append(s.order, notebook.ID)
+	}
+	s.notebooks[notebook.ID] = *notebook
+}
+
+func (s *MemoryNotebookStore) Update(ctx context.Context, notebook models.Notebook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notebooks[notebook.ID]; !ok {
+		return ErrNotFound
+	}
+	s.notebooks[notebook.ID] = notebook
+	return nil
+}
+
+func (s *MemoryNotebookStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notebooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.notebooks, id)
+	s.order = removeID(s.order, id)
+	return nil
+}
+
+func (s *MemoryNotebookStore) Inbox(ctx context.Context) (models.Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.order {
+		if notebook := s.notebooks[id]; notebook.Inbox {
+			return notebook, nil
+		}
+	}
+	now := time.Now().UTC()
+	inbox := models.Notebook{Name: "Inbox", Inbox: true, CreatedAt: now, UpdatedAt: now}
+	s.create(&inbox)
+	return inbox, nil
+}
+
+// MemoryLinkStore is a LinkStore that keeps links in process memory
+type MemoryLinkStore struct {
+	mu    sync.RWMutex
+	order []primitive.ObjectID
+	links map[primitive.ObjectID][]models.Link // by source note
+}
+
+// NewMemoryLinkStore returns an empty in-memory LinkStore
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{links: make(map[primitive.ObjectID][]models.Link)}
+}
+
+func (s *MemoryLinkStore) List(ctx context.Context) ([]models.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.collect(func(models.Link) bool { return true }), nil
+}
+
+func (s *MemoryLinkStore) From(ctx context.Context, sourceID primitive.ObjectID) ([]models.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.collect(func(link models.Link) bool { return link.SourceID == sourceID }), nil
+}
+
+func (s *MemoryLinkStore) To(ctx context.Context, targetID primitive.ObjectID) ([]models.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.collect(func(link models.Link) bool { return link.TargetID != nil && *link.TargetID == targetID }), nil
+}
+
+func (s *MemoryLinkStore) Broken(ctx context.Context) ([]models.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.collect(func(link models.Link) bool { return link.TargetID == nil }), nil
+}
+
+func (s *MemoryLinkStore) Replace(ctx context.Context, sourceID primitive.ObjectID, links []models.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(links) == 0 {
+		delete(s.links, sourceID)
+		s.order = removeID(s.order, sourceID)
+		return nil
+	}
+	if _, ok := s.links[sourceID]; !ok {
+		s.order = append(s.order, sourceID)
+	}
+	stored := make([]models.Link, len(links))
+	for i, link := range links {
+		link.SourceID = sourceID
+		stored[i] = cloneLink(link)
+	}
+	s.links[sourceID] = stored
+	return nil
+}
+
+func (s *MemoryLinkStore) Resolve(ctx context.Context, key string, targetID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, links := range s.links {
+		for i := range links {
+			if links[i].TargetID == nil && links[i].Key == key {
+				id := targetID
+				links[i].TargetID = &id
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryLinkStore) Unlink(ctx context.Context, targetID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, links := range s.links {
+		for i := range links {
+			if links[i].TargetID != nil && *links[i].TargetID == targetID {
+				links[i].TargetID = nil
+			}
+		}
+	}
+	return nil
+}
+
+// collect returns copies of the links passing keep, grouped by source in the
+// order the sources were first linked from
+func (s *MemoryLinkStore) collect(keep func(models.Link) bool) []models.Link {
+	links := []models.Link{}
+	for _, id := range s.order {
+		for _, link := range s.links[id] {
+			if keep(link) {
+				links = append(links, cloneLink(link))
+			}
+		}
+	}
+	return links
+}
+
+// MemoryRevisionStore is a RevisionStore that keeps revisions in process memory
+type MemoryRevisionStore struct {
+	mu        sync.RWMutex
+	revisions map[primitive.ObjectID][]models.Revision
+}
+
+// NewMemoryRevisionStore returns an empty in-memory RevisionStore
+func NewMemoryRevisionStore() *MemoryRevisionStore {
+	return &MemoryRevisionStore{revisions: make(map[primitive.ObjectID][]models.Revision)}
+}
+
+func (s *MemoryRevisionStore) List(ctx context.Context, noteID primitive.ObjectID) ([]models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := make([]models.Revision, 0, len(s.revisions[noteID]))
+	for _, rev := range s.revisions[noteID] {
+		revisions = append(revisions, cloneRevision(rev))
+	}
+	return revisions, nil
+}
+
+func (s *MemoryRevisionStore) Get(ctx context.Context, noteID primitive.ObjectID, number int) (models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Revisions are numbered from 1 without gaps
+	revisions := s.revisions[noteID]
+	if number < 1 || number > len(revisions) {
+		return models.Revision{}, ErrNotFound
+	}
+	return cloneRevision(revisions[number-1]), nil
+}
+
+func (s *MemoryRevisionStore) Latest(ctx context.Context, noteID primitive.ObjectID) (models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := s.revisions[noteID]
+	if len(revisions) == 0 {
+		return models.Revision{}, ErrNotFound
+	}
+	return cloneRevision(revisions[len(revisions)-1]), nil
+}
+
+func (s *MemoryRevisionStore) Create(ctx context.Context, rev *models.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rev.ID.IsZero() {
+		rev.ID = primitive.NewObjectID()
+	}
+	rev.Number = len(s.revisions[rev.NoteID]) + 1
+	s.revisions[rev.NoteID] = append(s.revisions[rev.NoteID], cloneRevision(*rev))
+	return nil
+}
+
+func (s *MemoryRevisionStore) DeleteAll(ctx context.Context, noteID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revisions, noteID)
+	return nil
+}
+
+// cloneNote copies the note so callers cannot mutate stored slices
+func cloneNote(note models.Note) models.Note {
+	if note.Tags != nil {
+		note.Tags = slices.Clone(note.Tags)
+	}
+	if note.NotebookID != nil {
+		id := *note.NotebookID
+		note.NotebookID = &id
+	}
+	return note
+}
+
+// cloneRevision copies the revision so callers cannot mutate stored slices
+func cloneRevision(rev models.Revision) models.Revision {
+	if rev.Tags != nil {
+		rev.Tags = slices.Clone(rev.Tags)
+	}
+	return rev
+}
+
+// cloneImport copies the import so callers cannot mutate stored slices
+func cloneImport(imp models.Import) models.Import {
+	if imp.Media != nil {
+		media := *imp.Media
+		imp.Media = &media
+	}
+	if imp.Tags != nil {
+		imp.Tags = slices.Clone(imp.Tags)
+	}
+	if imp.Thumbnails != nil {
+		imp.Thumbnails = append([]models.Thumbnail(nil), imp.Thumbnails...)
+	}
+	return imp
+}
+
+// cloneLink copies the link so callers cannot mutate its stored target
+func cloneLink(link models.Link) models.Link {
+	if link.TargetID != nil {
+		id := *link.TargetID
+		link.TargetID = &id
+	}
+	return link
+}
+
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	for i, existing := range ids {
+		if existing == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,404 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"knowledge_base_backend/blob"
+	"knowledge_base_backend/links"
+	"knowledge_base_backend/migrate"
+	"knowledge_base_backend/tags"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCollections are the collections the MongoDB backend keeps its data in
+type MongoCollections struct {
+	Notes     *mongo.Collection
+	Imports   *mongo.Collection
+	Revisions *mongo.Collection
+	Notebooks *mongo.Collection
+	Links     *mongo.Collection
+}
+
+// MongoMigrations returns the schema migrations of the MongoDB backend. New
+// migrations are appended with the next version; released ones never change.
+func MongoMigrations(collections MongoCollections, blobs blob.Store) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "move inline import data into the blob store",
+			Up: func(ctx context.Context) error {
+				return migrateInlineData(ctx, collections.Imports, blobs)
+			},
+		},
+		{
+			Version:     2,
+			Description: "drop placeholder resolution and duration from imports",
+			Up: func(ctx context.Context) error {
+				_, err := collections.Imports.UpdateMany(ctx,
+					bson.M{"$or": bson.A{
+						bson.M{"resolution": bson.M{"$exists": true}},
+						bson.M{"duration": bson.M{"$exists": true}},
+					}},
+					bson.M{"$unset": bson.M{"resolution": "", "duration": ""}},
+				)
+				return err
+			},
+		},
+		{
+			Version:     3,
+			Description: "store note timestamps as dates and version every note",
+			Up: func(ctx context.Context) error {
+				return migrateNoteTimestamps(ctx, collections.Notes)
+			},
+		},
+		{
+			Version:     4,
+			Description: "index note revisions by note and number",
+			Up: func(ctx context.Context) error {
+				// The unique index keeps revision numbers of a note distinct
+				// when two writers record a revision at once
+				_, err := collections.Revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "note_id", Value: 1}, {Key: "number", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				})
+				return err
+			},
+		},
+		{
+			Version:     5,
+			Description: "split import tag strings into normalized lists",
+			Up: func(ctx context.Context) error {
+				return migrateImportTags(ctx, collections.Imports)
+			},
+		},
+		{
+			Version:     6,
+			Description: "normalize note tags",
+			Up: func(ctx context.Context) error {
+				return normalizeTagLists(ctx, collections.Notes, true)
+			},
+		},
+		{
+			Version:     7,
+			Description: "normalize the levels of hierarchical tags",
+			Up: func(ctx context.Context) error {
+				if err := normalizeTagLists(ctx, collections.Notes, true); err != nil {
+					return err
+				}
+				return normalizeTagLists(ctx, collections.Imports, false)
+			},
+		},
+		{
+			Version:     8,
+			Description: "index notes by notebook and allow a single inbox notebook",
+			Up: func(ctx context.Context) error {
+				_, err := collections.Notes.Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys: bson.D{{Key: "notebook_id", Value: 1}},
+				})
+				if err != nil {
+					return err
+				}
+				// Concurrent first requests for the inbox must not create two
+				_, err = collections.Notebooks.Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys: bson.D{{Key: "inbox", Value: 1}},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{"inbox": true}),
+				})
+				return err
+			},
+		},
+		{
+			Version:     9,
+			Description: "index note links and record the links in existing notes",
+			Up: func(ctx context.Context) error {
+				_, err := collections.Links.Indexes().CreateMany(ctx, []mongo.IndexModel{
+					{Keys: bson.D{{Key: "source_id", Value: 1}, {Key: "position", Value: 1}}},
+					{Keys: bson.D{{Key: "target_id", Value: 1}}},
+					{Keys: bson.D{{Key: "key", Value: 1}}},
+				})
+				if err != nil {
+					return err
+				}
+				return migrateLinks(ctx, collections.Notes, collections.Links)
+			},
+		},
+		{
+			Version:     10,
+			Description: "mark existing notes as plain text",
+			Up: func(ctx context.Context) error {
+				_, err := collections.Notes.UpdateMany(ctx,
+					bson.M{"format": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"format": "plain"}},
+				)
+				return err
+			},
+		},
+		{
+			Version:     11,
+			Description: "drop the formatted_date field edits left on legacy notes",
+			Up: func(ctx context.Context) error {
+				return migrateFormattedDates(ctx, collections.Notes)
+			},
+		},
+	}
+}
+
+// migrateInlineData moves file content stored inline in the legacy "data"
+// field into blobs, leaving only the blob reference on each document.
+// Documents are processed one at a time so the whole collection is never
+// held in memory.
+func migrateInlineData(ctx context.Context, imports *mongo.Collection, blobs blob.Store) error {
+	cursor, err := imports.Find(ctx, bson.M{"data": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			FileName string             `bson:"file_name"`
+			Data     []byte             `bson:"data"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+
+		info, err := blobs.Put(ctx, legacy.FileName, bytes.NewReader(legacy.Data))
+		if err != nil {
+			return fmt.Errorf("import %s: %w", legacy.ID.Hex(), err)
+		}
+		update := bson.M{
+			"$set":   bson.M{"blob_id": info.ID, "size": info.Size},
+			"$unset": bson.M{"data": ""},
+		}
+		if _, err := imports.UpdateOne(ctx, bson.M{"_id": legacy.ID}, update); err != nil {
+			blobs.Delete(ctx, info.ID)
+			return fmt.Errorf("import %s: %w", legacy.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
+
+// migrateNoteTimestamps replaces the RFC 3339 "createdat" string and the
+// "formatteddate" display string of legacy notes with created_at and
+// updated_at dates, and gives unversioned notes version 1. A note with no
+// usable timestamp takes its creation time from its ObjectID.
+func migrateNoteTimestamps(ctx context.Context, notes *mongo.Collection) error {
+	cursor, err := notes.Find(ctx, bson.M{"created_at": bson.M{"$not": bson.M{"$type": "date"}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy bson.M
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+		id, _ := legacy["_id"].(primitive.ObjectID)
+
+		created := id.Timestamp().UTC()
+		if t, ok := parseLegacyTime(legacy["createdat"], time.RFC3339); ok {
+			created = t
+		} else if t, ok := parseLegacyTime(legacy["formatteddate"], "January 2, 2006"); ok {
+			created = t
+		}
+		updated := created
+		if t, ok := parseLegacyTime(legacy["updatedat"], time.RFC3339); ok {
+			updated = t
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"created_at": created, "updated_at": updated},
+			"$unset": bson.M{"createdat": "", "updatedat": "", "formatteddate": ""},
+		}
+		if _, err := notes.UpdateOne(ctx, bson.M{"_id": legacy["_id"]}, update); err != nil {
+			return fmt.Errorf("note %s: %w", id.Hex(), err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = notes.UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}},
+	)
+	return err
+}
+
+// migrateFormattedDates removes the formatted_date field legacy edits wrote
+// the day of the last change under, moving updated_at forward to that day
+// where it is later
+func migrateFormattedDates(ctx context.Context, notes *mongo.Collection) error {
+	opts := options.Find().SetProjection(bson.M{"formatted_date": 1, "updated_at": 1})
+	cursor, err := notes.Find(ctx, bson.M{"formatted_date": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy bson.M
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+		id, _ := legacy["_id"].(primitive.ObjectID)
+
+		update := bson.M{"$unset": bson.M{"formatted_date": ""}}
+		updated, _ := legacy["updated_at"].(primitive.DateTime)
+		if t, ok := parseLegacyTime(legacy["formatted_date"], "January 2, 2006"); ok && t.After(updated.Time()) {
+			update["$set"] = bson.M{"updated_at": t}
+		}
+		if _, err := notes.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+			return fmt.Errorf("note %s: %w", id.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
+
+// parseLegacyTime parses a string field of a legacy document
+func parseLegacyTime(value any, layout string) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// migrateImportTags replaces the free-form tags string of legacy imports with
+// the list tags.Split reads from it
+func migrateImportTags(ctx context.Context, imports *mongo.Collection) error {
+	cursor, err := imports.Find(ctx, bson.M{"tags": bson.M{"$type": "string"}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Tags string             `bson:"tags"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{"tags": tags.Split(legacy.Tags)}}
+		if _, err := imports.UpdateOne(ctx, bson.M{"_id": legacy.ID}, update); err != nil {
+			return fmt.Errorf("import %s: %w", legacy.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
+
+// normalizeTagLists rewrites the tags of documents whose tags are not
+// normalized, bumping the version of each when versioned is set
+func normalizeTagLists(ctx context.Context, collection *mongo.Collection, versioned bool) error {
+	opts := options.Find().SetProjection(bson.M{"tags": 1})
+	cursor, err := collection.Find(ctx, bson.M{"tags.0": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Tags []string           `bson:"tags"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		normalized := tags.NormalizeAll(doc.Tags)
+		if slices.Equal(normalized, doc.Tags) {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"tags": normalized}}
+		if versioned {
+			update["$inc"] = bson.M{"version": 1}
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+			return fmt.Errorf("%s %s: %w", collection.Name(), doc.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
+
+// migrateLinks records the [[links]] written in every note, resolving them
+// the way the server does: by ID first, then by title, oldest note first
+func migrateLinks(ctx context.Context, notes, linkEdges *mongo.Collection) error {
+	opts := options.Find().SetProjection(bson.M{"title": 1}).SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := notes.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	var titles []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Title string             `bson:"title"`
+	}
+	if err := cursor.All(ctx, &titles); err != nil {
+		return err
+	}
+	ids := make(map[primitive.ObjectID]bool, len(titles))
+	byKey := make(map[string]primitive.ObjectID, len(titles))
+	for _, note := range titles {
+		ids[note.ID] = true
+		if _, ok := byKey[links.Key(note.Title)]; !ok {
+			byKey[links.Key(note.Title)] = note.ID
+		}
+	}
+	resolve := func(ref links.Ref) *primitive.ObjectID {
+		if id, ok := links.ID(ref.Target); ok && ids[id] {
+			return &id
+		}
+		if id, ok := byKey[links.Key(ref.Target)]; ok {
+			return &id
+		}
+		return nil
+	}
+
+	cursor, err = notes.Find(ctx, bson.M{"content": bson.M{"$regex": `\[\[`}},
+		options.Find().SetProjection(bson.M{"content": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var note struct {
+			ID      primitive.ObjectID `bson:"_id"`
+			Content string             `bson:"content"`
+		}
+		if err := cursor.Decode(&note); err != nil {
+			return err
+		}
+		edges := links.Edges(note.Content, resolve)
+		if len(edges) == 0 {
+			continue
+		}
+		docs := make([]any, len(edges))
+		for i, edge := range edges {
+			edge.SourceID = note.ID
+			docs[i] = edge
+		}
+		if _, err := linkEdges.DeleteMany(ctx, bson.M{"source_id": note.ID}); err != nil {
+			return fmt.Errorf("note %s: %w", note.ID.Hex(), err)
+		}
+		if _, err := linkEdges.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("note %s: %w", note.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
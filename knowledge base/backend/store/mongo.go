@@ -0,0 +1,631 @@
+package store
+
+import (
+	"context"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConnectMongo opens a client for the given URI and verifies the server is reachable
+func ConnectMongo(ctx context.Context, uri string) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
+}
+
+// MongoNoteStore is a NoteStore backed by a MongoDB collection
+type MongoNoteStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoNoteStore returns a NoteStore that reads and writes the given collection
+func NewMongoNoteStore(collection *mongo.Collection) *MongoNoteStore {
+	return &MongoNoteStore{collection: collection}
+}
+
+func (s *MongoNoteStore) List(ctx context.Context) ([]models.Note, error) {
+	return s.find(ctx, bson.M{})
+}
+
+func (s *MongoNoteStore) Find(ctx context.Context, q query.Node) ([]models.Note, error) {
+	return s.find(ctx, query.Mongo(q))
+}
+
+func (s *MongoNoteStore) FindPage(ctx context.Context, q query.Node, page Page) ([]models.Note, *Cursor, error) {
+	key, err := lookupSort(NoteSorts(), page)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, order := mongoPage(page, key)
+	opts := options.Find().SetSort(order)
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit) + 1)
+	}
+	if page.Summary {
+		opts.SetProjection(bson.M{"content": 0})
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"$and": bson.A{query.Mongo(q), after}}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notes := []models.Note{}
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, nil, err
+	}
+	if page.Limit <= 0 || len(notes) <= page.Limit {
+		return notes, nil, nil
+	}
+	notes = notes[:page.Limit]
+	last := notes[len(notes)-1]
+	pos := position{time: last.CreatedAt, text: last.Title, id: last.ID}
+	if page.Sort == "updated" {
+		pos.time = last.UpdatedAt
+	}
+	return notes, pos.cursor(page, key), nil
+}
+
+func (s *MongoNoteStore) Get(ctx context.Context, id primitive.ObjectID) (models.Note, error) {
+	var note models.Note
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&note)
+	if err == mongo.ErrNoDocuments {
+		return note, ErrNotFound
+	}
+	return note, err
+}
+
+func (s *MongoNoteStore) Create(ctx context.Context, note *models.Note) error {
+	if note.ID.IsZero() {
+		note.ID = primitive.NewObjectID()
+	}
+	note.Version = 1
+	_, err := s.collection.InsertOne(ctx, note)
+	return err
+}
+
+func (s *MongoNoteStore) Update(ctx context.Context, note *models.Note, ifVersion int) error {
+	update := bson.M{
+		"$set": bson.M{
+			"title":       note.Title,
+			"content":     note.Content,
+			"format":      note.Format,
+			"tags":        note.Tags,
+			"notebook_id": note.NotebookID,
+			"updated_at":  note.UpdatedAt,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, versionFilter(note.ID, ifVersion), update, opts).Decode(note)
+	if err == mongo.ErrNoDocuments {
+		return s.missOrConflict(ctx, note.ID)
+	}
+	return err
+}
+
+func (s *MongoNoteStore) Delete(ctx context.Context, id primitive.ObjectID, ifVersion int) error {
+	result, err := s.collection.DeleteOne(ctx, versionFilter(id, ifVersion))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return s.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+func (s *MongoNoteStore) Move(ctx context.Context, id primitive.ObjectID, notebookID *primitive.ObjectID, updatedAt time.Time) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{"notebook_id": notebookID, "updated_at": updatedAt},
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "notebook_id": bson.M{"$ne": notebookID}}, update)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+	// Either there is no such note or it is already in the notebook
+	if err := s.missOrConflict(ctx, id); err != ErrVersionConflict {
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *MongoNoteStore) TagCounts(ctx context.Context) (map[string]int, error) {
+	return mongoTagCounts(ctx, s.collection)
+}
+
+func (s *MongoNoteStore) ReplaceTag(ctx context.Context, from, to string, updatedAt time.Time) ([]primitive.ObjectID, error) {
+	changes := bson.M{
+		"$set": bson.M{"updated_at": updatedAt},
+		"$inc": bson.M{"version": 1},
+	}
+	return mongoReplaceTag(ctx, s.collection, from, to, changes)
+}
+
+// versionFilter selects the note, at the given version unless it is AnyVersion
+func versionFilter(id primitive.ObjectID, ifVersion int) bson.M {
+	filter := bson.M{"_id": id}
+	if ifVersion != AnyVersion {
+		filter["version"] = ifVersion
+	}
+	return filter
+}
+
+// missOrConflict explains why a conditional write matched no note
+func (s *MongoNoteStore) missOrConflict(ctx context.Context, id primitive.ObjectID) error {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (s *MongoNoteStore) find(ctx context.Context, filter bson.M) ([]models.Note, error) {
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notes := []models.Note{}
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// MongoImportStore is an ImportStore backed by a MongoDB collection
+type MongoImportStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoImportStore returns an ImportStore that reads and writes the given collection
+func NewMongoImportStore(collection *mongo.Collection) *MongoImportStore {
+	return &MongoImportStore{collection: collection}
+}
+
+func (s *MongoImportStore) List(ctx context.Context) ([]models.Import, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	imports := []models.Import{}
+	if err := cursor.All(ctx, &imports); err != nil {
+		return nil, err
+	}
+	return imports, nil
+}
+
+func (s *MongoImportStore) FindPage(ctx context.Context, filter ImportFilter, page Page) ([]models.Import, *Cursor, error) {
+	key, err := lookupSort(ImportSorts(), page)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, order := mongoPage(page, key)
+	opts := options.Find().SetSort(order)
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit) + 1)
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"$and": bson.A{filter.mongo(), after}}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	imports := []models.Import{}
+	if err := cursor.All(ctx, &imports); err != nil {
+		return nil, nil, err
+	}
+	if page.Limit <= 0 || len(imports) <= page.Limit {
+		return imports, nil, nil
+	}
+	imports = imports[:page.Limit]
+	last := imports[len(imports)-1]
+	pos := position{time: last.CreatedAt, text: last.FileName, id: last.ID}
+	return imports, pos.cursor(page, key), nil
+}
+
+func (s *MongoImportStore) Get(ctx context.Context, id primitive.ObjectID) (models.Import, error) {
+	var imp models.Import
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&imp)
+	if err == mongo.ErrNoDocuments {
+		return imp, ErrNotFound
+	}
+	return imp, err
+}
+
+func (s *MongoImportStore) Create(ctx context.Context, imp *models.Import) error {
+	if imp.ID.IsZero() {
+		imp.ID = primitive.NewObjectID()
+	}
+	_, err := s.collection.InsertOne(ctx, imp)
+	return err
+}
+
+func (s *MongoImportStore) Update(ctx context.Context, imp models.Import) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": imp.ID}, imp)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoImportStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoImportStore) SetThumbnails(ctx context.Context, id primitive.ObjectID, thumbnails []models.Thumbnail, failure string) (bool, error) {
+	set := bson.M{"thumbnails": thumbnails}
+	if failure != "" {
+		set = bson.M{"thumbnail_error": failure}
+	}
+	filter := bson.M{
+		"_id":             id,
+		"thumbnails.0":    bson.M{"$exists": false},
+		"thumbnail_error": bson.M{"$in": bson.A{nil, ""}},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+	// Either there is no such import or it already has its thumbnails
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, ErrNotFound
+	}
+	return false, nil
+}
+
+func (s *MongoImportStore) TagCounts(ctx context.Context) (map[string]int, error) {
+	return mongoTagCounts(ctx, s.collection)
+}
+
+func (s *MongoImportStore) ReplaceTag(ctx context.Context, from, to string) ([]primitive.ObjectID, error) {
+	return mongoReplaceTag(ctx, s.collection, from, to, bson.M{})
+}
+
+// mongoTagCounts counts the documents in the collection carrying each tag
+func mongoTagCounts(ctx context.Context, collection *mongo.Collection) (map[string]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Tag   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(groups))
+	for _, g := range groups {
+		counts[g.Tag] = g.Count
+	}
+	return counts, nil
+}
+
+// mongoReplaceTag replaces the tag from with to in the tags array of every
+// document carrying it, or pulls it when to is empty, applying changes to
+// each document updated. It returns the IDs of the documents carrying from.
+func mongoReplaceTag(ctx context.Context, collection *mongo.Collection, from, to string, changes bson.M) ([]primitive.ObjectID, error) {
+	// Collect the IDs first so the caller can refresh what it derived from them
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"tags": from}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+
+	if to != "" {
+		// Documents already carrying to only lose from
+		_, err := collection.UpdateMany(ctx,
+			bson.M{"tags": bson.M{"$all": bson.A{from, to}}},
+			withChanges(bson.M{"$pull": bson.M{"tags": from}}, changes))
+		if err != nil {
+			return nil, err
+		}
+		_, err = collection.UpdateMany(ctx,
+			bson.M{"tags": from},
+			withChanges(bson.M{"$set": bson.M{"tags.$": to}}, changes))
+		if err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"tags": from},
+		withChanges(bson.M{"$pull": bson.M{"tags": from}}, changes))
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// withChanges merges the operators of two update documents
+func withChanges(update, changes bson.M) bson.M {
+	merged := bson.M{}
+	for _, doc := range []bson.M{update, changes} {
+		for op, fields := range doc {
+			target, ok := merged[op].(bson.M)
+			if !ok {
+				target = bson.M{}
+				merged[op] = target
+			}
+			for field, value := range fields.(bson.M) {
+				target[field] = value
+			}
+		}
+	}
+	return merged
+}
+
+// MongoNotebookStore is a NotebookStore backed by a MongoDB collection
+type MongoNotebookStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoNotebookStore returns a NotebookStore that reads and writes the given collection
+func NewMongoNotebookStore(collection *mongo.Collection) *MongoNotebookStore {
+	return &MongoNotebookStore{collection: collection}
+}
+
+func (s *MongoNotebookStore) List(ctx context.Context) ([]models.Notebook, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notebooks := []models.Notebook{}
+	if err := cursor.All(ctx, &notebooks); err != nil {
+		return nil, err
+	}
+	return notebooks, nil
+}
+
+func (s *MongoNotebookStore) Get(ctx context.Context, id primitive.ObjectID) (models.Notebook, error) {
+	var notebook models.Notebook
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&notebook)
+	if err == mongo.ErrNoDocuments {
+		return notebook, ErrNotFound
+	}
+	return notebook, err
+}
+
+func (s *MongoNotebookStore) Create(ctx context.Context, notebook *models.Notebook) error {
+	if notebook.ID.IsZero() {
+		notebook.ID = primitive.NewObjectID()
+	}
+	_, err := s.collection.InsertOne(ctx, notebook)
+	return err
+}
+
+func (s *MongoNotebookStore) Update(ctx context.Context, notebook models.Notebook) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": notebook.ID}, notebook)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoNotebookStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoNotebookStore) Inbox(ctx context.Context) (models.Notebook, error) {
+	now := time.Now().UTC()
+	update := bson.M{"$setOnInsert": bson.M{
+		"name":       "Inbox",
+		"parent_id":  nil,
+		"created_at": now,
+		"updated_at": now,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var inbox models.Notebook
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"inbox": true}, update, opts).Decode(&inbox)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another request created the inbox between our lookup and insert
+		err = s.collection.FindOne(ctx, bson.M{"inbox": true}).Decode(&inbox)
+	}
+	return inbox, err
+}
+
+// MongoLinkStore is a LinkStore backed by a MongoDB collection
+type MongoLinkStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLinkStore returns a LinkStore that reads and writes the given collection
+func NewMongoLinkStore(collection *mongo.Collection) *MongoLinkStore {
+	return &MongoLinkStore{collection: collection}
+}
+
+func (s *MongoLinkStore) List(ctx context.Context) ([]models.Link, error) {
+	return s.find(ctx, bson.M{})
+}
+
+func (s *MongoLinkStore) From(ctx context.Context, sourceID primitive.ObjectID) ([]models.Link, error) {
+	return s.find(ctx, bson.M{"source_id": sourceID})
+}
+
+func (s *MongoLinkStore) To(ctx context.Context, targetID primitive.ObjectID) ([]models.Link, error) {
+	return s.find(ctx, bson.M{"target_id": targetID})
+}
+
+func (s *MongoLinkStore) Broken(ctx context.Context) ([]models.Link, error) {
+	return s.find(ctx, bson.M{"target_id": nil})
+}
+
+func (s *MongoLinkStore) Replace(ctx context.Context, sourceID primitive.ObjectID, links []models.Link) error {
+	if _, err := s.collection.DeleteMany(ctx, bson.M{"source_id": sourceID}); err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	docs := make([]any, len(links))
+	for i, link := range links {
+		link.ID = primitive.NilObjectID
+		link.SourceID = sourceID
+		docs[i] = link
+	}
+	_, err := s.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (s *MongoLinkStore) Resolve(ctx context.Context, key string, targetID primitive.ObjectID) error {
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{"target_id": nil, "key": key},
+		bson.M{"$set": bson.M{"target_id": targetID}})
+	return err
+}
+
+func (s *MongoLinkStore) Unlink(ctx context.Context, targetID primitive.ObjectID) error {
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{"target_id": targetID},
+		bson.M{"$set": bson.M{"target_id": nil}})
+	return err
+}
+
+func (s *MongoLinkStore) find(ctx context.Context, filter bson.M) ([]models.Link, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "source_id", Value: 1}, {Key: "position", Value: 1}})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	links := []models.Link{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// MongoRevisionStore is a RevisionStore backed by a MongoDB collection
+type MongoRevisionStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRevisionStore returns a RevisionStore that reads and writes the given collection
+func NewMongoRevisionStore(collection *mongo.Collection) *MongoRevisionStore {
+	return &MongoRevisionStore{collection: collection}
+}
+
+func (s *MongoRevisionStore) List(ctx context.Context, noteID primitive.ObjectID) ([]models.Revision, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "number", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"note_id": noteID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.Revision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *MongoRevisionStore) Get(ctx context.Context, noteID primitive.ObjectID, number int) (models.Revision, error) {
+	return s.findOne(ctx, bson.M{"note_id": noteID, "number": number}, nil)
+}
+
+func (s *MongoRevisionStore) Latest(ctx context.Context, noteID primitive.ObjectID) (models.Revision, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "number", Value: -1}})
+	return s.findOne(ctx, bson.M{"note_id": noteID}, opts)
+}
+
+func (s *MongoRevisionStore) Create(ctx context.Context, rev *models.Revision) error {
+	if rev.ID.IsZero() {
+		rev.ID = primitive.NewObjectID()
+	}
+	// Another writer may take the next number first; the unique index
+	// rejects the duplicate and the number is recomputed
+	for attempt := 0; ; attempt++ {
+		latest, err := s.Latest(ctx, rev.NoteID)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		rev.Number = latest.Number + 1
+		_, err = s.collection.InsertOne(ctx, rev)
+		if err == nil || !mongo.IsDuplicateKeyError(err) || attempt == 4 {
+			return err
+		}
+	}
+}
+
+func (s *MongoRevisionStore) DeleteAll(ctx context.Context, noteID primitive.ObjectID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"note_id": noteID})
+	return err
+}
+
+func (s *MongoRevisionStore) findOne(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (models.Revision, error) {
+	var rev models.Revision
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&rev)
+	if err == mongo.ErrNoDocuments {
+		return rev, ErrNotFound
+	}
+	return rev, err
+}
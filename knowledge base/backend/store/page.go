@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidCursor is returned for a cursor that is malformed or was issued
+// for a different sort order
+var ErrInvalidCursor = errors.New("store: invalid cursor")
+
+// Page selects one page of a sorted listing. Items are ordered by the Sort
+// key, then by ID so that items with equal keys still have a fixed order.
+type Page struct {
+	Sort    string // a sort key the listing supports
+	Desc    bool
+	Limit   int
+	After   *Cursor // resume after this item; nil starts at the beginning
+	Summary bool    // leave out fields too heavy for listings, such as note content
+}
+
+// Cursor marks the last item of a page so the next page can resume after it
+type Cursor struct {
+	Sort string             `json:"s"`
+	Desc bool               `json:"d,omitempty"`
+	Key  string             `json:"k"` // sort value, with times in RFC 3339
+	ID   primitive.ObjectID `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token from Encode, checking it continues the given sort
+func DecodeCursor(token, sort string, desc bool) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+	if key, ok := sortKeys[sort]; ok && !key.text {
+		if _, err := time.Parse(time.RFC3339Nano, c.Key); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// sortKey is one way a listing can be sorted
+type sortKey struct {
+	field string // bson field name
+	text  bool   // sorted by text rather than time
+}
+
+// sortKeys holds every sort key by name
+var sortKeys = map[string]sortKey{
+	"created": {field: "created_at"},
+	"updated": {field: "updated_at"},
+	"title":   {field: "title", text: true},
+	"name":    {field: "file_name", text: true},
+}
+
+// lookupSort returns the sort key named by page.Sort if it is one of names
+func lookupSort(names []string, page Page) (sortKey, error) {
+	for _, name := range names {
+		if name == page.Sort {
+			return sortKeys[name], nil
+		}
+	}
+	return sortKey{}, fmt.Errorf("store: unknown sort %q", page.Sort)
+}
+
+// NoteSorts are the sort keys note listings support
+func NoteSorts() []string { return []string{"created", "updated", "title"} }
+
+// ImportSorts are the sort keys import listings support
+func ImportSorts() []string { return []string{"created", "name"} }
+
+// position is where an item falls in a sorted listing
+type position struct {
+	time time.Time
+	text string
+	id   primitive.ObjectID
+}
+
+// cursor returns the cursor that resumes a listing after p
+func (p position) cursor(page Page, key sortKey) *Cursor {
+	c := &Cursor{Sort: page.Sort, Desc: page.Desc, Key: p.text, ID: p.id}
+	if !key.text {
+		c.Key = p.time.Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+// compare orders two positions by sort value then ID, following page.Desc
+func (p position) compare(other position, page Page, key sortKey) int {
+	c := 0
+	if key.text {
+		c = strings.Compare(p.text, other.text)
+	} else {
+		c = p.time.Compare(other.time)
+	}
+	if c == 0 {
+		c = bytes.Compare(p.id[:], other.id[:])
+	}
+	if page.Desc {
+		return -c
+	}
+	return c
+}
+
+// position is where the item the cursor marks falls in the listing
+func (c *Cursor) position(key sortKey) position {
+	if key.text {
+		return position{text: c.Key, id: c.ID}
+	}
+	// DecodeCursor has checked the time parses
+	t, _ := time.Parse(time.RFC3339Nano, c.Key)
+	return position{time: t, id: c.ID}
+}
+
+// paginate sorts items, drops those up to page.After and cuts the rest to
+// page.Limit, returning the cursor for the next page when there is one
+func paginate[T any](items []T, page Page, key sortKey, pos func(T) position) ([]T, *Cursor) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return pos(items[i]).compare(pos(items[j]), page, key) < 0
+	})
+	if page.After != nil {
+		after := page.After.position(key)
+		start := sort.Search(len(items), func(i int) bool {
+			return pos(items[i]).compare(after, page, key) > 0
+		})
+		items = items[start:]
+	}
+	if page.Limit > 0 && len(items) > page.Limit {
+		items = items[:page.Limit]
+		return items, pos(items[len(items)-1]).cursor(page, key)
+	}
+	return items, nil
+}
+
+// mongoPage returns the filter that skips to after the cursor and the sort
+// order of the page
+func mongoPage(page Page, key sortKey) (bson.M, bson.D) {
+	dir, op := 1, "$gt"
+	if page.Desc {
+		dir, op = -1, "$lt"
+	}
+	order := bson.D{{Key: key.field, Value: dir}, {Key: "_id", Value: dir}}
+	if page.After == nil {
+		return bson.M{}, order
+	}
+	pos := page.After.position(key)
+	var value any = pos.time
+	if key.text {
+		value = pos.text
+	}
+	after := bson.M{"$or": bson.A{
+		bson.M{key.field: bson.M{op: value}},
+		bson.M{key.field: value, "_id": bson.M{op: page.After.ID}},
+	}}
+	return after, order
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when the requested document does not exist
+var ErrNotFound = errors.New("store: not found")
+
+// ErrVersionConflict is returned when a conditional write finds the document
+// at a different version than the caller expected
+var ErrVersionConflict = errors.New("store: version conflict")
+
+// AnyVersion makes a note write unconditional
+const AnyVersion = -1
+
+// NoteStore persists notes
+type NoteStore interface {
+	// List returns every note in insertion order
+	List(ctx context.Context) ([]models.Note, error)
+	// Find returns the notes matching the query in insertion order
+	Find(ctx context.Context, q query.Node) ([]models.Note, error)
+	// FindPage returns one page of the notes matching the query, sorted by
+	// one of NoteSorts, and the cursor of the next page or nil on the last
+	FindPage(ctx context.Context, q query.Node, page Page) ([]models.Note, *Cursor, error)
+	// Get returns the note with the given ID or ErrNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (models.Note, error)
+	// Create stores a new note at version 1, assigning it an ID if it has none
+	Create(ctx context.Context, note *models.Note) error
+	// Update replaces the editable fields of an existing note and bumps its
+	// version, then refreshes note with the stored result, so its creation
+	// time is never overwritten. Unless ifVersion is
+	// AnyVersion the write only happens if the stored note is at that
+	// version, and fails with ErrVersionConflict otherwise.
+	Update(ctx context.Context, note *models.Note, ifVersion int) error
+	// Delete removes the note with the given ID or returns ErrNotFound.
+	// ifVersion makes the delete conditional as it does for Update.
+	Delete(ctx context.Context, id primitive.ObjectID, ifVersion int) error
+	// Move files the note in the notebook, or in none when notebookID is
+	// nil, setting updated_at and bumping its version. Only those fields are
+	// written, so edits made since the note was read are kept. It reports
+	// whether the note moved, which it does not when already filed there, or
+	// returns ErrNotFound.
+	Move(ctx context.Context, id primitive.ObjectID, notebookID *primitive.ObjectID, updatedAt time.Time) (bool, error)
+	// TagCounts returns how many notes carry each tag
+	TagCounts(ctx context.Context) (map[string]int, error)
+	// ReplaceTag replaces the tag from with to on every note carrying it, or
+	// removes it when to is empty, setting updated_at and bumping the version
+	// of each note changed. It returns the IDs of the changed notes.
+	ReplaceTag(ctx context.Context, from, to string, updatedAt time.Time) ([]primitive.ObjectID, error)
+}
+
+// ImportFilter selects imports. Zero fields match every import.
+type ImportFilter struct {
+	FileTypes []string // kinds or MIME types, matching imports of any of them
+	Tag       string   // matches the tag and the tags below it
+	// CreatedFrom and CreatedTo bound the creation time to [From, To)
+	CreatedFrom, CreatedTo time.Time
+}
+
+// ImportStore persists imported files
+type ImportStore interface {
+	// List returns every import in insertion order
+	List(ctx context.Context) ([]models.Import, error)
+	// FindPage returns one page of the imports matching the filter, sorted
+	// by one of ImportSorts, and the cursor of the next page or nil on the last
+	FindPage(ctx context.Context, filter ImportFilter, page Page) ([]models.Import, *Cursor, error)
+	// Get returns the import with the given ID or ErrNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (models.Import, error)
+	// Create stores a new import, assigning it an ID if it has none
+	Create(ctx context.Context, imp *models.Import) error
+	// Update replaces an existing import or returns ErrNotFound
+	Update(ctx context.Context, imp models.Import) error
+	// Delete removes the import with the given ID or returns ErrNotFound
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// SetThumbnails sets the thumbnails of an import, or the failure that
+	// kept them from being made, unless either is set already. It reports
+	// whether the import was changed, or returns ErrNotFound.
+	SetThumbnails(ctx context.Context, id primitive.ObjectID, thumbnails []models.Thumbnail, failure string) (bool, error)
+	// TagCounts returns how many imports carry each tag
+	TagCounts(ctx context.Context) (map[string]int, error)
+	// ReplaceTag replaces the tag from with to on every import carrying it,
+	// or removes it when to is empty, and returns the IDs of the imports changed
+	ReplaceTag(ctx context.Context, from, to string) ([]primitive.ObjectID, error)
+}
+
+// NotebookStore persists notebooks
+type NotebookStore interface {
+	// List returns every notebook in insertion order
+	List(ctx context.Context) ([]models.Notebook, error)
+	// Get returns the notebook with the given ID or ErrNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (models.Notebook, error)
+	// Create stores a new notebook, assigning it an ID if it has none
+	Create(ctx context.Context, notebook *models.Notebook) error
+	// Update replaces an existing notebook or returns ErrNotFound
+	Update(ctx context.Context, notebook models.Notebook) error
+	// Delete removes the notebook with the given ID or returns ErrNotFound
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Inbox returns the inbox notebook, creating it at the top level the
+	// first time it is asked for
+	Inbox(ctx context.Context) (models.Notebook, error)
+}
+
+// LinkStore persists the links between notes
+type LinkStore interface {
+	// List returns every link
+	List(ctx context.Context) ([]models.Link, error)
+	// From returns the links written in a note, in the order they appear
+	From(ctx context.Context, sourceID primitive.ObjectID) ([]models.Link, error)
+	// To returns the links pointing at a note
+	To(ctx context.Context, targetID primitive.ObjectID) ([]models.Link, error)
+	// Broken returns every link whose target matches no note
+	Broken(ctx context.Context) ([]models.Link, error)
+	// Replace sets the links written in a note, dropping its previous ones
+	Replace(ctx context.Context, sourceID primitive.ObjectID, links []models.Link) error
+	// Resolve points the broken links with the given key at a note
+	Resolve(ctx context.Context, key string, targetID primitive.ObjectID) error
+	// Unlink breaks the links pointing at a note
+	Unlink(ctx context.Context, targetID primitive.ObjectID) error
+}
+
+// RevisionStore persists the revision history of notes
+type RevisionStore interface {
+	// List returns the revisions of a note, oldest first
+	List(ctx context.Context, noteID primitive.ObjectID) ([]models.Revision, error)
+	// Get returns the numbered revision of a note or ErrNotFound
+	Get(ctx context.Context, noteID primitive.ObjectID, number int) (models.Revision, error)
+	// Latest returns the newest revision of a note or ErrNotFound
+	Latest(ctx context.Context, noteID primitive.ObjectID) (models.Revision, error)
+	// Create records a revision, assigning it an ID and the number after the
+	// note's latest revision
+	Create(ctx context.Context, rev *models.Revision) error
+	// DeleteAll removes every revision of a note
+	DeleteAll(ctx context.Context, noteID primitive.ObjectID) error
+}
@@ -0,0 +1,447 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"knowledge_base_backend/models"
+	"knowledge_base_backend/query"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The contract tests take a constructor so every backend can run them
+
+func TestMemoryNoteStore(t *testing.T) {
+	testNoteStore(t, func() NoteStore { return NewMemoryNoteStore() })
+}
+
+func TestMemoryImportStore(t *testing.T) {
+	testImportStore(t, func() ImportStore { return NewMemoryImportStore() })
+}
+
+var storeEpoch = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// createNotes stores notes with the given titles and tags, a minute apart
+func createNotes(t *testing.T, s NoteStore, notes ...models.Note) []models.Note {
+	t.Helper()
+	for i := range notes {
+		notes[i].CreatedAt = storeEpoch.Add(time.Duration(i) * time.Minute)
+		notes[i].UpdatedAt = notes[i].CreatedAt
+		if err := s.Create(context.Background(), &notes[i]); err != nil {
+			t.Fatalf("Create(%q): %v", notes[i].Title, err)
+		}
+	}
+	return notes
+}
+
+func noteTitles(notes []models.Note) []string {
+	titles := []string{}
+	for _, note := range notes {
+		titles = append(titles, note.Title)
+	}
+	return titles
+}
+
+func testNoteStore(t *testing.T, newStore func() NoteStore) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		s := newStore()
+		note := models.Note{Title: "a", Content: "body", Tags: []string{"x"}}
+		if err := s.Create(ctx, &note); err != nil {
+			t.Fatal(err)
+		}
+		if note.ID.IsZero() || note.Version != 1 {
+			t.Fatalf("Create left ID %v and version %d", note.ID, note.Version)
+		}
+		got, err := s.Get(ctx, note.ID)
+		if err != nil || !reflect.DeepEqual(got, note) {
+			t.Errorf("Get = %+v, %v, want %+v", got, err, note)
+		}
+		if _, err := s.Get(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of a missing note: %v, want ErrNotFound", err)
+		}
+
+		// The stored note is a copy
+		got.Tags[0] = "changed"
+		if again, _ := s.Get(ctx, note.ID); again.Tags[0] != "x" {
+			t.Errorf("changing a returned note changed the store")
+		}
+	})
+
+	t.Run("list in insertion order", func(t *testing.T) {
+		s := newStore()
+		createNotes(t, s, models.Note{Title: "c"}, models.Note{Title: "a"}, models.Note{Title: "b"})
+		notes, err := s.List(ctx)
+		if err != nil || !slices.Equal(noteTitles(notes), []string{"c", "a", "b"}) {
+			t.Errorf("List = %v, %v", noteTitles(notes), err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := newStore()
+		note := createNotes(t, s, models.Note{Title: "a"})[0]
+
+		edit := note
+		edit.Title = "b"
+		edit.CreatedAt = time.Time{}
+		if err := s.Update(ctx, &edit, 1); err != nil {
+			t.Fatal(err)
+		}
+		if edit.Version != 2 || !edit.CreatedAt.Equal(note.CreatedAt) {
+			t.Errorf("Update left version %d and creation time %v", edit.Version, edit.CreatedAt)
+		}
+		if got, _ := s.Get(ctx, note.ID); got.Title != "b" || got.Version != 2 {
+			t.Errorf("Get after Update = %+v", got)
+		}
+
+		if err := s.Update(ctx, &edit, 1); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("Update at a stale version: %v, want ErrVersionConflict", err)
+		}
+		if err := s.Update(ctx, &edit, AnyVersion); err != nil || edit.Version != 3 {
+			t.Errorf("unconditional Update: %v, version %d", err, edit.Version)
+		}
+		missing := models.Note{ID: primitive.NewObjectID()}
+		if err := s.Update(ctx, &missing, AnyVersion); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update of a missing note: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newStore()
+		notes := createNotes(t, s, models.Note{Title: "a"}, models.Note{Title: "b"})
+		if err := s.Delete(ctx, notes[0].ID, 2); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("Delete at a wrong version: %v, want ErrVersionConflict", err)
+		}
+		if err := s.Delete(ctx, notes[0].ID, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, notes[0].ID, AnyVersion); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete twice: %v, want ErrNotFound", err)
+		}
+		if list, _ := s.List(ctx); !slices.Equal(noteTitles(list), []string{"b"}) {
+			t.Errorf("List after Delete = %v", noteTitles(list))
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		s := newStore()
+		createNotes(t, s,
+			models.Note{Title: "Alpha plan", Tags: []string{"project/alpha"}},
+			models.Note{Title: "Beta", Content: "the plan", Tags: []string{"project"}},
+			models.Note{Title: "Gamma", Tags: []string{"personal"}},
+		)
+		tests := []struct {
+			q    string
+			want []string
+		}{
+			{"plan", []string{"Alpha plan", "Beta"}},
+			{"title:plan", []string{"Alpha plan"}},
+			{"tag:project", []string{"Alpha plan", "Beta"}},
+			{"tag:project/alpha", []string{"Alpha plan"}},
+			{"-tag:project", []string{"Gamma"}},
+			{"nothing", []string{}},
+		}
+		for _, tt := range tests {
+			q, err := query.Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.q, err)
+			}
+			notes, err := s.Find(ctx, q)
+			if err != nil || !slices.Equal(noteTitles(notes), tt.want) {
+				t.Errorf("Find(%q) = %v, %v, want %v", tt.q, noteTitles(notes), err, tt.want)
+			}
+		}
+	})
+
+	t.Run("find page", func(t *testing.T) {
+		s := newStore()
+		createNotes(t, s,
+			models.Note{Title: "d", Content: "4"}, models.Note{Title: "b", Content: "2"},
+			models.Note{Title: "e", Content: "5"}, models.Note{Title: "a", Content: "1"},
+			models.Note{Title: "c", Content: "3"},
+		)
+		tests := []struct {
+			sort string
+			desc bool
+			want []string
+		}{
+			{"title", false, []string{"a", "b", "c", "d", "e"}},
+			{"title", true, []string{"e", "d", "c", "b", "a"}},
+			{"created", false, []string{"d", "b", "e", "a", "c"}},
+			{"created", true, []string{"c", "a", "e", "b", "d"}},
+		}
+		for _, tt := range tests {
+			var got []string
+			page := Page{Sort: tt.sort, Desc: tt.desc, Limit: 2, Summary: true}
+			for pages := 0; pages < 5; pages++ {
+				notes, next, err := s.FindPage(ctx, nil, page)
+				if err != nil {
+					t.Fatalf("FindPage(%s): %v", tt.sort, err)
+				}
+				for _, note := range notes {
+					if note.Content != "" {
+						t.Errorf("FindPage(%s) kept the content of a summary", tt.sort)
+					}
+				}
+				got = append(got, noteTitles(notes)...)
+				if next == nil {
+					break
+				}
+				// The cursor survives encoding
+				if page.After, err = DecodeCursor(next.Encode(), tt.sort, tt.desc); err != nil {
+					t.Fatalf("DecodeCursor: %v", err)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pages by %s (desc %v) = %v, want %v", tt.sort, tt.desc, got, tt.want)
+			}
+		}
+		if _, _, err := s.FindPage(ctx, nil, Page{Sort: "size"}); err == nil {
+			t.Errorf("FindPage accepted an unknown sort")
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		s := newStore()
+		notes := createNotes(t, s,
+			models.Note{Title: "a", Tags: []string{"x", "y"}},
+			models.Note{Title: "b", Tags: []string{"x"}},
+			models.Note{Title: "c", Tags: []string{"z"}},
+		)
+		counts, err := s.TagCounts(ctx)
+		if want := map[string]int{"x": 2, "y": 1, "z": 1}; err != nil || !reflect.DeepEqual(counts, want) {
+			t.Errorf("TagCounts = %v, %v, want %v", counts, err, want)
+		}
+
+		// Renaming to a tag a note already carries merges the two
+		changed, err := s.ReplaceTag(ctx, "x", "y", storeEpoch.Add(time.Hour))
+		if err != nil || !slices.Equal(changed, []primitive.ObjectID{notes[0].ID, notes[1].ID}) {
+			t.Errorf("ReplaceTag changed %v, %v", changed, err)
+		}
+		a, _ := s.Get(ctx, notes[0].ID)
+		if !slices.Equal(a.Tags, []string{"y"}) || a.Version != 2 || !a.UpdatedAt.Equal(storeEpoch.Add(time.Hour)) {
+			t.Errorf("after ReplaceTag, a = %+v", a)
+		}
+		if b, _ := s.Get(ctx, notes[1].ID); !slices.Equal(b.Tags, []string{"y"}) {
+			t.Errorf("after ReplaceTag, b has tags %v", b.Tags)
+		}
+
+		// An empty replacement removes the tag
+		if changed, err := s.ReplaceTag(ctx, "z", "", storeEpoch); err != nil || len(changed) != 1 {
+			t.Errorf("removing a tag changed %v, %v", changed, err)
+		}
+		if c, _ := s.Get(ctx, notes[2].ID); len(c.Tags) != 0 {
+			t.Errorf("after removing z, c has tags %v", c.Tags)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		s := newStore()
+		notes := createNotes(t, s, models.Note{Title: "a", Content: "old"})
+		notebook := primitive.NewObjectID()
+
+		// An edit made after the note was read survives the move
+		edited := notes[0]
+		edited.Content = "new"
+		if err := s.Update(ctx, &edited, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+		moved, err := s.Move(ctx, notes[0].ID, &notebook, storeEpoch.Add(time.Hour))
+		if err != nil || !moved {
+			t.Fatalf("Move = %v, %v", moved, err)
+		}
+		got, _ := s.Get(ctx, notes[0].ID)
+		if got.NotebookID == nil || *got.NotebookID != notebook || got.Content != "new" || got.Version != 3 ||
+			!got.UpdatedAt.Equal(storeEpoch.Add(time.Hour)) {
+			t.Errorf("after Move, note = %+v", got)
+		}
+
+		// Moving to where the note already is changes nothing
+		same := notebook
+		if moved, err := s.Move(ctx, notes[0].ID, &same, storeEpoch); err != nil || moved {
+			t.Errorf("Move to the same notebook = %v, %v", moved, err)
+		}
+		if moved, err := s.Move(ctx, notes[0].ID, nil, storeEpoch); err != nil || !moved {
+			t.Errorf("Move out of the notebook = %v, %v", moved, err)
+		}
+		if got, _ := s.Get(ctx, notes[0].ID); got.NotebookID != nil || got.Version != 4 {
+			t.Errorf("after moving out, note = %+v", got)
+		}
+		if moved, err := s.Move(ctx, notes[0].ID, nil, storeEpoch); err != nil || moved {
+			t.Errorf("Move to no notebook again = %v, %v", moved, err)
+		}
+		if _, err := s.Move(ctx, primitive.NewObjectID(), nil, storeEpoch); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Move of a missing note: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// createImports stores imports a day apart
+func createImports(t *testing.T, s ImportStore, imports ...models.Import) []models.Import {
+	t.Helper()
+	for i := range imports {
+		imports[i].CreatedAt = storeEpoch.Add(time.Duration(i) * 24 * time.Hour)
+		if err := s.Create(context.Background(), &imports[i]); err != nil {
+			t.Fatalf("Create(%q): %v", imports[i].FileName, err)
+		}
+	}
+	return imports
+}
+
+func importNames(imports []models.Import) []string {
+	names := []string{}
+	for _, imp := range imports {
+		names = append(names, imp.FileName)
+	}
+	return names
+}
+
+func testImportStore(t *testing.T, newStore func() ImportStore) {
+	ctx := context.Background()
+
+	t.Run("create, get, update and delete", func(t *testing.T) {
+		s := newStore()
+		imp := models.Import{FileName: "a.png", Tags: []string{"x"}, Thumbnails: []models.Thumbnail{{Size: 64}}}
+		if err := s.Create(ctx, &imp); err != nil {
+			t.Fatal(err)
+		}
+		if imp.ID.IsZero() {
+			t.Fatal("Create left the ID empty")
+		}
+		got, err := s.Get(ctx, imp.ID)
+		if err != nil || !reflect.DeepEqual(got, imp) {
+			t.Errorf("Get = %+v, %v, want %+v", got, err, imp)
+		}
+		got.Thumbnails[0].Size = 1
+		if again, _ := s.Get(ctx, imp.ID); again.Thumbnails[0].Size != 64 {
+			t.Errorf("changing a returned import changed the store")
+		}
+
+		imp.FileName = "b.png"
+		if err := s.Update(ctx, imp); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Get(ctx, imp.ID); got.FileName != "b.png" {
+			t.Errorf("Get after Update = %+v", got)
+		}
+		if err := s.Update(ctx, models.Import{ID: primitive.NewObjectID()}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update of a missing import: %v, want ErrNotFound", err)
+		}
+
+		if err := s.Delete(ctx, imp.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, imp.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+		}
+		if err := s.Delete(ctx, imp.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete twice: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("find page", func(t *testing.T) {
+		s := newStore()
+		createImports(t, s,
+			models.Import{FileName: "c.png", FileType: "image", MIMEType: "image/png", Tags: []string{"trip/paris"}},
+			models.Import{FileName: "a.pdf", FileType: "document", MIMEType: "application/pdf", Tags: []string{"trip"}},
+			models.Import{FileName: "b.mp4", FileType: "video", MIMEType: "video/mp4", Tags: []string{"work"}},
+		)
+		tests := []struct {
+			filter ImportFilter
+			sort   string
+			want   []string
+		}{
+			{ImportFilter{}, "created", []string{"c.png", "a.pdf", "b.mp4"}},
+			{ImportFilter{}, "name", []string{"a.pdf", "b.mp4", "c.png"}},
+			{ImportFilter{FileTypes: []string{"IMAGE", "video"}}, "created", []string{"c.png", "b.mp4"}},
+			{ImportFilter{FileTypes: []string{"application/pdf"}}, "created", []string{"a.pdf"}},
+			{ImportFilter{Tag: "Trip"}, "created", []string{"c.png", "a.pdf"}},
+			{ImportFilter{Tag: "trip/paris"}, "created", []string{"c.png"}},
+			{ImportFilter{CreatedFrom: storeEpoch.Add(24 * time.Hour)}, "created", []string{"a.pdf", "b.mp4"}},
+			{ImportFilter{CreatedTo: storeEpoch.Add(24 * time.Hour)}, "created", []string{"c.png"}},
+		}
+		for _, tt := range tests {
+			imports, next, err := s.FindPage(ctx, tt.filter, Page{Sort: tt.sort})
+			if err != nil || next != nil || !slices.Equal(importNames(imports), tt.want) {
+				t.Errorf("FindPage(%+v, %s) = %v, %v, %v, want %v", tt.filter, tt.sort, importNames(imports), next, err, tt.want)
+			}
+		}
+
+		first, next, err := s.FindPage(ctx, ImportFilter{}, Page{Sort: "name", Limit: 2})
+		if err != nil || next == nil || !slices.Equal(importNames(first), []string{"a.pdf", "b.mp4"}) {
+			t.Fatalf("first page = %v, %v, %v", importNames(first), next, err)
+		}
+		rest, next, err := s.FindPage(ctx, ImportFilter{}, Page{Sort: "name", Limit: 2, After: next})
+		if err != nil || next != nil || !slices.Equal(importNames(rest), []string{"c.png"}) {
+			t.Errorf("second page = %v, %v, %v", importNames(rest), next, err)
+		}
+	})
+
+	t.Run("set thumbnails", func(t *testing.T) {
+		s := newStore()
+		imports := createImports(t, s,
+			models.Import{FileName: "a.png"},
+			models.Import{FileName: "b.png"},
+			models.Import{FileName: "c.png", Thumbnails: []models.Thumbnail{{Size: 64, BlobID: "old"}}},
+		)
+		thumbs := []models.Thumbnail{{Size: 128, BlobID: "t1"}}
+		if set, err := s.SetThumbnails(ctx, imports[0].ID, thumbs, ""); !set || err != nil {
+			t.Errorf("SetThumbnails = %v, %v, want true", set, err)
+		}
+		if got, _ := s.Get(ctx, imports[0].ID); !reflect.DeepEqual(got.Thumbnails, thumbs) {
+			t.Errorf("thumbnails %+v, want %+v", got.Thumbnails, thumbs)
+		}
+		if set, err := s.SetThumbnails(ctx, imports[0].ID, []models.Thumbnail{{Size: 128, BlobID: "t2"}}, ""); set || err != nil {
+			t.Errorf("SetThumbnails twice = %v, %v, want false", set, err)
+		}
+		if got, _ := s.Get(ctx, imports[0].ID); !reflect.DeepEqual(got.Thumbnails, thumbs) {
+			t.Errorf("a second SetThumbnails replaced %+v with %+v", thumbs, got.Thumbnails)
+		}
+
+		if set, err := s.SetThumbnails(ctx, imports[1].ID, nil, "bad image"); !set || err != nil {
+			t.Errorf("SetThumbnails with a failure = %v, %v, want true", set, err)
+		}
+		if set, _ := s.SetThumbnails(ctx, imports[1].ID, thumbs, ""); set {
+			t.Error("SetThumbnails replaced a recorded failure")
+		}
+		if got, _ := s.Get(ctx, imports[1].ID); got.ThumbnailError != "bad image" || len(got.Thumbnails) != 0 {
+			t.Errorf("after a failure, thumbnails %+v, error %q", got.Thumbnails, got.ThumbnailError)
+		}
+
+		if set, err := s.SetThumbnails(ctx, imports[2].ID, thumbs, ""); set || err != nil {
+			t.Errorf("SetThumbnails on an import with thumbnails = %v, %v, want false", set, err)
+		}
+		if _, err := s.SetThumbnails(ctx, primitive.NewObjectID(), thumbs, ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SetThumbnails of a missing import: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		s := newStore()
+		imports := createImports(t, s,
+			models.Import{FileName: "a", Tags: []string{"x", "y"}},
+			models.Import{FileName: "b", Tags: []string{"x"}},
+		)
+		counts, err := s.TagCounts(ctx)
+		if want := map[string]int{"x": 2, "y": 1}; err != nil || !reflect.DeepEqual(counts, want) {
+			t.Errorf("TagCounts = %v, %v, want %v", counts, err, want)
+		}
+		changed, err := s.ReplaceTag(ctx, "x", "y")
+		if err != nil || !slices.Equal(changed, []primitive.ObjectID{imports[0].ID, imports[1].ID}) {
+			t.Errorf("ReplaceTag changed %v, %v", changed, err)
+		}
+		for _, imp := range imports {
+			if got, _ := s.Get(ctx, imp.ID); !slices.Equal(got.Tags, []string{"y"}) {
+				t.Errorf("after ReplaceTag, %s has tags %v", imp.FileName, got.Tags)
+			}
+		}
+		if changed, err := s.ReplaceTag(ctx, "missing", "y"); err != nil || len(changed) != 0 {
+			t.Errorf("replacing a missing tag changed %v, %v", changed, err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package tags
+
+import (
+	"sort"
+	"strings"
+)
+
+// Facet counts the items carrying a tag or any tag below it
+type Facet struct {
+	Tag      string  `json:"tag"`  // the full tag, such as "project/alpha"
+	Name     string  `json:"name"` // its last level, such as "alpha"
+	Count    int     `json:"count"`
+	Children []Facet `json:"children,omitempty"`
+}
+
+// Facets builds the tag tree of the given tag lists, one per item. An item
+// counts once towards each level of each of its tags. Siblings are ordered by
+// count, most used first, then by name.
+func Facets(lists [][]string) []Facet {
+	counts := make(map[string]int)
+	for _, list := range lists {
+		seen := make(map[string]bool)
+		for _, tag := range list {
+			for _, level := range Ancestors(tag) {
+				if !seen[level] {
+					seen[level] = true
+					counts[level]++
+				}
+			}
+		}
+	}
+
+	// Group the tags under their parents, the top level under ""
+	children := make(map[string][]Facet)
+	for tag, count := range counts {
+		parent, name := "", tag
+		if i := strings.LastIndex(tag, Separator); i >= 0 {
+			parent, name = tag[:i], tag[i+1:]
+		}
+		children[parent] = append(children[parent], Facet{Tag: tag, Name: name, Count: count})
+	}
+	if top := facetLevel(children, ""); top != nil {
+		return top
+	}
+	return []Facet{}
+}
+
+// facetLevel returns the sorted facets directly below parent with their own
+// children filled in
+func facetLevel(children map[string][]Facet, parent string) []Facet {
+	facets := children[parent]
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Name < facets[j].Name
+	})
+	for i := range facets {
+		facets[i].Children = facetLevel(children, facets[i].Tag)
+	}
+	return facets
+}
@@ -0,0 +1,42 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFacets(t *testing.T) {
+	got := Facets([][]string{
+		{"project/alpha/design", "project/alpha"},
+		{"project/beta", "home"},
+		{"project/alpha"},
+		{"home"},
+		nil,
+	})
+	want := []Facet{
+		{Tag: "project", Name: "project", Count: 3, Children: []Facet{
+			{Tag: "project/alpha", Name: "alpha", Count: 2, Children: []Facet{
+				{Tag: "project/alpha/design", Name: "design", Count: 1},
+			}},
+			{Tag: "project/beta", Name: "beta", Count: 1},
+		}},
+		{Tag: "home", Name: "home", Count: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Facets = %+v\nwant %+v", got, want)
+	}
+
+	// Ties are broken by name
+	got = Facets([][]string{{"b"}, {"a"}, {"c"}})
+	var names []string
+	for _, f := range got {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("facets with equal counts in order %v", names)
+	}
+
+	if got := Facets(nil); got == nil || len(got) != 0 {
+		t.Errorf("Facets(nil) = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,77 @@
+// Package tags normalizes the tags attached to notes and imports
+package tags
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Separator divides a tag into levels, as in "project/alpha/design"
+const Separator = "/"
+
+// Normalize returns the canonical form of a tag: lower case, with each level
+// trimmed and its inner runs of whitespace collapsed to a single space, and
+// empty levels dropped
+func Normalize(tag string) string {
+	levels := strings.Split(strings.ToLower(tag), Separator)
+	out := levels[:0]
+	for _, level := range levels {
+		if level = strings.Join(strings.Fields(level), " "); level != "" {
+			out = append(out, level)
+		}
+	}
+	return strings.Join(out, Separator)
+}
+
+// NormalizeAll normalizes every tag, dropping empty tags and duplicates while
+// keeping the first occurrence of each
+func NormalizeAll(list []string) []string {
+	out := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, tag := range list {
+		tag = Normalize(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// Split parses tags typed as one string. Tags are separated by commas, or by
+// whitespace when the string has no commas, so "work, machine learning" and
+// "work go" are both read as intended.
+func Split(s string) []string {
+	var parts []string
+	if strings.Contains(s, ",") {
+		parts = strings.Split(s, ",")
+	} else {
+		parts = strings.FieldsFunc(s, unicode.IsSpace)
+	}
+	return NormalizeAll(parts)
+}
+
+// Within reports whether tag is the normalized tag prefix or one of its
+// descendants, so "project/alpha/design" is within "project/alpha"
+func Within(tag, prefix string) bool {
+	return tag == prefix || strings.HasPrefix(tag, prefix+Separator)
+}
+
+// Pattern returns a regular expression matching the tags Within prefix
+func Pattern(prefix string) string {
+	return "^" + regexp.QuoteMeta(prefix) + "(" + Separator + "|$)"
+}
+
+// Ancestors returns the tag and every tag above it, from the top level down,
+// so "a/b/c" gives "a", "a/b" and "a/b/c"
+func Ancestors(tag string) []string {
+	var out []string
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == Separator[0] {
+			out = append(out, tag[:i])
+		}
+	}
+	return append(out, tag)
+}
@@ -0,0 +1,104 @@
+package tags
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Go", "go"},
+		{"  machine   Learning ", "machine learning"},
+		{"ÜBER", "über"},
+		{"tab\tand\nnewline", "tab and newline"},
+		{"", ""},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAll(t *testing.T) {
+	got := NormalizeAll([]string{"Work", " ", "go", "WORK", "Go ", "ideas"})
+	if want := []string{"work", "go", "ideas"}; !slices.Equal(got, want) {
+		t.Errorf("NormalizeAll = %q, want %q", got, want)
+	}
+	if got := NormalizeAll(nil); got == nil || len(got) != 0 {
+		t.Errorf("NormalizeAll(nil) = %#v, want an empty list", got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"work, machine learning", []string{"work", "machine learning"}},
+		{"work go  Go", []string{"work", "go"}},
+		{"a,,b, ,", []string{"a", "b"}},
+		{"single", []string{"single"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLevels(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Project/Alpha", "project/alpha"},
+		{" project / alpha  team /design ", "project/alpha team/design"},
+		{"/a//b/", "a/b"},
+		{"//", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		tag, prefix string
+		want        bool
+	}{
+		{"project", "project", true},
+		{"project/alpha", "project", true},
+		{"project/alpha/design", "project/alpha", true},
+		{"projects", "project", false},
+		{"project", "project/alpha", false},
+		{"a.b/c", "a.b", true},
+		{"axb", "a.b", false},
+	}
+	for _, tt := range tests {
+		if got := Within(tt.tag, tt.prefix); got != tt.want {
+			t.Errorf("Within(%q, %q) = %v, want %v", tt.tag, tt.prefix, got, tt.want)
+		}
+		pattern := regexp.MustCompile(Pattern(tt.prefix))
+		if got := pattern.MatchString(tt.tag); got != tt.want {
+			t.Errorf("Pattern(%q) matching %q = %v, want %v", tt.prefix, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"a/b/c", []string{"a", "a/b", "a/b/c"}},
+		{"solo", []string{"solo"}},
+	}
+	for _, tt := range tests {
+		if got := Ancestors(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("Ancestors(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels caps the source images that are decoded, guarding against
+// decompression bombs. Decoded as RGBA, the largest take 64 MB.
+const MaxPixels = 16 << 20
+
+// ErrTooLarge is returned for images above MaxPixels
+var ErrTooLarge = errors.New("thumbnail: image too large")
+
+// Thumbnail is one encoded, downscaled rendition of an image
+type Thumbnail struct {
+	Size   int // bounding box edge the image was fitted into
+	Width  int
+	Height int
+	MIME   string
+	Data   []byte
+}
+
+// Generate decodes the image once and renders it fitted into each square
+// bounding box in sizes. Images are never upscaled, so sizes at or above the
+// source dimensions produce a copy at the original size. Formats that may
+// carry transparency are encoded as PNG, everything else as JPEG.
+func Generate(r io.ReadSeeker, sizes []int) ([]Thumbnail, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	encodePNG := format == "png" || format == "gif"
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+
+	thumbs := make([]Thumbnail, 0, len(sorted))
+	for _, size := range sorted {
+		dst := resize(src, size)
+		var buf bytes.Buffer
+		mime := "image/jpeg"
+		if encodePNG {
+			mime = "image/png"
+			err = png.Encode(&buf, dst)
+		} else {
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		}
+		if err != nil {
+			return nil, err
+		}
+		bounds := dst.Bounds()
+		thumbs = append(thumbs, Thumbnail{
+			Size:   size,
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			MIME:   mime,
+			Data:   buf.Bytes(),
+		})
+	}
+	return thumbs, nil
+}
+
+// resize fits src into a size x size box, keeping its aspect ratio
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, xdraw.Src, nil)
+	return dst
+}
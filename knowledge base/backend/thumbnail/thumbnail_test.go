@@ -0,0 +1,85 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// testImage returns a w x h gradient
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	return img
+}
+
+func TestGenerate(t *testing.T) {
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, testImage(300, 150)); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, testImage(100, 200), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		sizes []int
+		want  []Thumbnail // without Data
+	}{
+		{"png", pngData.Bytes(), []int{256, 128, 512}, []Thumbnail{
+			{Size: 128, Width: 128, Height: 64, MIME: "image/png"},
+			{Size: 256, Width: 256, Height: 128, MIME: "image/png"},
+			{Size: 512, Width: 300, Height: 150, MIME: "image/png"},
+		}},
+		{"jpeg portrait", jpegData.Bytes(), []int{64}, []Thumbnail{
+			{Size: 64, Width: 32, Height: 64, MIME: "image/jpeg"},
+		}},
+	}
+	for _, tt := range tests {
+		thumbs, err := Generate(bytes.NewReader(tt.data), tt.sizes)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(thumbs) != len(tt.want) {
+			t.Errorf("%s: %d thumbnails, want %d", tt.name, len(thumbs), len(tt.want))
+			continue
+		}
+		for i, thumb := range thumbs {
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb.Data))
+			if err != nil {
+				t.Errorf("%s: thumbnail %d does not decode: %v", tt.name, thumb.Size, err)
+				continue
+			}
+			if "image/"+format != thumb.MIME || cfg.Width != thumb.Width || cfg.Height != thumb.Height {
+				t.Errorf("%s: thumbnail %d holds a %dx%d %s", tt.name, thumb.Size, cfg.Width, cfg.Height, format)
+			}
+			thumb.Data = nil
+			if !reflect.DeepEqual(thumb, tt.want[i]) {
+				t.Errorf("%s: thumbnail %d = %+v, want %+v", tt.name, i, thumb, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestGenerateRejects(t *testing.T) {
+	// A GIF screen of 65535 x 65535 pixels, of which only the header is read
+	bomb := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+	if _, err := Generate(bytes.NewReader(bomb), []int{128}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Generate of a huge image = %v, want ErrTooLarge", err)
+	}
+	if _, err := Generate(bytes.NewReader([]byte("not an image")), []int{128}); err == nil {
+		t.Error("Generate of a text file succeeded")
+	}
+}